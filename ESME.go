@@ -1,25 +1,18 @@
 package smpp
 
 import (
-	"bytes"
 	"encoding/binary"
 	"errors"
 	"fmt"
 	"io"
-	"log"
 	"net"
+	"os"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 )
 
-var (
-	DebugSmppLogger   *log.Logger
-	WarningSmppLogger *log.Logger
-	InfoSmppLogger    *log.Logger
-	ErrorSmppLogger   *log.Logger
-)
-
 // ESME is the client side of the SMPP protocol.  Users should be
 // managing their ESMEs to connect to an SMPP server (SMSC).
 type ESME struct {
@@ -29,6 +22,24 @@ type ESME struct {
 	CommandFunctions map[string]func(*ESME, PDU) error
 	defaults         map[string]interface{}
 	wg               sync.WaitGroup
+	pdusSent         atomic.Uint64
+	pdusReceived     atomic.Uint64
+	logger           Logger
+	metrics          Metrics
+	inbound          []Interceptor
+	outbound         []Interceptor
+	capture          Capture
+	controlLoop      atomic.Bool
+	requestsMu       sync.Mutex
+	requests         map[int]pendingRequest
+}
+
+// pendingRequest is a request sent by the ESME and not answered yet, the
+// response being handed over when someone waits for it.
+type pendingRequest struct {
+	commandId string
+	sentAt    time.Time
+	response  chan PDU
 }
 
 const (
@@ -55,6 +66,16 @@ func NewEsme(clientSocket net.Conn) (e *ESME) {
 		map[string]func(*ESME, PDU) error{},
 		map[string]interface{}{},
 		sync.WaitGroup{},
+		atomic.Uint64{},
+		atomic.Uint64{},
+		legacyLogger{},
+		noMetrics{},
+		nil,
+		nil,
+		nil,
+		atomic.Bool{},
+		sync.Mutex{},
+		map[int]pendingRequest{},
 	}
 	registerStandardBehaviours(e)
 	return e
@@ -73,6 +94,21 @@ func (e *ESME) SetDefaults(defaults map[string]interface{}) {
 	e.defaults = defaults
 }
 
+// SetLogger gives the Logger of the ESME, nil silencing it.  It must be set
+// before starting the control loop.
+func (e *ESME) SetLogger(logger Logger) {
+	e.logger = loggerWith(logger, "remote_addr", e.clientSocket.RemoteAddr())
+}
+
+// SetMetrics gives the Metrics of the ESME, nil disabling them.  It must be
+// set before starting the control loop.
+func (e *ESME) SetMetrics(metrics Metrics) {
+	if metrics == nil {
+		metrics = noMetrics{}
+	}
+	e.metrics = metrics
+}
+
 func (e *ESME) GetEsmeState() string {
 	return e.state.GetState()
 }
@@ -98,6 +134,35 @@ func (e *ESME) BindReceiver(systemID, password string) (resp *PDU, err error) {
 	return e.bindWithSmsc(pdu)
 }
 
+// Unbind ends the session, the connection stays open and can be bound
+// again.
+func (e *ESME) Unbind() (resp *PDU, err error) {
+	resp, err = e.sendAndWaitForResponse(NewUnbind())
+	if err == nil {
+		e.state.SetState(OPEN)
+	}
+	return resp, err
+}
+
+// QuerySM asks the SMSC the state of a message previously submitted from the
+// source address.
+func (e *ESME) QuerySM(messageId string, source Address) (resp *PDU, err error) {
+	pdu := NewQuerySM().WithMessageId(messageId).WithSource(source)
+	return e.sendAndWaitForResponse(pdu)
+}
+
+func (e *ESME) CancelSM(messageId string, source Address, destination Address) (resp *PDU, err error) {
+	pdu := NewCancelSM().WithMessageId(messageId).WithSource(source).WithDestination(destination)
+	return e.sendAndWaitForResponse(pdu)
+}
+
+// ReplaceSM replaces the text of a message still pending in the SMSC.  Use
+// NewReplaceSM with Send to replace the other fields.
+func (e *ESME) ReplaceSM(messageId string, source Address, message string) (resp *PDU, err error) {
+	pdu := NewReplaceSM().WithMessageId(messageId).WithSource(source).WithMessage(message)
+	return e.sendAndWaitForResponse(pdu)
+}
+
 func (e *ESME) Send(pdu *PDU) (seq_num int, err error) {
 	if pdu.Header.SequenceNumber == 0 {
 		seq_num = int(atomic.AddInt32(&(e.sequenceNumber), 1))
@@ -105,21 +170,154 @@ func (e *ESME) Send(pdu *PDU) (seq_num int, err error) {
 		seq_num = pdu.Header.SequenceNumber
 	}
 	send_pdu := pdu.WithSequenceNumber(seq_num)
-	expectedBytes, err := EncodePdu(send_pdu)
-	if err != nil {
-		return seq_num, err
+	if e.controlLoop.Load() && !isResponse(send_pdu) {
+		e.trackRequest(send_pdu, nil)
+	}
+	err = e.sendPdu(send_pdu)
+	var intercepted InterceptedResponse
+	if errors.As(err, &intercepted) {
+		e.answerRequest(intercepted.Response)
+	} else if err != nil {
+		e.forgetRequest(seq_num)
 	}
-	_, err = e.clientSocket.Write(expectedBytes)
 	return seq_num, err
 }
 
+// sendPdu sends the PDU as is through the outbound interceptors.
+func (e *ESME) sendPdu(pdu PDU) error {
+	err := chainInterceptors(e.outbound, (*ESME).encodeAndWritePdu)(e, pdu)
+	var intercepted InterceptedResponse
+	if errors.As(err, &intercepted) {
+		return InterceptedResponse{intercepted.answering(pdu)}
+	}
+	return err
+}
+
+func (e *ESME) encodeAndWritePdu(pdu PDU) error {
+	pduBytes, err := EncodePdu(pdu)
+	if err != nil {
+		return err
+	}
+	return e.writePdu(pdu, pduBytes)
+}
+
+func (e *ESME) writePdu(pdu PDU, pduBytes []byte) error {
+	_, err := e.clientSocket.Write(pduBytes)
+	if err == nil {
+		e.capturePdu(Outbound, pduBytes)
+		e.pdusSent.Add(1)
+		e.metrics.PduSent(pdu.Header.CommandId, pdu.Header.CommandStatus)
+	}
+	return err
+}
+
 func (e *ESME) bindWithSmsc(pdu PDU) (*PDU, error) {
-	_, err := e.Send(&pdu)
+	_, resp, err := e.sendRequest(pdu)
 	if err != nil {
 		return nil, err
 	}
-	resp, err := waitForBindResponse(e)
-	return resp, err
+	if resp.Header.CommandStatus != ESME_ROK {
+		e.metrics.BindFailed(pdu.Header.CommandId, resp.Header.CommandStatus)
+	}
+	return &resp, setESMEStateFromSMSCResponse(&resp, e)
+}
+
+// sendRequest sends the request and gives its response, the one received or
+// the one given by an outbound interceptor.  While the control loop runs, the
+// response is handed over by the control loop rather than read.
+func (e *ESME) sendRequest(pdu PDU) (int, PDU, error) {
+	controlLoop := e.controlLoop.Load()
+	if pdu.Header.SequenceNumber == 0 {
+		pdu = pdu.WithSequenceNumber(int(atomic.AddInt32(&(e.sequenceNumber), 1)))
+	}
+	response := e.trackRequest(pdu, make(chan PDU, 1))
+	sequenceNumber, err := e.Send(&pdu)
+	var intercepted InterceptedResponse
+	if errors.As(err, &intercepted) {
+		return sequenceNumber, intercepted.Response, nil
+	}
+	if err != nil {
+		return sequenceNumber, PDU{}, err
+	}
+	if !controlLoop {
+		resp, err := e.receivePdu()
+		if err != nil || !e.answerRequest(resp) {
+			e.forgetRequest(sequenceNumber)
+		}
+		return sequenceNumber, resp, err
+	}
+	select {
+	case resp := <-response:
+		return sequenceNumber, resp, nil
+	case <-time.After(1 * time.Second):
+		e.forgetRequest(sequenceNumber)
+		return sequenceNumber, PDU{}, fmt.Errorf("Couldn't get the response to our %v : %w", pdu.Header.CommandId, os.ErrDeadlineExceeded)
+	}
+}
+
+// trackRequest counts the request in the window until it's answered or
+// forgotten, the response being handed over to the channel if not nil.
+func (e *ESME) trackRequest(pdu PDU, response chan PDU) chan PDU {
+	e.requestsMu.Lock()
+	defer e.requestsMu.Unlock()
+	if request, ok := e.requests[pdu.Header.SequenceNumber]; ok {
+		return request.response
+	}
+	e.requests[pdu.Header.SequenceNumber] = pendingRequest{pdu.Header.CommandId, time.Now(), response}
+	e.metrics.WindowOccupancy(1)
+	return response
+}
+
+// answerRequest records the latency of the request the response answers and
+// tells whether the response was handed over to someone waiting for it.
+func (e *ESME) answerRequest(resp PDU) bool {
+	if !isResponse(resp) {
+		return false
+	}
+	request, ok := e.untrackRequest(resp.Header.SequenceNumber)
+	if !ok {
+		return false
+	}
+	e.metrics.RequestLatency(request.commandId, time.Since(request.sentAt))
+	if request.response == nil {
+		return false
+	}
+	request.response <- resp
+	return true
+}
+
+// forgetRequest takes the request out of the window without a response.
+func (e *ESME) forgetRequest(sequenceNumber int) {
+	e.untrackRequest(sequenceNumber)
+}
+
+func (e *ESME) untrackRequest(sequenceNumber int) (pendingRequest, bool) {
+	e.requestsMu.Lock()
+	request, ok := e.requests[sequenceNumber]
+	delete(e.requests, sequenceNumber)
+	e.requestsMu.Unlock()
+	if ok {
+		e.metrics.WindowOccupancy(-1)
+	}
+	return request, ok
+}
+
+func isResponse(pdu PDU) bool {
+	return strings.HasSuffix(pdu.Header.CommandId, "_resp") || pdu.Header.CommandId == "generic_nack"
+}
+
+func (e *ESME) sendAndWaitForResponse(pdu PDU) (*PDU, error) {
+	sequenceNumber, resp, err := e.sendRequest(pdu)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Header.CommandId != pdu.Header.CommandId+"_resp" || resp.Header.SequenceNumber != sequenceNumber {
+		return &resp, fmt.Errorf("The answer received isn't the response to our %v : %v", pdu.Header.CommandId, resp)
+	}
+	if resp.Header.CommandStatus != ESME_ROK {
+		return &resp, StatusError{Status: resp.Header.CommandStatus, Err: fmt.Errorf("%v refused by the SMSC", pdu.Header.CommandId)}
+	}
+	return &resp, nil
 }
 
 func waitForBindResponse(e *ESME) (pdu *PDU, err error) {
@@ -136,13 +334,13 @@ func setESMEStateFromSMSCResponse(pdu *PDU, Esme *ESME) (err error) {
 	if pdu.Header.CommandStatus == ESME_ROK {
 		switch pdu.Header.CommandId {
 		case "bind_receiver_resp":
-			Esme.state.setState <- BOUND_RX
+			Esme.state.SetState(BOUND_RX)
 
 		case "bind_transmitter_resp":
-			Esme.state.setState <- BOUND_TX
+			Esme.state.SetState(BOUND_TX)
 
 		case "bind_transceiver_resp":
-			Esme.state.setState <- BOUND_TRX
+			Esme.state.SetState(BOUND_TRX)
 		}
 	} else {
 		err = fmt.Errorf("The answer received wasn't OK or not the type we expected : %v", pdu)
@@ -151,35 +349,67 @@ func setESMEStateFromSMSCResponse(pdu *PDU, Esme *ESME) (err error) {
 }
 
 func (e *ESME) receivePdu() (PDU, error) {
-	readBuf, LastError := readPduBytesFromConnection(e.clientSocket, time.Now().Add(1*time.Second))
+	return e.receivePduBefore(time.Now().Add(1 * time.Second))
+}
+
+// receivePduBefore blocks until a PDU is received and let through the
+// inbound interceptors, or the deadline passes, a zero deadline meaning no
+// deadline at all.
+func (e *ESME) receivePduBefore(deadline time.Time) (PDU, error) {
+	for {
+		pdu, err := e.readPduBefore(deadline)
+		if err != nil || len(e.inbound) == 0 {
+			return pdu, err
+		}
+		if pdu, ok := e.interceptInbound(pdu); ok {
+			return pdu, nil
+		}
+	}
+}
+
+func (e *ESME) readPduBefore(deadline time.Time) (PDU, error) {
+	readBuf, LastError := readPduBytesFromConnection(e.clientSocket, deadline)
 	if LastError != nil {
-		if errors.Is(LastError, io.EOF) || errors.Is(LastError, net.ErrClosed) {
+		if isConnectionClosed(LastError) {
 			go e.Close()
 		}
 		return PDU{}, fmt.Errorf("Couldn't read on a Connection: \n err =%w", LastError)
 	}
-	return ParsePdu(readBuf)
+	e.capturePdu(Inbound, readBuf)
+	e.pdusReceived.Add(1)
+	pdu, err := ParsePdu(readBuf)
+	if err == nil {
+		e.metrics.PduReceived(pdu.Header.CommandId, pdu.Header.CommandStatus)
+	}
+	return pdu, err
+}
+
+func isConnectionClosed(err error) bool {
+	return errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, net.ErrClosed)
 }
 
+// Command lengths above this are refused rather than allocated, the largest
+// PDUs (ie. submit_multi) stay well below.
+const maxCommandLength = 64 * 1024
+
 func readPduBytesFromConnection(ConnectionSocket net.Conn, timeout time.Time) ([]byte, error) {
-	buffer := bytes.Buffer{}
-	err := ConnectionSocket.SetDeadline(timeout)
+	err := ConnectionSocket.SetReadDeadline(timeout)
 	if err != nil {
 		return nil, err
 	}
 	readLengthBuffer := make([]byte, 4)
-	_, err = ConnectionSocket.Read(readLengthBuffer)
-	if err == nil {
-		length := int(binary.BigEndian.Uint32(readLengthBuffer))
-		if length <= 4 {
-			return nil, fmt.Errorf("Received malformed packet : %v", readLengthBuffer)
-		}
-		readBuf := make([]byte, length-4)
-		_, err = ConnectionSocket.Read(readBuf)
-		buffer.Write(readLengthBuffer)
-		buffer.Write(readBuf)
+	_, err = io.ReadFull(ConnectionSocket, readLengthBuffer)
+	if err != nil {
+		return nil, err
 	}
-	return buffer.Bytes(), err
+	length := int(binary.BigEndian.Uint32(readLengthBuffer))
+	if length <= 4 || length > maxCommandLength {
+		return nil, fmt.Errorf("Received malformed packet : %v", readLengthBuffer)
+	}
+	pduBytes := make([]byte, length)
+	copy(pduBytes, readLengthBuffer)
+	_, err = io.ReadFull(ConnectionSocket, pduBytes[4:])
+	return pduBytes, err
 }
 
 func (e *ESME) isTransmitterState() bool {
@@ -194,22 +424,45 @@ func (e *ESME) isReceiverState() bool {
 
 func registerStandardBehaviours(e *ESME) {
 	e.CommandFunctions["enquire_link"] = handleEnquiryLinkPduReceived
-	e.CommandFunctions["submit_sm"] = handleSubmitSmPduReceived
 	e.CommandFunctions["deliver_sm"] = handleDeliverSmPduReceived
+	e.CommandFunctions["unbind"] = handleUnbindPduReceived
+	e.CommandFunctions["unbind_resp"] = handleUnbindRespPduReceived
 }
 
 func (e *ESME) StartControlLoop() {
+	e.controlLoop.Store(true)
 	e.wg.Add(1)
 	go e.pduDispatcher()
 }
 
 func (e *ESME) pduDispatcher() {
 	for e.GetEsmeState() != CLOSED {
-		pdu, err := e.receivePdu()
-		if err != nil || pdu.Header == (Header{}) {
+		pdu, err := e.receivePduBefore(time.Time{})
+		if isConnectionClosed(err) {
+			break
+		}
+		if err != nil {
+			e.logger.Warn("Couldn't receive a PDU", "error", err)
 			continue
 		}
-		e.CommandFunctions[pdu.Header.CommandId](e, pdu)
+		if pdu.Header == (Header{}) || e.answerRequest(pdu) {
+			continue
+		}
+		handler, ok := e.CommandFunctions[pdu.Header.CommandId]
+		if !ok {
+			withPdu(e.logger, pdu).Debug("No function registered for the PDU")
+			continue
+		}
+		if err = handler(e, pdu); err != nil {
+			withPdu(e.logger, pdu).Warn("Couldn't handle the PDU", "error", err)
+		}
+	}
+	e.controlLoop.Store(false)
+	e.requestsMu.Lock()
+	for sequenceNumber := range e.requests {
+		delete(e.requests, sequenceNumber)
+		e.metrics.WindowOccupancy(-1)
 	}
+	e.requestsMu.Unlock()
 	e.wg.Done()
 }
@@ -1,10 +1,14 @@
 package smpp
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net"
 	"os"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -18,12 +22,7 @@ const (
 	invalidUserName = "InvalidUser"
 )
 
-func init() {
-	DebugSmppLogger = log.New(os.Stdout, "DEBUG: ", log.Ldate|log.Ltime|log.Lshortfile)
-	InfoSmppLogger = log.New(os.Stdout, "INFO: ", log.Ldate|log.Ltime|log.Lshortfile)
-	WarningSmppLogger = log.New(os.Stdout, "WARNING: ", log.Ldate|log.Ltime|log.Lshortfile)
-	ErrorSmppLogger = log.New(os.Stdout, "ERROR: ", log.Ldate|log.Ltime|log.Lshortfile)
-}
+var testLogger = NewStdLogger(log.New(os.Stdout, "", log.Ldate|log.Ltime))
 
 func TestEsmeCanBindAsDifferentTypesWithSmsc(t *testing.T) {
 	type args struct {
@@ -65,6 +64,7 @@ func TestReactionFromSmscOnFirstPDUForDefaultBehaviour(t *testing.T) {
 	bindTransceiver := NewBindTransceiver().WithSystemId(validSystemID).WithPassword(validPassword)
 	bindTransmitter := NewBindTransmitter().WithSystemId(validSystemID).WithPassword(validPassword)
 	bindWrongUserName := NewBindReceiver().WithSystemId(invalidUserName).WithPassword(validPassword)
+	bindWrongPassword := NewBindReceiver().WithSystemId(validSystemID).WithPassword(invalidUserName)
 	SubmitSMUnbound := NewSubmitSM()
 	type args struct {
 		bind_pdu *PDU
@@ -77,7 +77,8 @@ func TestReactionFromSmscOnFirstPDUForDefaultBehaviour(t *testing.T) {
 		{"TestEsmeCanBindWithSmscAsAReceiver", args{&bindReceiver}, NewBindReceiverResp().WithSystemId(validSystemID)},
 		{"TestEsmeCanBindWithSmscAsATransmitter", args{&bindTransmitter}, NewBindTransmitterResp().WithSystemId(validSystemID)},
 		{"TestEsmeCanBindWithSmscAsATransceiver", args{&bindTransceiver}, NewBindTransceiverResp().WithSystemId(validSystemID)},
-		{"TestSMSCRejectWithWrongUserName", args{&bindWrongUserName}, NewBindReceiverResp().WithSMPPError(ESME_RBINDFAIL).WithSystemId(invalidUserName)},
+		{"TestSMSCRejectWithWrongUserName", args{&bindWrongUserName}, NewBindReceiverResp().WithSMPPError(ESME_RINVSYSID).WithSystemId(invalidUserName)},
+		{"TestSMSCRejectWithWrongPassword", args{&bindWrongPassword}, NewBindReceiverResp().WithSMPPError(ESME_RINVPASWD).WithSystemId(validSystemID)},
 		{"TestSubmitSMOnNonBoundedBindIsReturningInvalidBindStatus", args{&SubmitSMUnbound}, NewSubmitSMResp().WithSMPPError(ESME_RINVBNDSTS).WithMessageId("")},
 	}
 	for _, tt := range tests {
@@ -124,6 +125,16 @@ func TestReactionFromBindedEsmeAsSpecifiedBindState(t *testing.T) {
 			args{NewSubmitSM().WithMessage("Hello"), BOUND_RX},
 			NewSubmitSMResp().WithSMPPError(ESME_RINVBNDSTS).WithMessageId(""),
 		},
+		{
+			"Send SubmitSM with invalid schedule_delivery_time when bind as transmitter return invalid schedule",
+			args{NewSubmitSM().WithDefaults(map[string]interface{}{"schedule_delivery_time": "tomorrow"}), BOUND_TX},
+			NewSubmitSMResp().WithSMPPError(ESME_RINVSCHED).WithMessageId(""),
+		},
+		{
+			"Send SubmitSM with expired validity_period when bind as transmitter return invalid expiry",
+			args{NewSubmitSM().WithValidityPeriod(time.Now().Add(-time.Hour)), BOUND_TX},
+			NewSubmitSMResp().WithSMPPError(ESME_RINVEXPIRY).WithMessageId(""),
+		},
 		{
 			"Send enquiry_link when bind as transmitter should return response",
 			args{NewEnquireLink(), BOUND_TX},
@@ -140,8 +151,8 @@ func TestReactionFromBindedEsmeAsSpecifiedBindState(t *testing.T) {
 			smsc, _, Esme := connectEsmeAndSmscTogether(t)
 			defer CloseAndAssertClean(smsc, Esme, t)
 
-			Esme.state.setState <- tt.args.bind_state
-			smsc.ESMEs.Load().([]*ESME)[0].state.setState <- tt.args.bind_state
+			Esme.state.SetState(tt.args.bind_state)
+			smsc.ESMEs.Load().([]*ESME)[0].state.SetState(tt.args.bind_state)
 			sequence_number, LastError := Esme.Send(&tt.args.send_pdu)
 			if LastError != nil {
 				t.Errorf("Failed to send pdu : %v", LastError)
@@ -164,6 +175,1007 @@ func TestReactionFromBindedEsmeAsSpecifiedBindState(t *testing.T) {
 	}
 }
 
+func TestSmscAnswersOnceToRequestsBeforeBind(t *testing.T) {
+	tests := []struct {
+		request  PDU
+		wantResp string
+	}{
+		{NewCancelSM(), "cancel_sm_resp"},
+		{NewReplaceSM().WithMessage("Hello"), "replace_sm_resp"},
+		{NewDataSM(), "data_sm_resp"},
+		{NewSubmitSM().WithMessage("Hello"), "submit_sm_resp"},
+		{NewQuerySM(), "query_sm_resp"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.request.Header.CommandId, func(t *testing.T) {
+			smsc, _, Esme := connectEsmeAndSmscTogether(t)
+			defer CloseAndAssertClean(smsc, Esme, t)
+
+			if _, err := Esme.Send(&tt.request); err != nil {
+				t.Fatalf("Failed to send pdu : %v", err)
+			}
+			responses := []PDU{}
+			for {
+				resp, err := Esme.receivePduBefore(time.Now().Add(200 * time.Millisecond))
+				if err != nil {
+					break
+				}
+				responses = append(responses, resp)
+			}
+			if len(responses) != 1 || responses[0].Header.CommandId != tt.wantResp || responses[0].Header.CommandStatus != ESME_RINVBNDSTS {
+				t.Errorf("Expected a single %v with %v, got %v", tt.wantResp, ESME_RINVBNDSTS, responses)
+			}
+		})
+	}
+}
+
+func TestSmscSendsDeliveryReceiptAsRequestedByRegisteredDelivery(t *testing.T) {
+	tests := []struct {
+		name               string
+		registeredDelivery int
+		finalState         string
+		wantReceipt        bool
+	}{
+		{"receipt always requested on delivered message", 1, "DELIVERED", true},
+		{"receipt always requested on undeliverable message", 1, "UNDELIVERABLE", true},
+		{"receipt on failure requested on undeliverable message", 2, "UNDELIVERABLE", true},
+		{"receipt on failure requested on delivered message", 2, "DELIVERED", false},
+		{"no receipt requested", 0, "DELIVERED", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			smsc, _, Esme := connectEsmeAndSmscTogether(t)
+			defer CloseAndAssertClean(smsc, Esme, t)
+			smsc.DeliveryReceiptState = tt.finalState
+
+			_, err := Esme.BindTransceiver(validSystemID, validPassword)
+			if err != nil {
+				t.Fatalf("Couldn't bind with the SMSC : %v", err)
+			}
+			submitSm := NewSubmitSM().
+				WithSourceAddress("5551234567").
+				WithDestinationAddress("5557654321").
+				WithMessage("Hello, how are you today ?").
+				WithDefaults(map[string]interface{}{"registered_delivery": tt.registeredDelivery})
+			_, err = Esme.Send(&submitSm)
+			if err != nil {
+				t.Fatalf("Couldn't send submit_sm : %v", err)
+			}
+			submitSmResp, err := Esme.receivePdu()
+			if err != nil || submitSmResp.Header.CommandId != "submit_sm_resp" {
+				t.Fatalf("Didn't receive the submit_sm_resp : %v, %v", submitSmResp, err)
+			}
+
+			receiptPdu, err := Esme.receivePdu()
+			if !tt.wantReceipt {
+				if err == nil {
+					t.Errorf("Didn't expect a delivery receipt : %v", receiptPdu)
+				}
+				return
+			}
+			if err != nil || !IsDeliveryReceipt(receiptPdu) {
+				t.Fatalf("Didn't receive the delivery receipt : %v, %v", receiptPdu, err)
+			}
+			receipt, err := ParseDeliveryReceipt(receiptPdu)
+			if err != nil {
+				t.Errorf("Couldn't parse the delivery receipt : %v", err)
+			}
+			if receipt.MessageId != submitSmResp.Body.MandatoryParameter["message_id"] || receipt.MessageState != tt.finalState || receipt.Text != "Hello, how are you t" {
+				t.Errorf("Delivery receipt isn't matching the submitted message : %+v", receipt)
+			}
+			if receiptPdu.Body.MandatoryParameter["destination_addr"] != "5551234567" || receiptPdu.Body.MandatoryParameter["source_addr"] != "5557654321" {
+				t.Errorf("Delivery receipt addresses aren't reversed : %v", receiptPdu)
+			}
+		})
+	}
+}
+
+func TestSmscSendsDeliveryReceiptToReceiverOfSameSystemId(t *testing.T) {
+	smsc, _, transmitter := connectEsmeAndSmscTogether(t)
+	defer CloseAndAssertClean(smsc, transmitter, t)
+	smsc.DeliveryReceiptDelay = 10 * time.Millisecond
+	receiver, err := InstantiateEsme(smsc.listeningSocket.Addr(), connType)
+	if err != nil {
+		t.Fatalf("couldn't connect client to server successfully: %v", err)
+	}
+	defer receiver.Close()
+	WaitForConnectionToBeEstablishedFromSmscSide(smsc, 2)
+
+	if _, err = transmitter.BindTransmitter(validSystemID, validPassword); err != nil {
+		t.Fatalf("Couldn't bind the transmitter : %v", err)
+	}
+	if _, err = receiver.BindReceiver(validSystemID, validPassword); err != nil {
+		t.Fatalf("Couldn't bind the receiver : %v", err)
+	}
+	submitSm := NewSubmitSM().WithMessage("Hello").WithDefaults(map[string]interface{}{"registered_delivery": 1})
+	if _, err = transmitter.Send(&submitSm); err != nil {
+		t.Fatalf("Couldn't send submit_sm : %v", err)
+	}
+
+	receiptPdu, err := receiver.receivePdu()
+	if err != nil || !IsDeliveryReceipt(receiptPdu) {
+		t.Errorf("Receiver didn't get the delivery receipt : %v, %v", receiptPdu, err)
+	}
+}
+
+func TestSmscReportsAnUnknownDeliveryReceiptStateAsUnknown(t *testing.T) {
+	smsc, _, Esme := connectEsmeAndSmscTogether(t)
+	defer CloseAndAssertClean(smsc, Esme, t)
+	smsc.DeliveryReceiptState = "delivered"
+	smsc.DeliveryReceiptDelay = 10 * time.Millisecond
+	smsc.MessageStore.Store(StoredMessage{MessageId: "corrupted", SystemId: validSystemID, State: "delivered"})
+
+	if _, err := Esme.BindTransmitter(validSystemID, validPassword); err != nil {
+		t.Fatalf("Couldn't bind with the SMSC : %v", err)
+	}
+	queryResp, err := Esme.QuerySM("corrupted", Address{})
+	if queryResp == nil || queryResp.Header.CommandStatus != ESME_RSYSERR {
+		t.Errorf("Query of a message in an unknown state = %v, %v", queryResp, err)
+	}
+	submitSmResp, err := Esme.sendAndWaitForResponse(NewSubmitSM().WithMessage("Hello"))
+	if err != nil {
+		t.Fatalf("Couldn't submit : %v", err)
+	}
+	messageId := submitSmResp.Body.MandatoryParameter["message_id"].(string)
+	message, _ := smsc.MessageStore.Get(messageId)
+	for i := 0; i < 100 && message.State == "ENROUTE"; i++ {
+		time.Sleep(10 * time.Millisecond)
+		message, _ = smsc.MessageStore.Get(messageId)
+	}
+	queryResp, err = Esme.QuerySM(messageId, Address{})
+	if err != nil || queryResp.Body.MandatoryParameter["message_state"] != 7 {
+		t.Errorf("Query of a message finalized with an unknown state = %v, %v", queryResp, err)
+	}
+}
+
+func TestSmscStoresEachSubmittedMessageUnderAUniqueId(t *testing.T) {
+	smsc, _, Esme := connectEsmeAndSmscTogether(t)
+	defer CloseAndAssertClean(smsc, Esme, t)
+	smsc.MessageIdGenerator = NewHexMessageIdGenerator()
+
+	_, err := Esme.BindTransmitter(validSystemID, validPassword)
+	if err != nil {
+		t.Fatalf("Couldn't bind with the SMSC : %v", err)
+	}
+	messageIds := map[string]bool{}
+	for i := 0; i < 3; i++ {
+		submitSm := NewSubmitSM().
+			WithSourceAddress("5551234567").
+			WithDestinationAddress("5557654321").
+			WithMessage("Hello")
+		sequenceNumber, err := Esme.Send(&submitSm)
+		if err != nil {
+			t.Fatalf("Couldn't send submit_sm : %v", err)
+		}
+		submitSmResp, err := Esme.receivePdu()
+		if err != nil || submitSmResp.Header.CommandStatus != ESME_ROK {
+			t.Fatalf("Didn't receive a successful submit_sm_resp : %v, %v", submitSmResp, err)
+		}
+		if submitSmResp.Header.SequenceNumber != sequenceNumber {
+			t.Errorf("submit_sm_resp sequence number = %v, want %v", submitSmResp.Header.SequenceNumber, sequenceNumber)
+		}
+		messageId := submitSmResp.Body.MandatoryParameter["message_id"].(string)
+		if messageIds[messageId] {
+			t.Errorf("Message id %v was given twice", messageId)
+		}
+		messageIds[messageId] = true
+
+		message, err := smsc.MessageStore.Get(messageId)
+		if err != nil {
+			t.Fatalf("Message %v wasn't stored : %v", messageId, err)
+		}
+		if message.SystemId != validSystemID || message.Destination.Addr != "5557654321" || message.SubmitDate.IsZero() {
+			t.Errorf("Message wasn't stored as submitted : %+v", message)
+		}
+	}
+
+	for id := range messageIds {
+		message, _ := smsc.MessageStore.Get(id)
+		for i := 0; i < 100 && message.State == "ENROUTE"; i++ {
+			time.Sleep(10 * time.Millisecond)
+			message, _ = smsc.MessageStore.Get(id)
+		}
+		if message.State != "DELIVERED" || message.DoneDate.IsZero() {
+			t.Errorf("Message didn't reach its final state : %+v", message)
+		}
+	}
+}
+
+func TestSmscAnswersQueryCancelAndReplaceFromItsMessageStore(t *testing.T) {
+	smsc, _, Esme := connectEsmeAndSmscTogether(t)
+	defer CloseAndAssertClean(smsc, Esme, t)
+	smsc.DeliveryReceiptDelay = time.Hour
+
+	_, err := Esme.BindTransmitter(validSystemID, validPassword)
+	if err != nil {
+		t.Fatalf("Couldn't bind with the SMSC : %v", err)
+	}
+	source := Address{Ton: 1, Npi: 1, Addr: "15551234567"}
+	destination := Address{Ton: 1, Npi: 1, Addr: "15557654321"}
+	submitSm := NewSubmitSM().WithSource(source).WithDestination(destination).WithMessage("Hello")
+	submitSmResp, err := Esme.sendAndWaitForResponse(submitSm)
+	if err != nil {
+		t.Fatalf("Couldn't submit : %v", err)
+	}
+	messageId := submitSmResp.Body.MandatoryParameter["message_id"].(string)
+
+	queryResp, err := Esme.QuerySM(messageId, source)
+	if err != nil || queryResp.Body.MandatoryParameter["message_state"] != 1 || queryResp.Body.MandatoryParameter["final_date"] != "" {
+		t.Errorf("Pending message query = %v, %v", queryResp, err)
+	}
+	if _, err = Esme.ReplaceSM(messageId, source, "Hello again"); err != nil {
+		t.Errorf("Couldn't replace pending message : %v", err)
+	}
+	if message, _ := smsc.MessageStore.Get(messageId); message.Pdu.Body.MandatoryParameter["short_message"] != "Hello again" {
+		t.Errorf("Message wasn't replaced : %v", message.Pdu)
+	}
+	if _, err = Esme.CancelSM(messageId, source, destination); err != nil {
+		t.Errorf("Couldn't cancel pending message : %v", err)
+	}
+	queryResp, err = Esme.QuerySM(messageId, source)
+	if err != nil || queryResp.Body.MandatoryParameter["message_state"] != 4 || queryResp.Body.MandatoryParameter["final_date"] == "" {
+		t.Errorf("Cancelled message query = %v, %v", queryResp, err)
+	}
+
+	tests := []struct {
+		name       string
+		request    func() (*PDU, error)
+		wantStatus string
+	}{
+		{"cancel already cancelled message", func() (*PDU, error) { return Esme.CancelSM(messageId, source, destination) }, ESME_RCANCELFAIL},
+		{"replace already cancelled message", func() (*PDU, error) { return Esme.ReplaceSM(messageId, source, "Too late") }, ESME_RREPLACEFAIL},
+		{"query unknown message", func() (*PDU, error) { return Esme.QuerySM("unknown", source) }, ESME_RQUERYFAIL},
+		{"query from another source", func() (*PDU, error) { return Esme.QuerySM(messageId, destination) }, ESME_RQUERYFAIL},
+		{"cancel without pending message", func() (*PDU, error) { return Esme.CancelSM("", source, destination) }, ESME_RCANCELFAIL},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := tt.request()
+			if err == nil || resp == nil || resp.Header.CommandStatus != tt.wantStatus {
+				t.Errorf("Expected %v, got %v, %v", tt.wantStatus, resp, err)
+			}
+		})
+	}
+}
+
+func TestEsmeQueriesWhileItsControlLoopAnswersDeliveries(t *testing.T) {
+	smsc, _, Esme := connectEsmeAndSmscTogether(t)
+	defer CloseAndAssertClean(smsc, Esme, t)
+	smsc.DeliveryReceiptDelay = time.Hour
+
+	if _, err := Esme.BindTransceiver(validSystemID, validPassword); err != nil {
+		t.Fatalf("Couldn't bind with the SMSC : %v", err)
+	}
+	delivered := make(chan PDU, 10)
+	Esme.CommandFunctions["deliver_sm"] = func(e *ESME, pdu PDU) error {
+		delivered <- pdu
+		resp := NewDeliverSMResp().WithSequenceNumber(pdu.Header.SequenceNumber)
+		_, err := e.Send(&resp)
+		return err
+	}
+	Esme.StartControlLoop()
+	source := Address{Ton: 1, Npi: 1, Addr: "15551234567"}
+	submitSmResp, err := Esme.sendAndWaitForResponse(NewSubmitSM().WithSource(source).WithMessage("Hello"))
+	if err != nil {
+		t.Fatalf("Couldn't submit : %v", err)
+	}
+	messageId := submitSmResp.Body.MandatoryParameter["message_id"].(string)
+
+	session := smsc.Sessions()[0]
+	for i := 0; i < 5; i++ {
+		deliverSm := NewDeliverSM().WithMessage("Hello")
+		if _, err = session.Send(&deliverSm); err != nil {
+			t.Fatalf("Couldn't send the deliver_sm : %v", err)
+		}
+		if queryResp, err := Esme.QuerySM(messageId, source); err != nil {
+			t.Fatalf("Query while a deliver_sm is in flight = %v, %v", queryResp, err)
+		}
+		select {
+		case <-delivered:
+		case <-time.After(time.Second):
+			t.Fatalf("The control loop didn't get the deliver_sm")
+		}
+	}
+}
+
+func TestSmscRoutesSubmittedMessagesToBoundReceivers(t *testing.T) {
+	tests := []struct {
+		name         string
+		routes       []Route
+		addressRange string
+	}{
+		{"routed by destination prefix", []Route{{DestinationPrefix: "1555", SystemId: "Receiver"}}, ""},
+		{"routed by source system_id", []Route{{SourceSystemId: validSystemID, SystemId: "Receiver"}}, ""},
+		{"routed by address_range of the bind", nil, "^1555[0-9]+$"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			smsc, _, sender := connectEsmeAndSmscTogether(t)
+			defer CloseAndAssertClean(smsc, sender, t)
+			smsc.Authenticator.(*AccountTable).AddAccount(Account{SystemId: "Receiver", Password: "Secret"})
+			smsc.RoutingTable, _ = NewRoutingTable(tt.routes...)
+			receiver, err := InstantiateEsme(smsc.listeningSocket.Addr(), connType)
+			if err != nil {
+				t.Fatalf("Couldn't connect the receiver : %v", err)
+			}
+			defer receiver.Close()
+			WaitForConnectionToBeEstablishedFromSmscSide(smsc, 2)
+
+			if _, err = sender.BindTransceiver(validSystemID, validPassword); err != nil {
+				t.Fatalf("Couldn't bind the sender : %v", err)
+			}
+			bindReceiver := NewBindReceiver().WithSystemId("Receiver").WithPassword("Secret").WithAddressRange(tt.addressRange)
+			if _, err = receiver.bindWithSmsc(bindReceiver); err != nil {
+				t.Fatalf("Couldn't bind the receiver : %v", err)
+			}
+
+			submitSm := NewSubmitSM().
+				WithSourceAddress("15557654321").
+				WithDestinationAddress("15551234567").
+				WithMessage("Hello over there").
+				WithDefaults(map[string]interface{}{"registered_delivery": 1})
+			submitSmResp, err := sender.sendAndWaitForResponse(submitSm)
+			if err != nil {
+				t.Fatalf("Couldn't submit : %v", err)
+			}
+			deliverSm, err := receiver.receivePdu()
+			if err != nil || deliverSm.Header.CommandId != "deliver_sm" {
+				t.Fatalf("Receiver didn't get the deliver_sm : %v, %v", deliverSm, err)
+			}
+			if deliverSm.Body.MandatoryParameter["short_message"] != "Hello over there" ||
+				deliverSm.Body.MandatoryParameter["destination_addr"] != "15551234567" ||
+				deliverSm.Body.MandatoryParameter["registered_delivery"] != 0 {
+				t.Errorf("deliver_sm doesn't carry the submitted message : %v", deliverSm)
+			}
+			deliverSmResp := NewDeliverSMResp().WithMessageId("").WithSequenceNumber(deliverSm.Header.SequenceNumber)
+			if _, err = receiver.Send(&deliverSmResp); err != nil {
+				t.Fatalf("Couldn't answer the deliver_sm : %v", err)
+			}
+
+			receiptPdu, err := sender.receivePdu()
+			if err != nil || !IsDeliveryReceipt(receiptPdu) {
+				t.Fatalf("Sender didn't get the delivery receipt : %v, %v", receiptPdu, err)
+			}
+			receipt, err := ParseDeliveryReceipt(receiptPdu)
+			if err != nil || receipt.MessageId != submitSmResp.Body.MandatoryParameter["message_id"] || receipt.MessageState != "DELIVERED" {
+				t.Errorf("Unexpected delivery receipt : %+v, %v", receipt, err)
+			}
+		})
+	}
+}
+
+func TestSmscDeliversRoutedMessagesOnceTheirReceiverBinds(t *testing.T) {
+	smsc, _, sender := connectEsmeAndSmscTogether(t)
+	defer CloseAndAssertClean(smsc, sender, t)
+	smsc.Authenticator.(*AccountTable).AddAccount(Account{SystemId: "Receiver", Password: "Secret"})
+	smsc.RoutingTable, _ = NewRoutingTable(Route{SystemId: "Receiver"})
+	smsc.DeliveryRetryDelay = time.Hour
+	if _, err := sender.BindTransmitter(validSystemID, validPassword); err != nil {
+		t.Fatalf("Couldn't bind the sender : %v", err)
+	}
+	submitSmResp, err := sender.sendAndWaitForResponse(NewSubmitSM().WithDestinationAddress("15551234567").WithMessage("Hello"))
+	if err != nil {
+		t.Fatalf("Couldn't submit : %v", err)
+	}
+	messageId := submitSmResp.Body.MandatoryParameter["message_id"].(string)
+
+	receiver := connectReceiver(t, smsc)
+	deliverSm, err := receiver.receivePdu()
+	if err != nil || deliverSm.Header.CommandId != "deliver_sm" {
+		t.Fatalf("Receiver bound after the submit didn't get the deliver_sm : %v, %v", deliverSm, err)
+	}
+	acknowledgeAndWaitForDelivery(t, smsc, receiver, deliverSm, messageId)
+}
+
+func TestSmscRedeliversMessagesNotAcknowledgedByADisconnectedReceiver(t *testing.T) {
+	smsc, _, sender := connectEsmeAndSmscTogether(t)
+	defer CloseAndAssertClean(smsc, sender, t)
+	smsc.Authenticator.(*AccountTable).AddAccount(Account{SystemId: "Receiver", Password: "Secret"})
+	smsc.RoutingTable, _ = NewRoutingTable(Route{SystemId: "Receiver"})
+	smsc.DeliveryRetryDelay = time.Hour
+	if _, err := sender.BindTransmitter(validSystemID, validPassword); err != nil {
+		t.Fatalf("Couldn't bind the sender : %v", err)
+	}
+	firstReceiver := connectReceiver(t, smsc)
+	submitSmResp, err := sender.sendAndWaitForResponse(NewSubmitSM().WithDestinationAddress("15551234567").WithMessage("Hello"))
+	if err != nil {
+		t.Fatalf("Couldn't submit : %v", err)
+	}
+	messageId := submitSmResp.Body.MandatoryParameter["message_id"].(string)
+	if deliverSm, err := firstReceiver.receivePdu(); err != nil || deliverSm.Header.CommandId != "deliver_sm" {
+		t.Fatalf("First receiver didn't get the deliver_sm : %v, %v", deliverSm, err)
+	}
+	firstReceiver.Close()
+
+	secondReceiver := connectReceiver(t, smsc)
+	deliverSm, err := secondReceiver.receivePdu()
+	if err != nil || deliverSm.Header.CommandId != "deliver_sm" {
+		t.Fatalf("Message wasn't delivered again to the second receiver : %v, %v", deliverSm, err)
+	}
+	acknowledgeAndWaitForDelivery(t, smsc, secondReceiver, deliverSm, messageId)
+}
+
+func connectReceiver(t *testing.T, smsc *SMSC) *ESME {
+	receiver, err := InstantiateEsme(smsc.listeningSocket.Addr(), connType)
+	if err != nil {
+		t.Fatalf("Couldn't connect the receiver : %v", err)
+	}
+	t.Cleanup(receiver.Close)
+	if _, err = receiver.BindReceiver("Receiver", "Secret"); err != nil {
+		t.Fatalf("Couldn't bind the receiver : %v", err)
+	}
+	return receiver
+}
+
+func acknowledgeAndWaitForDelivery(t *testing.T, smsc *SMSC, receiver *ESME, deliverSm PDU, messageId string) {
+	deliverSmResp := NewDeliverSMResp().WithMessageId("").WithSequenceNumber(deliverSm.Header.SequenceNumber)
+	if _, err := receiver.Send(&deliverSmResp); err != nil {
+		t.Fatalf("Couldn't answer the deliver_sm : %v", err)
+	}
+	message, _ := smsc.MessageStore.Get(messageId)
+	for i := 0; i < 100 && message.State == "ENROUTE"; i++ {
+		time.Sleep(10 * time.Millisecond)
+		message, _ = smsc.MessageStore.Get(messageId)
+	}
+	if message.State != "DELIVERED" {
+		t.Errorf("Message should be DELIVERED once acknowledged : %+v", message)
+	}
+}
+
+func TestSmscHoldsScheduledMessagesAndExpiresThemWithItsClock(t *testing.T) {
+	tests := []struct {
+		name         string
+		submitSm     func(now time.Time) PDU
+		routes       []Route
+		untilPending time.Duration
+		untilFinal   time.Duration
+		wantState    string
+	}{
+		{
+			"scheduled message is held until due",
+			func(now time.Time) PDU { return NewSubmitSM().WithScheduleDeliveryTime(now.Add(time.Hour)) },
+			nil,
+			59 * time.Minute,
+			2 * time.Minute,
+			"DELIVERED",
+		},
+		{
+			"undelivered message expires at the end of its validity period",
+			func(now time.Time) PDU { return NewSubmitSM().WithRelativeValidityPeriod(time.Hour) },
+			[]Route{{SystemId: "Receiver"}},
+			59 * time.Minute,
+			time.Minute,
+			"EXPIRED",
+		},
+		{
+			"scheduled message expiring before its delivery",
+			func(now time.Time) PDU {
+				return NewSubmitSM().WithScheduleDeliveryTime(now.Add(time.Hour)).WithValidityPeriod(now.Add(time.Hour + time.Second))
+			},
+			[]Route{{SystemId: "Receiver"}},
+			time.Hour,
+			time.Second,
+			"EXPIRED",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			smsc, _, Esme := connectEsmeAndSmscTogether(t)
+			defer CloseAndAssertClean(smsc, Esme, t)
+			clock := NewFakeClock(time.Now().Truncate(time.Second))
+			smsc.Clock = clock
+			smsc.DeliveryReceiptDelay = time.Minute
+			smsc.RoutingTable, _ = NewRoutingTable(tt.routes...)
+
+			if _, err := Esme.BindTransceiver(validSystemID, validPassword); err != nil {
+				t.Fatalf("Couldn't bind with the SMSC : %v", err)
+			}
+			submitSm := tt.submitSm(clock.Now()).
+				WithDestinationAddress("15551234567").
+				WithMessage("Hello later").
+				WithDefaults(map[string]interface{}{"registered_delivery": 1})
+			submitSmResp, err := Esme.sendAndWaitForResponse(submitSm)
+			if err != nil {
+				t.Fatalf("Couldn't submit : %v", err)
+			}
+			messageId := submitSmResp.Body.MandatoryParameter["message_id"].(string)
+
+			clock.Advance(tt.untilPending)
+			if message, _ := smsc.MessageStore.Get(messageId); message.State != "ENROUTE" {
+				t.Errorf("Message should still be pending : %+v", message)
+			}
+			clock.Advance(tt.untilFinal)
+			message, _ := smsc.MessageStore.Get(messageId)
+			if message.State != tt.wantState || !message.DoneDate.Equal(clock.Now()) {
+				t.Errorf("Message should be %v at %v : %+v", tt.wantState, clock.Now(), message)
+			}
+			receiptPdu, err := Esme.receivePdu()
+			if err != nil || !IsDeliveryReceipt(receiptPdu) {
+				t.Fatalf("Didn't receive the delivery receipt : %v, %v", receiptPdu, err)
+			}
+			if receipt, _ := ParseDeliveryReceipt(receiptPdu); receipt.MessageState != tt.wantState {
+				t.Errorf("Delivery receipt state = %v, want %v", receipt.MessageState, tt.wantState)
+			}
+		})
+	}
+}
+
+func TestSmscRefusesASecondBindOnABoundSession(t *testing.T) {
+	smsc, _, Esme := connectEsmeAndSmscTogether(t)
+	defer CloseAndAssertClean(smsc, Esme, t)
+
+	if _, err := Esme.BindTransmitter(validSystemID, validPassword); err != nil {
+		t.Fatalf("Couldn't bind with the SMSC : %v", err)
+	}
+	resp, err := Esme.BindReceiver(validSystemID, validPassword)
+	if err == nil || resp.Header.CommandStatus != ESME_RALYBND {
+		t.Errorf("Second bind should be refused with %v : %v, %v", ESME_RALYBND, resp, err)
+	}
+	if state := smsc.ESMEs.Load().([]*ESME)[0].GetEsmeState(); state != BOUND_TX {
+		t.Errorf("Session state changed to %v on a refused bind", state)
+	}
+}
+
+func TestSmscLimitsConcurrentBindsOfAnAccountByType(t *testing.T) {
+	smsc, _, first := connectEsmeAndSmscTogether(t)
+	defer CloseAndAssertClean(smsc, first, t)
+	smsc.Authenticator.(*AccountTable).AddAccount(Account{
+		SystemId: validSystemID,
+		Password: validPassword,
+		MaxBinds: map[string]int{"bind_transmitter": 1},
+	})
+	second, err := InstantiateEsme(smsc.listeningSocket.Addr(), connType)
+	if err != nil {
+		t.Fatalf("Couldn't connect the second session : %v", err)
+	}
+	defer second.Close()
+	WaitForConnectionToBeEstablishedFromSmscSide(smsc, 2)
+
+	if _, err = first.BindTransmitter(validSystemID, validPassword); err != nil {
+		t.Fatalf("First transmitter should be bound : %v", err)
+	}
+	resp, err := second.BindTransmitter(validSystemID, validPassword)
+	if err == nil || resp.Header.CommandStatus != ESME_RBINDFAIL {
+		t.Errorf("Transmitter over the limit should be refused with %v : %v, %v", ESME_RBINDFAIL, resp, err)
+	}
+	if _, err = second.BindReceiver(validSystemID, validPassword); err != nil {
+		t.Errorf("Receivers aren't limited and should be bound : %v", err)
+	}
+}
+
+func TestSmscBindsOtherSessionsWhileOnBindRuns(t *testing.T) {
+	smsc, _, first := connectEsmeAndSmscTogether(t)
+	defer CloseAndAssertClean(smsc, first, t)
+	smsc.Authenticator.(*AccountTable).AddAccount(Account{
+		SystemId: validSystemID,
+		Password: validPassword,
+		MaxBinds: map[string]int{"bind_transmitter": 1},
+	})
+	entered, release := make(chan struct{}), make(chan struct{})
+	var calls atomic.Int32
+	smsc.OnBind = func(*Session, PDU) error {
+		if calls.Add(1) == 1 {
+			close(entered)
+			<-release
+		}
+		return nil
+	}
+	second, err := InstantiateEsme(smsc.listeningSocket.Addr(), connType)
+	if err != nil {
+		t.Fatalf("Couldn't connect the second session : %v", err)
+	}
+	defer second.Close()
+	WaitForConnectionToBeEstablishedFromSmscSide(smsc, 2)
+
+	firstBound := make(chan error, 1)
+	go func() {
+		_, err := first.BindTransmitter(validSystemID, validPassword)
+		firstBound <- err
+	}()
+	<-entered
+	resp, err := second.BindTransmitter(validSystemID, validPassword)
+	if err == nil || resp.Header.CommandStatus != ESME_RBINDFAIL {
+		t.Errorf("Transmitter over the limit should be refused with %v while the first one is authorized : %v, %v", ESME_RBINDFAIL, resp, err)
+	}
+	if _, err = second.BindReceiver(validSystemID, validPassword); err != nil {
+		t.Errorf("Receiver should be bound while OnBind runs for another session : %v", err)
+	}
+	close(release)
+	if err = <-firstBound; err != nil {
+		t.Errorf("First transmitter should be bound : %v", err)
+	}
+}
+
+func TestSmscClosesConnectionsOverItsLimit(t *testing.T) {
+	smsc, err := GetSmscSimulatorServer()
+	if err != nil {
+		t.Fatalf("couldn't start server successfully: %v", err)
+	}
+	smsc.MaxConnections = 1
+	smsc.Start()
+	first, err := InstantiateEsme(smsc.listeningSocket.Addr(), connType)
+	if err != nil {
+		t.Fatalf("Couldn't connect the first session : %v", err)
+	}
+	defer CloseAndAssertClean(smsc, first, t)
+	WaitForConnectionToBeEstablishedFromSmscSide(smsc, 1)
+
+	second, err := InstantiateEsme(smsc.listeningSocket.Addr(), connType)
+	if err != nil {
+		t.Fatalf("Couldn't connect the second session : %v", err)
+	}
+	defer second.Close()
+	_, err = readPduBytesFromConnection(second.clientSocket, time.Now().Add(time.Second))
+	if !errors.Is(err, io.EOF) {
+		t.Errorf("Connection over the limit should be closed by the SMSC : %v", err)
+	}
+	if smsc.GetNumberOfConnection() != 1 {
+		t.Errorf("SMSC should have kept a single connection, has %v", smsc.GetNumberOfConnection())
+	}
+}
+
+func TestSmscCountsConnectionsBeingOpenedOnEveryListener(t *testing.T) {
+	smsc, err := GetSmscSimulatorServer()
+	if err != nil {
+		t.Fatalf("couldn't start server successfully: %v", err)
+	}
+	other, err := net.Listen(connType, connhost+":"+connport)
+	if err != nil {
+		t.Fatalf("Couldn't listen : %v", err)
+	}
+	smsc.AddListener(other)
+	smsc.MaxConnections = 1
+	connecting, release := make(chan struct{}), make(chan struct{})
+	var calls atomic.Int32
+	smsc.OnConnect = func(*Session) error {
+		if calls.Add(1) == 1 {
+			close(connecting)
+			<-release
+		}
+		return nil
+	}
+	smsc.Start()
+	first, err := InstantiateEsme(smsc.listeningSocket.Addr(), connType)
+	if err != nil {
+		t.Fatalf("Couldn't connect the first session : %v", err)
+	}
+	defer CloseAndAssertClean(smsc, first, t)
+	<-connecting
+
+	second, err := InstantiateEsme(other.Addr(), connType)
+	if err != nil {
+		t.Fatalf("Couldn't connect the second session : %v", err)
+	}
+	defer second.Close()
+	_, err = readPduBytesFromConnection(second.clientSocket, time.Now().Add(time.Second))
+	close(release)
+	if !errors.Is(err, io.EOF) {
+		t.Errorf("Connection over the limit should be closed while the first one is being opened : %v", err)
+	}
+	WaitForConnectionToBeEstablishedFromSmscSide(smsc, 1)
+	if smsc.GetNumberOfConnection() != 1 {
+		t.Errorf("SMSC should have kept a single connection, has %v", smsc.GetNumberOfConnection())
+	}
+}
+
+func TestSmscCallsItsHooksAlongTheSessions(t *testing.T) {
+	smsc, err := GetSmscSimulatorServer()
+	if err != nil {
+		t.Fatalf("couldn't start server successfully: %v", err)
+	}
+	events := make(chan string, 10)
+	smsc.OnConnect = func(*Session) error { events <- "connect"; return nil }
+	smsc.OnBind = func(_ *Session, pdu PDU) error { events <- pdu.Header.CommandId; return nil }
+	smsc.OnSubmit = func(*Session, PDU) error { events <- "submit_sm"; return nil }
+	smsc.OnDataSM = func(*Session, PDU) error { events <- "data_sm"; return nil }
+	smsc.OnUnbind = func(*Session) { events <- "unbind" }
+	smsc.OnDisconnect = func(*Session) { events <- "disconnect" }
+	smsc.Start()
+	defer smsc.Close()
+	Esme, err := InstantiateEsme(smsc.listeningSocket.Addr(), connType)
+	if err != nil {
+		t.Fatalf("couldn't connect client to server successfully: %v", err)
+	}
+	WaitForConnectionToBeEstablishedFromSmscSide(smsc, 1)
+
+	if _, err = Esme.BindTransceiver(validSystemID, validPassword); err != nil {
+		t.Fatalf("Couldn't bind with the SMSC : %v", err)
+	}
+	if _, err = Esme.sendAndWaitForResponse(NewSubmitSM().WithDestinationAddress("5551234").WithMessage("Hello")); err != nil {
+		t.Fatalf("Couldn't submit : %v", err)
+	}
+	if _, err = Esme.sendAndWaitForResponse(NewDataSM().WithDestinationAddress("5551234")); err != nil {
+		t.Fatalf("Couldn't send data_sm : %v", err)
+	}
+	session := smsc.Sessions()[0]
+	if session.SystemId() != validSystemID || session.BindType() != "bind_transceiver" || session.BoundAt().IsZero() {
+		t.Errorf("Session bound as %v with %v at %v, want %v with bind_transceiver", session.SystemId(), session.BindType(), session.BoundAt(), validSystemID)
+	}
+	if counters := session.Counters(); counters.PdusReceived != 3 || counters.MessagesSubmitted != 2 {
+		t.Errorf("Session counters = %+v, want 3 PDUs received and 2 messages submitted", counters)
+	}
+	if _, err = Esme.Unbind(); err != nil {
+		t.Fatalf("Couldn't unbind : %v", err)
+	}
+	Esme.Close()
+
+	want := []string{"connect", "bind_transceiver", "submit_sm", "data_sm", "unbind", "disconnect"}
+	for _, wantEvent := range want {
+		select {
+		case event := <-events:
+			if event != wantEvent {
+				t.Errorf("Hook called for %v, want %v", event, wantEvent)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Hook for %v wasn't called", wantEvent)
+		}
+	}
+}
+
+func TestSmscHooksRefuseWithTheStatusOfTheirError(t *testing.T) {
+	smsc, err := GetSmscSimulatorServer()
+	if err != nil {
+		t.Fatalf("couldn't start server successfully: %v", err)
+	}
+	smsc.OnBind = func(session *Session, pdu PDU) error {
+		if pdu.Header.CommandId == "bind_receiver" {
+			return StatusError{Status: ESME_RINVSYSTYP, Err: errors.New("no receivers")}
+		}
+		return nil
+	}
+	smsc.OnSubmit = func(*Session, PDU) error { return errors.New("no more credit") }
+	smsc.Start()
+	Esme, err := InstantiateEsme(smsc.listeningSocket.Addr(), connType)
+	if err != nil {
+		t.Fatalf("couldn't connect client to server successfully: %v", err)
+	}
+	defer CloseAndAssertClean(smsc, Esme, t)
+
+	resp, _ := Esme.BindReceiver(validSystemID, validPassword)
+	if resp == nil || resp.Header.CommandStatus != ESME_RINVSYSTYP {
+		t.Errorf("bind_receiver should be refused with %v : %v", ESME_RINVSYSTYP, resp)
+	}
+	if _, err = Esme.BindTransmitter(validSystemID, validPassword); err != nil {
+		t.Fatalf("Couldn't bind with the SMSC : %v", err)
+	}
+	resp, _ = Esme.sendAndWaitForResponse(NewSubmitSM().WithDestinationAddress("5551234").WithMessage("Hello"))
+	if resp == nil || resp.Header.CommandStatus != ESME_RSUBMITFAIL {
+		t.Errorf("submit_sm should be refused with %v : %v", ESME_RSUBMITFAIL, resp)
+	}
+}
+
+func TestOutbindFromSmscLeadsToBindReceiverFromEsme(t *testing.T) {
+	tests := []struct {
+		name            string
+		outbindPassword string
+		wantBound       bool
+	}{
+		{"valid outbind credentials", "secret", true},
+		{"invalid outbind credentials", "wrong", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			smsc, err := GetSmscSimulatorServer()
+			if err != nil {
+				t.Fatalf("couldn't start server successfully: %v", err)
+			}
+			defer smsc.Close()
+			listener, err := net.Listen(connType, connhost+":"+connport)
+			if err != nil {
+				t.Fatalf("Couldn't listen for outbinds : %v", err)
+			}
+			defer listener.Close()
+			type accepted struct {
+				esme *ESME
+				err  error
+			}
+			acceptedChan := make(chan accepted)
+			go func() {
+				esme, err := AcceptOutbind(listener, time.Second, "SMSC", "secret", validSystemID, validPassword)
+				acceptedChan <- accepted{esme, err}
+			}()
+
+			smscSide, err := smsc.Outbind(listener.Addr(), connType, "SMSC", tt.outbindPassword)
+			if err != nil {
+				t.Fatalf("Couldn't outbind : %v", err)
+			}
+			result := <-acceptedChan
+			if !tt.wantBound {
+				if result.err == nil {
+					result.esme.Close()
+					t.Errorf("Outbind with invalid credentials should be refused")
+				}
+				return
+			}
+			if result.err != nil {
+				t.Fatalf("Outbind wasn't accepted : %v", result.err)
+			}
+			defer result.esme.Close()
+			if state := result.esme.GetEsmeState(); state != BOUND_RX {
+				t.Errorf("ESME state = %v, want %v", state, BOUND_RX)
+			}
+			if state := smscSide.GetEsmeState(); state != BOUND_RX || smscSide.SystemId() != validSystemID {
+				t.Errorf("SMSC session state = %v as %v, want %v as %v", state, smscSide.SystemId(), BOUND_RX, validSystemID)
+			}
+		})
+	}
+}
+
+func TestAcceptOutbindWaitsForTheOutbindUntilTheTimeout(t *testing.T) {
+	listener, err := net.Listen(connType, connhost+":"+connport)
+	if err != nil {
+		t.Fatalf("Couldn't listen for outbinds : %v", err)
+	}
+	defer listener.Close()
+	type accepted struct {
+		esme *ESME
+		err  error
+	}
+	acceptedChan := make(chan accepted)
+	accept := func(timeout time.Duration) {
+		esme, err := AcceptOutbind(listener, timeout, "SMSC", "secret", validSystemID, validPassword)
+		acceptedChan <- accepted{esme, err}
+	}
+
+	go accept(50 * time.Millisecond)
+	silent, err := net.Dial(connType, listener.Addr().String())
+	if err != nil {
+		t.Fatalf("Couldn't connect : %v", err)
+	}
+	defer silent.Close()
+	if result := <-acceptedChan; result.err == nil {
+		result.esme.Close()
+		t.Errorf("Accepted an outbind which never came")
+	}
+
+	go accept(0)
+	slow, err := net.Dial(connType, listener.Addr().String())
+	if err != nil {
+		t.Fatalf("Couldn't connect : %v", err)
+	}
+	defer slow.Close()
+	time.Sleep(1200 * time.Millisecond)
+	outbind, _ := EncodePdu(NewOutbind().WithSystemId("SMSC").WithPassword("secret").WithSequenceNumber(1))
+	if _, err = slow.Write(outbind); err != nil {
+		t.Fatalf("Couldn't send the outbind : %v", err)
+	}
+	bindBytes, err := readPduBytesFromConnection(slow, time.Now().Add(time.Second))
+	if err != nil {
+		t.Fatalf("Didn't receive the bind_receiver : %v", err)
+	}
+	bind, _ := ParsePdu(bindBytes)
+	bindResp, _ := EncodePdu(NewBindReceiverResp().WithSystemId("SMSC").WithSequenceNumber(bind.Header.SequenceNumber))
+	if _, err = slow.Write(bindResp); err != nil {
+		t.Fatalf("Couldn't answer the bind_receiver : %v", err)
+	}
+	result := <-acceptedChan
+	if result.err != nil {
+		t.Fatalf("Outbind sent after a second wasn't accepted : %v", result.err)
+	}
+	defer result.esme.Close()
+	if state := result.esme.GetEsmeState(); state != BOUND_RX {
+		t.Errorf("ESME state = %v, want %v", state, BOUND_RX)
+	}
+}
+
+func TestEsmeCanUnbindFromSmsc(t *testing.T) {
+	smsc, _, Esme := connectEsmeAndSmscTogether(t)
+	defer CloseAndAssertClean(smsc, Esme, t)
+
+	if _, err := Esme.BindTransceiver(validSystemID, validPassword); err != nil {
+		t.Fatalf("Couldn't bind with the SMSC : %v", err)
+	}
+	if _, err := Esme.Unbind(); err != nil {
+		t.Errorf("Couldn't unbind : %v", err)
+	}
+	if state := Esme.GetEsmeState(); state != OPEN {
+		t.Errorf("ESME state = %v after unbind, want %v", state, OPEN)
+	}
+	if state := smsc.ESMEs.Load().([]*ESME)[0].GetEsmeState(); state != OPEN {
+		t.Errorf("SMSC session state = %v after unbind, want %v", state, OPEN)
+	}
+}
+
+func TestSmscShutdownUnbindsSessionsBeforeClosing(t *testing.T) {
+	smsc, _, Esme := connectEsmeAndSmscTogether(t)
+	defer Esme.Close()
+	if _, err := Esme.BindTransceiver(validSystemID, validPassword); err != nil {
+		t.Fatalf("Couldn't bind with the SMSC : %v", err)
+	}
+	Esme.StartControlLoop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := smsc.Shutdown(ctx); err != nil {
+		t.Errorf("Shutdown() error = %v", err)
+	}
+	if ctx.Err() != nil {
+		t.Errorf("Shutdown waited until the deadline although the ESME answered the unbind")
+	}
+	if state := Esme.GetEsmeState(); state != OPEN && state != CLOSED {
+		t.Errorf("ESME should have been unbound, is %v", state)
+	}
+	AssertSmscIsClosedAndClean(smsc, t)
+}
+
+func TestSmscShutdownForceClosesUnresponsiveSessionsAtDeadline(t *testing.T) {
+	smsc, _, Esme := connectEsmeAndSmscTogether(t)
+	defer Esme.Close()
+	smsc.RoutingTable, _ = NewRoutingTable(Route{SystemId: "Nobody"})
+	if _, err := Esme.BindTransceiver(validSystemID, validPassword); err != nil {
+		t.Fatalf("Couldn't bind with the SMSC : %v", err)
+	}
+	submitSmResp, err := Esme.sendAndWaitForResponse(NewSubmitSM().WithMessage("Pending"))
+	if err != nil {
+		t.Fatalf("Couldn't submit : %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err := smsc.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Shutdown() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+	AssertSmscIsClosedAndClean(smsc, t)
+	message, _ := smsc.MessageStore.Get(submitSmResp.Body.MandatoryParameter["message_id"].(string))
+	if message.State != "UNDELIVERABLE" || len(smsc.timers) != 0 {
+		t.Errorf("Undelivered message should be UNDELIVERABLE and unscheduled : %+v, %v timers", message, len(smsc.timers))
+	}
+}
+
+func TestSmscShutdownGivesUpOnDeliveriesInFlightWithAReceipt(t *testing.T) {
+	smsc, _, sender := connectEsmeAndSmscTogether(t)
+	defer sender.Close()
+	smsc.Authenticator.(*AccountTable).AddAccount(Account{SystemId: "Receiver", Password: "Secret"})
+	smsc.RoutingTable, _ = NewRoutingTable(Route{SystemId: "Receiver"})
+	if _, err := sender.BindTransceiver(validSystemID, validPassword); err != nil {
+		t.Fatalf("Couldn't bind the sender : %v", err)
+	}
+	receiver := connectReceiver(t, smsc)
+	submitSm := NewSubmitSM().WithDestinationAddress("15551234567").WithMessage("Hello").WithDefaults(map[string]interface{}{"registered_delivery": 1})
+	submitSmResp, err := sender.sendAndWaitForResponse(submitSm)
+	if err != nil {
+		t.Fatalf("Couldn't submit : %v", err)
+	}
+	messageId := submitSmResp.Body.MandatoryParameter["message_id"].(string)
+	if deliverSm, err := receiver.receivePdu(); err != nil || deliverSm.Header.CommandId != "deliver_sm" {
+		t.Fatalf("Receiver didn't get the deliver_sm : %v, %v", deliverSm, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err := smsc.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Shutdown() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if message, _ := smsc.MessageStore.Get(messageId); message.State != "UNDELIVERABLE" {
+		t.Errorf("Message in flight at shutdown should be UNDELIVERABLE : %+v", message)
+	}
+	receiptPdu, err := sender.receivePdu()
+	if err != nil || !IsDeliveryReceipt(receiptPdu) {
+		t.Fatalf("Sender didn't get the delivery receipt : %v, %v", receiptPdu, err)
+	}
+	if receipt, _ := ParseDeliveryReceipt(receiptPdu); receipt.MessageId != messageId || receipt.MessageState != "UNDELIVERABLE" {
+		t.Errorf("Unexpected delivery receipt : %+v", receipt)
+	}
+}
+
+func TestSmscConsultsItsAuthenticatorOnBind(t *testing.T) {
+	smsc, _, Esme := connectEsmeAndSmscTogether(t)
+	defer CloseAndAssertClean(smsc, Esme, t)
+	smsc.Authenticator = NewAccountTable(
+		Account{SystemId: "receiverOnly", Password: "secret", AllowedBindTypes: []string{"bind_receiver"}},
+		Account{SystemId: "transmitter", Password: "secret", AllowedNetworks: []string{"127.0.0.0/8"}},
+	)
+
+	resp, err := Esme.BindTransmitter("receiverOnly", "secret")
+	if err == nil || resp.Header.CommandStatus != ESME_RBINDFAIL {
+		t.Errorf("Bind type not allowed should have been refused : %v, %v", resp, err)
+	}
+	resp, err = Esme.BindTransmitter("transmitter", "secret")
+	if err != nil || resp.Header.CommandStatus != ESME_ROK || Esme.GetEsmeState() != BOUND_TX {
+		t.Errorf("Bind from an allowed network should have been accepted : %v, %v", resp, err)
+	}
+}
+
 func CloseAndAssertClean(s *SMSC, e *ESME, t *testing.T) {
 	e.Close()
 	s.Close()
@@ -182,6 +1194,7 @@ func assertWeHaveActiveConnections(smsc *SMSC, number_of_connections int) (is_ri
 func GetSmscSimulatorServer() (smsc *SMSC, err error) {
 	serverSocket, err := net.Listen(connType, connhost+":"+connport)
 	smsc = NewSMSC(&serverSocket, validSystemID, validPassword)
+	smsc.Logger = testLogger
 	return smsc, err
 }
 
@@ -1,8 +1,12 @@
 package smpp
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"net"
+	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 )
@@ -11,93 +15,273 @@ const (
 	LISTENING = "LISTENING"
 )
 
+const (
+	errConnectionLimitReached = Error("reached the connection limit")
+	errShuttingDown           = Error("the SMSC is shutting down")
+)
+
 // SMSC is the server side for the SMPP protocol and is responsible for
 // managing connection made to it.  The current implementation allow for
-// function registration for configuring SMSC reaction to PDUs.
+// hooks configuring the SMSC reaction to its sessions.
 // However, this is not yet ready for use in Production systems.
 type SMSC struct {
 	listeningSocket net.Listener
-	ESMEs           atomic.Value
+	otherListeners  []net.Listener
+	ESMEs           atomic.Value // []*ESME, replaced on every change under esmesMu
+	sessions        atomic.Value // []*Session, replaced along with ESMEs
+	esmesMu         sync.Mutex
+	connecting      int // connections opened and not registered yet, under esmesMu
 	State           State
-	NewConnChan     chan net.Conn
-	NewEsmeChan     chan *ESME
-	RemoveEsmeChan  chan *ESME
-	RemoveDoneChan  chan bool
-	SystemId        string
-	Password        string
+	// Credentials of the account created by NewSMSC, use the Authenticator
+	// to manage accounts once the SMSC is created.
+	SystemId      string
+	Password      string
+	Authenticator Authenticator
+	// Final state reported in the delivery receipts requested through the
+	// registered_delivery field of submit_sm, and how long to wait before
+	// sending them.  The state is a name of message_state_by_name, others
+	// are reported as UNKNOWN.
+	DeliveryReceiptState string
+	DeliveryReceiptDelay time.Duration
+	MessageIdGenerator   MessageIdGenerator
+	MessageStore         MessageStore
+	// Messages are delivered to the receiver chosen by the RoutingTable, or
+	// when no route matches, to a receiver whose bind address_range matches
+	// the destination.  Messages without any receiver simply reach the
+	// DeliveryReceiptState.  Routed messages whose receiver isn't bound, or
+	// doesn't acknowledge them before its session ends, are retried every
+	// DeliveryRetryDelay (10s when zero) and as soon as a receiver binds,
+	// until they expire.
+	RoutingTable       *RoutingTable
+	DeliveryRetryDelay time.Duration
+	pendingDeliveries  sync.Map // deliveryKey to its pendingDelivery
+	routedMessages     uint64
+	// Clock schedules the deliveries and expiries of the messages, it can
+	// only be replaced before the SMSC accepts its first message.
+	Clock    Clock
+	timersMu sync.Mutex
+	timers   map[string]*messageTimers
+	// Connections over MaxConnections are closed as soon as accepted, zero
+	// means no limit.  Per account limits are given by the Authenticator
+	// when it's a BindLimiter.
+	MaxConnections  int
+	bindMu          sync.Mutex
+	endedSessions   map[string]int    // by system_id, sessions ended and not bound again
+	bindsInProgress map[[2]string]int // by system_id and bind type, authorized and not bound yet
+	shuttingDown    atomic.Bool
+	// Hooks are called on every session and must be set before Start.
+	// OnConnect refuses a connection by returning an error.  OnBind, OnSubmit
+	// and OnDataSM are called once the SMSC would accept the PDU and refuse
+	// it by returning an error, answered with the status of a StatusError or
+	// ESME_RBINDFAIL, ESME_RSUBMITFAIL and ESME_RDELIVERYFAILURE otherwise.
+	// OnUnbind is called once a bound session unbinds, whichever side asked
+	// for it, and OnDisconnect once the connection is closed.
+	OnConnect    func(*Session) error
+	OnBind       func(*Session, PDU) error
+	OnSubmit     func(*Session, PDU) error
+	OnDataSM     func(*Session, PDU) error
+	OnUnbind     func(*Session)
+	OnDisconnect func(*Session)
+	// Logger and Metrics are given to every session, they must be set
+	// before Start.  The default Logger only writes to the deprecated
+	// *SmppLogger variables set, and there are no Metrics by default.
+	Logger  Logger
+	Metrics Metrics
+	// Interceptors of every session, they must be set before Start.  See
+	// Interceptor, interceptors added on a session run after these.
+	InboundInterceptors  []Interceptor
+	OutboundInterceptors []Interceptor
+	// Capture records the raw PDUs of every session along with the
+	// system_id they're bound as, it must be set before Start.
+	Capture Capture
+}
+
+// sessionHandlers are the reactions of the SMSC to the PDUs received on its
+// sessions.
+var sessionHandlers = map[string]func(*SMSC, *Session, PDU) error{
+	"bind_receiver":    (*SMSC).handleBindOperation,
+	"bind_transceiver": (*SMSC).handleBindOperation,
+	"bind_transmitter": (*SMSC).handleBindOperation,
+	"submit_sm":        (*SMSC).handleSubmitSmOperation,
+	"data_sm":          (*SMSC).handleDataSmOperation,
+	"deliver_sm":       esmeHandler(handleDeliverSmPduReceived),
+	"deliver_sm_resp":  (*SMSC).handleDeliverSmRespOperation,
+	"query_sm":         (*SMSC).handleQuerySmOperation,
+	"cancel_sm":        (*SMSC).handleCancelSmOperation,
+	"replace_sm":       (*SMSC).handleReplaceSmOperation,
+	"enquire_link":     esmeHandler(handleEnquiryLinkPduReceived),
+	"unbind":           (*SMSC).handleUnbindOperation,
+	"unbind_resp":      (*SMSC).handleUnbindRespOperation,
+}
+
+func esmeHandler(handler func(*ESME, PDU) error) func(*SMSC, *Session, PDU) error {
+	return func(_ *SMSC, session *Session, receivedPdu PDU) error {
+		return handler(session.ESME, receivedPdu)
+	}
 }
 
 func NewSMSC(listeningSocket *net.Listener, SystemId string, Password string) (s *SMSC) {
 	s = &SMSC{
 		listeningSocket: *listeningSocket,
-		State:           *NewESMEState(LISTENING),
+		State:           State{state: LISTENING},
 		ESMEs:           atomic.Value{},
-		NewConnChan:     make(chan net.Conn),
-		NewEsmeChan:     make(chan *ESME),
-		RemoveEsmeChan:  make(chan *ESME),
-		RemoveDoneChan:  make(chan bool),
 		SystemId:        SystemId,
 		Password:        Password,
+		Authenticator:   NewAccountTable(Account{SystemId: SystemId, Password: Password}),
+
+		DeliveryReceiptState: "DELIVERED",
+		MessageIdGenerator:   NewCounterMessageIdGenerator(),
+		MessageStore:         NewInMemoryMessageStore(),
+		RoutingTable:         &RoutingTable{},
+		Clock:                systemClock{},
+		timers:               map[string]*messageTimers{},
+		Logger:               legacyLogger{},
+		Metrics:              noMetrics{},
+		endedSessions:        map[string]int{},
+		bindsInProgress:      map[[2]string]int{},
 	}
 	s.ESMEs.Store([]*ESME{})
-	go s.smscControlLoop()
+	s.sessions.Store([]*Session{})
 	return s
 }
 
-func (smsc *SMSC) acceptNewConnectionFromSMSC() (*ESME, error) {
-	serverConnectionSocket, err := smsc.listeningSocket.Accept()
+// AddListener makes the SMSC accept connections from another listener too,
+// ie. a TLS one next to a plain one.  It must be called before Start, the
+// listener is closed along with the SMSC.
+func (smsc *SMSC) AddListener(listener net.Listener) {
+	smsc.otherListeners = append(smsc.otherListeners, listener)
+}
+
+// Addrs gives the addresses the SMSC listens on.
+func (smsc *SMSC) Addrs() []net.Addr {
+	addrs := []net.Addr{}
+	for _, listener := range smsc.listeners() {
+		addrs = append(addrs, listener.Addr())
+	}
+	return addrs
+}
+
+func (smsc *SMSC) listeners() []net.Listener {
+	return append([]net.Listener{smsc.listeningSocket}, smsc.otherListeners...)
+}
+
+func (smsc *SMSC) acceptNewConnectionFromSMSC() (*Session, error) {
+	return smsc.acceptNewConnectionFrom(smsc.listeningSocket)
+}
+
+func (smsc *SMSC) acceptNewConnectionFrom(listener net.Listener) (*Session, error) {
+	serverConnectionSocket, err := listener.Accept()
 	if err != nil {
 		return nil, err
 	}
-	smsc.NewConnChan <- serverConnectionSocket
-	e := <-smsc.NewEsmeChan
-	return e, nil
+	return smsc.openSession(serverConnectionSocket, true)
 }
 
-func (s *SMSC) smscControlLoop() {
-	for s.State.GetState() != CLOSED {
-		select {
-		case serverConnectionSocket := <-s.NewConnChan:
-			s.createAndAppendNewEsme(serverConnectionSocket)
-		case e := <-s.RemoveEsmeChan:
-			s._closeAndRemoveEsme(e)
-		default:
-			time.Sleep(0)
+// openSession registers the connection as a new session and serves it.
+// Limited connections are refused over MaxConnections, counting the ones
+// still being opened.
+func (smsc *SMSC) openSession(connection net.Conn, limited bool) (*Session, error) {
+	if !smsc.reserveConnection(limited) {
+		connection.Close()
+		return nil, fmt.Errorf("Refusing connection from %v : %w of %v", connection.RemoteAddr(), errConnectionLimitReached, smsc.MaxConnections)
+	}
+	session := newSession(connection, smsc.Clock.Now())
+	session.SetLogger(smsc.Logger)
+	session.SetMetrics(smsc.Metrics)
+	session.InterceptInbound(smsc.InboundInterceptors...)
+	session.InterceptOutbound(smsc.OutboundInterceptors...)
+	if smsc.Capture != nil {
+		session.SetCapture(sessionCapture{smsc.Capture, session})
+	}
+	if smsc.OnConnect != nil {
+		if err := smsc.OnConnect(session); err != nil {
+			connection.Close()
+			smsc.esmesMu.Lock()
+			smsc.connecting--
+			smsc.esmesMu.Unlock()
+			return nil, fmt.Errorf("Refusing connection from %v : %w", session.RemoteAddr(), err)
 		}
 	}
+	smsc.esmesMu.Lock()
+	defer smsc.esmesMu.Unlock()
+	smsc.connecting--
+	old_sessions := smsc.sessions.Load().([]*Session)
+	new_sessions := make([]*Session, len(old_sessions), len(old_sessions)+1)
+	copy(new_sessions, old_sessions)
+	smsc.storeSessions(append(new_sessions, session))
+	go smsc.serve(session)
+	return session, nil
 }
 
-func (smsc *SMSC) createAndAppendNewEsme(serverConnectionSocket net.Conn) {
-	e := NewEsme(serverConnectionSocket)
-	e.CommandFunctions["bind_receiver"] = smsc.handleBindOperation
-	e.CommandFunctions["bind_transceiver"] = smsc.handleBindOperation
-	e.CommandFunctions["bind_transmitter"] = smsc.handleBindOperation
-	appendNewEsmeToSMSC(smsc, e)
-	smsc.NewEsmeChan <- e
+func (smsc *SMSC) reserveConnection(limited bool) bool {
+	smsc.esmesMu.Lock()
+	defer smsc.esmesMu.Unlock()
+	opened := len(smsc.sessions.Load().([]*Session)) + smsc.connecting
+	if limited && smsc.MaxConnections > 0 && opened >= smsc.MaxConnections {
+		return false
+	}
+	smsc.connecting++
+	return true
 }
 
-func appendNewEsmeToSMSC(smsc *SMSC, e *ESME) {
-	old_connections := smsc.ESMEs.Load().([]*ESME)
-	new_connections := append(old_connections, e)
-	smsc.ESMEs.Store(new_connections)
+func (s *SMSC) closeAndRemoveSession(session *Session) {
+	session.Close()
+	s.esmesMu.Lock()
+	defer s.esmesMu.Unlock()
+	old_sessions := s.sessions.Load().([]*Session)
+	new_sessions := make([]*Session, 0, len(old_sessions))
+	for _, x := range old_sessions {
+		if x != session {
+			new_sessions = append(new_sessions, x)
+		}
+	}
+	s.storeSessions(new_sessions)
 }
 
-func (s *SMSC) closeAndRemoveEsme(e *ESME) {
-	s.RemoveEsmeChan <- e
-	<-s.RemoveDoneChan
+func (s *SMSC) storeSessions(sessions []*Session) {
+	esmes := make([]*ESME, len(sessions))
+	for i, session := range sessions {
+		esmes[i] = session.ESME
+	}
+	s.sessions.Store(sessions)
+	s.ESMEs.Store(esmes)
 }
 
-func (s *SMSC) _closeAndRemoveEsme(e *ESME) {
-	e.Close()
-	old_connections := s.ESMEs.Load().([]*ESME)
-	new_connections := []*ESME{}
-	for _, x := range old_connections {
-		if x != e {
-			new_connections = append(new_connections, x)
-		}
+// Sessions gives the sessions currently connected, in the order they
+// connected.
+func (s *SMSC) Sessions() []*Session {
+	return s.sessions.Load().([]*Session)
+}
+
+// sessionEnded counts the end of a bound session until its account binds
+// again.
+func (s *SMSC) sessionEnded(systemId string) {
+	if systemId == "" {
+		return
+	}
+	s.bindMu.Lock()
+	defer s.bindMu.Unlock()
+	s.endedSessions[systemId]++
+}
+
+// isReconnection tells whether the bind follows the end of a session of the
+// same account, it must be called under bindMu.
+func (s *SMSC) isReconnection(systemId string) bool {
+	if s.endedSessions[systemId] == 0 {
+		return false
+	}
+	s.endedSessions[systemId]--
+	if s.endedSessions[systemId] == 0 {
+		delete(s.endedSessions, systemId)
+	}
+	return true
+}
+
+func (s *SMSC) log() Logger {
+	if s.Logger == nil {
+		return silentLogger{}
 	}
-	s.ESMEs.Store(new_connections)
-	s.RemoveDoneChan <- true
+	return s.Logger
 }
 
 func (s *SMSC) GetNumberOfConnection() int {
@@ -105,77 +289,183 @@ func (s *SMSC) GetNumberOfConnection() int {
 }
 
 func (s *SMSC) Start() {
-	go s.acceptAllNewConnection()
+	for _, listener := range s.listeners() {
+		go s.acceptAllNewConnection(listener)
+	}
 }
 
 func (s *SMSC) Close() {
-	esme_chan := s.getEsmeFromChannel()
-	for conn := range esme_chan { //read
-		if conn.GetEsmeState() != CLOSED {
-			s.closeAndRemoveEsme(conn)
+	s.State.Close()
+	s.stopScheduling()
+	for _, listener := range s.listeners() {
+		listener.Close()
+	}
+	for _, session := range s.Sessions() {
+		s.closeAndRemoveSession(session)
+	}
+}
+
+// Shutdown gracefully shuts the SMSC down, like http.Server.Shutdown does.
+// It stops accepting connections, binds and messages, then brings every
+// message not delivered yet to UNDELIVERABLE, with its delivery receipt when
+// requested.  Messages handed over to a receiver get until the end of the
+// context for their deliver_sm_resp.  Every bound session is then unbound
+// and Shutdown waits for their unbind_resp.  Sessions left when the context
+// ends are closed anyway and the context error is returned.
+func (s *SMSC) Shutdown(ctx context.Context) error {
+	s.shuttingDown.Store(true)
+	for _, listener := range s.listeners() {
+		listener.Close()
+	}
+	s.abandonWaitingMessages()
+	err := waitUntil(ctx, s.noDeliveryInFlight)
+	s.abandonDeliveriesInFlight()
+	for _, session := range s.Sessions() {
+		if session.isTransmitterState() || session.isReceiverState() {
+			unbind := NewUnbind()
+			if _, err := session.Send(&unbind); err != nil {
+				session.log().Warn("Couldn't unbind", "error", err)
+			}
 		}
 	}
-	s.listeningSocket.Close()
-	if s.State.GetState() != CLOSED {
-		s.State.SetState(CLOSED)
-		s.State.done <- true
+	if err == nil {
+		err = waitUntil(ctx, s.sessionsAreIdle)
+	}
+	s.Close()
+	return err
+}
+
+const shutdownPollInterval = 10 * time.Millisecond
+
+func waitUntil(ctx context.Context, done func() bool) error {
+	ticker := time.NewTicker(shutdownPollInterval)
+	defer ticker.Stop()
+	for !done() {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
 	}
+	return nil
 }
 
-func (s *SMSC) getEsmeFromChannel() <-chan *ESME {
-	newChannel := make(chan *ESME)
-	go func() {
-		copy := s.ESMEs.Load().([]*ESME)
-		for _, e := range copy {
-			newChannel <- e
+// abandonWaitingMessages brings the messages still waiting in the SMSC to
+// UNDELIVERABLE, they aren't dispatched anymore once shutting down.
+func (s *SMSC) abandonWaitingMessages() {
+	s.timersMu.Lock()
+	waiting := []string{}
+	for messageId, timers := range s.timers {
+		if timers.delivery != nil {
+			waiting = append(waiting, messageId)
 		}
-		close(newChannel)
-	}()
-	return newChannel
+	}
+	s.timersMu.Unlock()
+	for _, messageId := range waiting {
+		s.finalizeMessage(messageId, "UNDELIVERABLE")
+	}
 }
 
-func (s *SMSC) acceptAllNewConnection() {
+func (s *SMSC) noDeliveryInFlight() (none bool) {
+	none = true
+	s.pendingDeliveries.Range(func(key, _ interface{}) bool {
+		none = false
+		return false
+	})
+	return none
+}
+
+func (s *SMSC) abandonDeliveriesInFlight() {
+	s.pendingDeliveries.Range(func(key, value interface{}) bool {
+		if _, ok := s.pendingDeliveries.LoadAndDelete(key); ok {
+			key.(deliveryKey).receiver.metrics.WindowOccupancy(-1)
+			s.finalizeMessage(value.(pendingDelivery).messageId, "UNDELIVERABLE")
+		}
+		return true
+	})
+}
+
+func (s *SMSC) sessionsAreIdle() bool {
+	for _, session := range s.Sessions() {
+		if session.isTransmitterState() || session.isReceiverState() {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *SMSC) stopScheduling() {
+	s.timersMu.Lock()
+	defer s.timersMu.Unlock()
+	for messageId, timers := range s.timers {
+		timers.stop()
+		delete(s.timers, messageId)
+	}
+	s.pendingDeliveries.Range(func(key, _ interface{}) bool {
+		if _, ok := s.pendingDeliveries.LoadAndDelete(key); ok {
+			key.(deliveryKey).receiver.metrics.WindowOccupancy(-1)
+		}
+		return true
+	})
+}
+
+func (s *SMSC) acceptAllNewConnection(listener net.Listener) {
 	for s.State.GetState() != CLOSED {
-		e, err := s.acceptNewConnectionFromSMSC()
+		_, err := s.acceptNewConnectionFrom(listener)
 		if err != nil {
-			InfoSmppLogger.Printf("SMSC wasn't able to accept a new connection: %v", err)
 			if errors.Is(err, net.ErrClosed) {
 				break //can't get new connection
 			}
-			continue
+			s.log().Warn("SMSC wasn't able to accept a new connection", "error", err)
 		}
-		go s.ensureCleanUpOfEsmes(e)
 	}
 }
 
-func handleConnection(e *ESME) {
-	for e.GetEsmeState() != CLOSED {
-		err := handleOperations(e)
+// serve blocks on the session until a PDU comes in, an idle session costs
+// nothing but its goroutine.
+func (s *SMSC) serve(session *Session) {
+	defer func() {
+		s.closeAndRemoveSession(session)
+		s.retryPendingDeliveries(session)
+		s.sessionEnded(session.SystemId())
+		if s.OnDisconnect != nil {
+			s.OnDisconnect(session)
+		}
+	}()
+	for session.GetEsmeState() != CLOSED {
+		err := s.handleOperations(session)
+		if isConnectionClosed(err) {
+			return
+		}
 		if err != nil {
-			InfoSmppLogger.Printf("Issue on Connection: %v\n", err)
+			session.log().Warn("Issue on Connection", "error", err)
 		}
-		time.Sleep(0)
 	}
 }
 
-func handleOperations(e *ESME) (formated_error error) {
-	receivedPdu, formated_error := e.receivePdu()
+func (s *SMSC) handleOperations(session *Session) (formated_error error) {
+	receivedPdu, formated_error := session.receivePduBefore(time.Time{})
 	if formated_error != nil {
 		return formated_error
 	}
-	ABindOperation := IsBindOperation(receivedPdu)
-	if e.GetEsmeState() == OPEN && !ABindOperation {
-		formated_error = handleNonBindedOperations(e, receivedPdu)
+	if session.GetEsmeState() == OPEN && requiresBind(receivedPdu) {
+		return handleNonBindedOperations(session.ESME, receivedPdu)
 	}
-	if _, ok := e.CommandFunctions[receivedPdu.Header.CommandId]; ok {
-		formated_error = e.CommandFunctions[receivedPdu.Header.CommandId](e, receivedPdu)
+	if handler, ok := session.CommandFunctions[receivedPdu.Header.CommandId]; ok {
+		formated_error = handler(session.ESME, receivedPdu)
+	} else if handler, ok := sessionHandlers[receivedPdu.Header.CommandId]; ok {
+		formated_error = handler(s, session, receivedPdu)
 	}
 	return formated_error
 }
 
-func (s *SMSC) ensureCleanUpOfEsmes(e *ESME) {
-	go func() {
-		defer s.closeAndRemoveEsme(e)
-		handleConnection(e)
-	}()
+// requiresBind tells whether the request is refused on a session not bound
+// yet.  Responses are still handled, ie. a deliver_sm_resp following an
+// unbind, and enquire_link is valid in every state.
+func requiresBind(receivedPdu PDU) bool {
+	commandId := receivedPdu.Header.CommandId
+	if IsBindOperation(receivedPdu) || commandId == "enquire_link" || commandId == "generic_nack" {
+		return false
+	}
+	return !strings.HasSuffix(commandId, "_resp")
 }
@@ -0,0 +1,166 @@
+package smpp
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Address groups an SMPP address with its type of number (TON) and numbering
+// plan indicator (NPI) as they always travel together in source_addr_ton,
+// source_addr_npi and source_addr (same for the destination).  TON and NPI
+// values are the ones found in addr_ton_by_name and addr_npi_by_name.
+type Address struct {
+	Ton  int
+	Npi  int
+	Addr string
+}
+
+const (
+	maxInternationalNumberLength = 15 // E.164
+	maxNationalNumberLength      = 20 // source_addr and destination_addr are C-Octet strings of 21 octets
+	minShortCodeLength           = 3
+	maxShortCodeLength           = 8
+	maxAlphanumericLength        = 11 // GSM 03.40 alphanumeric originator
+)
+
+// Characters people use to make numbers readable, but which aren't part of
+// the number.
+var phoneNumberFormattingReplacer = strings.NewReplacer(" ", "", "-", "", ".", "", "(", "", ")", "")
+
+// NewInternationalAddress builds an E.164 address, the leading "+" and
+// formatting characters are stripped from the number.
+func NewInternationalAddress(number string) (Address, error) {
+	number = strings.TrimPrefix(normalizePhoneNumber(number), "+")
+	address := Address{Ton: addressTon("international"), Npi: addressNpi("ISDN"), Addr: number}
+	return address, address.Validate()
+}
+
+func NewNationalAddress(number string) (Address, error) {
+	address := Address{Ton: addressTon("national"), Npi: addressNpi("ISDN"), Addr: normalizePhoneNumber(number)}
+	return address, address.Validate()
+}
+
+func NewShortCode(code string) (Address, error) {
+	address := Address{Ton: addressTon("network_specific"), Npi: addressNpi("unknown"), Addr: normalizePhoneNumber(code)}
+	return address, address.Validate()
+}
+
+// NewAlphanumericAddress builds a sender id made of letters (ie. a brand
+// name), which can't be replied to.
+func NewAlphanumericAddress(sender string) (Address, error) {
+	address := Address{Ton: addressTon("alphanumeric"), Npi: addressNpi("unknown"), Addr: sender}
+	return address, address.Validate()
+}
+
+// NewAddress infers the TON and NPI out of the address itself :
+//   - "+" or "00" followed by digits is an international number,
+//   - 3 to 8 digits is a short code,
+//   - other digits are a national number,
+//   - anything else is an alphanumeric sender id.
+func NewAddress(addr string) (Address, error) {
+	number := normalizePhoneNumber(addr)
+	if strings.HasPrefix(number, "00") && isDigits(number[2:]) {
+		number = "+" + number[2:]
+	}
+	switch {
+	case strings.HasPrefix(number, "+") && isDigits(number[1:]):
+		return NewInternationalAddress(number)
+	case isDigits(number) && len(number) >= minShortCodeLength && len(number) <= maxShortCodeLength:
+		return NewShortCode(number)
+	case isDigits(number):
+		return NewNationalAddress(number)
+	}
+	return NewAlphanumericAddress(addr)
+}
+
+// Validate checks the address content and length against its TON.
+func (a Address) Validate() error {
+	switch a.Ton {
+	case addressTon("international"):
+		if !isDigits(a.Addr) || len(a.Addr) > maxInternationalNumberLength {
+			return fmt.Errorf("International address %q should be at most %v digits", a.Addr, maxInternationalNumberLength)
+		}
+	case addressTon("national"), addressTon("subscriber_number"):
+		if !isDigits(a.Addr) || len(a.Addr) > maxNationalNumberLength {
+			return fmt.Errorf("National address %q should be at most %v digits", a.Addr, maxNationalNumberLength)
+		}
+	case addressTon("network_specific"), addressTon("abbreviated"):
+		if !isDigits(a.Addr) || len(a.Addr) < minShortCodeLength || len(a.Addr) > maxShortCodeLength {
+			return fmt.Errorf("Short code %q should be between %v and %v digits", a.Addr, minShortCodeLength, maxShortCodeLength)
+		}
+	case addressTon("alphanumeric"):
+		if a.Addr == "" || len(a.Addr) > maxAlphanumericLength || !isPrintableAscii(a.Addr) {
+			return fmt.Errorf("Alphanumeric address %q should be between 1 and %v printable characters", a.Addr, maxAlphanumericLength)
+		}
+	default:
+		if len(a.Addr) > maxNationalNumberLength {
+			return fmt.Errorf("Address %q is longer than %v characters", a.Addr, maxNationalNumberLength)
+		}
+	}
+	return nil
+}
+
+// String gives the address as people would write it (ie. with the "+" for
+// international numbers).
+func (a Address) String() string {
+	if a.Ton == addressTon("international") {
+		return "+" + a.Addr
+	}
+	return a.Addr
+}
+
+func (p PDU) WithSource(a Address) PDU {
+	return p.WithSourceAddressTon(a.Ton).WithSourceAddressNpi(a.Npi).WithSourceAddress(a.Addr)
+}
+
+func (p PDU) WithDestination(a Address) PDU {
+	return p.WithDestinationAddressTon(a.Ton).WithDestinationAddressNpi(a.Npi).WithDestinationAddress(a.Addr)
+}
+
+func (p PDU) GetSource() Address {
+	return p.getAddress("source_addr_ton", "source_addr_npi", "source_addr")
+}
+
+func (p PDU) GetDestination() Address {
+	return p.getAddress("dest_addr_ton", "dest_addr_npi", "destination_addr")
+}
+
+func (p PDU) getAddress(tonField string, npiField string, addrField string) Address {
+	ton, _ := p.Body.MandatoryParameter[tonField].(int)
+	npi, _ := p.Body.MandatoryParameter[npiField].(int)
+	addr, _ := p.Body.MandatoryParameter[addrField].(string)
+	return Address{Ton: ton, Npi: npi, Addr: addr}
+}
+
+func addressTon(name string) int {
+	return fieldMappingMap["addr_ton_by_name"][name].(int)
+}
+
+func addressNpi(name string) int {
+	return fieldMappingBits("addr_npi_by_name", name)
+}
+
+func normalizePhoneNumber(number string) string {
+	return phoneNumberFormattingReplacer.Replace(strings.TrimSpace(number))
+}
+
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func isPrintableAscii(s string) bool {
+	for _, c := range s {
+		if c < ' ' || c > '~' {
+			return false
+		}
+	}
+	return true
+}
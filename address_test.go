@@ -0,0 +1,91 @@
+package smpp
+
+import (
+	"testing"
+)
+
+func TestAddressConstructors(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name        string
+		constructor func(string) (Address, error)
+		value       string
+		want        Address
+		wantErr     bool
+	}{
+		{"international with plus and formatting", NewInternationalAddress, "+1 (555) 123-4567", Address{Ton: 1, Npi: 1, Addr: "15551234567"}, false},
+		{"international too long", NewInternationalAddress, "+1234567890123456", Address{Ton: 1, Npi: 1, Addr: "1234567890123456"}, true},
+		{"international with letters", NewInternationalAddress, "+1555CALLNOW", Address{Ton: 1, Npi: 1, Addr: "1555CALLNOW"}, true},
+		{"national", NewNationalAddress, "555.123.4567", Address{Ton: 2, Npi: 1, Addr: "5551234567"}, false},
+		{"short code", NewShortCode, "12345", Address{Ton: 3, Npi: 0, Addr: "12345"}, false},
+		{"short code too short", NewShortCode, "12", Address{Ton: 3, Npi: 0, Addr: "12"}, true},
+		{"alphanumeric", NewAlphanumericAddress, "MyBrand", Address{Ton: 5, Npi: 0, Addr: "MyBrand"}, false},
+		{"alphanumeric of 11 characters", NewAlphanumericAddress, "Hello World", Address{Ton: 5, Npi: 0, Addr: "Hello World"}, false},
+		{"alphanumeric longer than 11 characters", NewAlphanumericAddress, "MyBrandIsTooLong", Address{Ton: 5, Npi: 0, Addr: "MyBrandIsTooLong"}, true},
+		{"empty alphanumeric", NewAlphanumericAddress, "", Address{Ton: 5, Npi: 0, Addr: ""}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.constructor(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("constructor error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("constructor = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewAddressInfersTonAndNpi(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		value string
+		want  Address
+	}{
+		{"+15551234567", Address{Ton: 1, Npi: 1, Addr: "15551234567"}},
+		{"+44 20 7946 0958", Address{Ton: 1, Npi: 1, Addr: "442079460958"}},
+		{"0044 20 7946 0958", Address{Ton: 1, Npi: 1, Addr: "442079460958"}},
+		{"5551234567", Address{Ton: 2, Npi: 1, Addr: "5551234567"}},
+		{"24273", Address{Ton: 3, Npi: 0, Addr: "24273"}},
+		{"911", Address{Ton: 3, Npi: 0, Addr: "911"}},
+		{"42", Address{Ton: 2, Npi: 1, Addr: "42"}},
+		{"7", Address{Ton: 2, Npi: 1, Addr: "7"}},
+		{"MyBank", Address{Ton: 5, Npi: 0, Addr: "MyBank"}},
+		{"My Bank", Address{Ton: 5, Npi: 0, Addr: "My Bank"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := NewAddress(tt.value)
+			if err != nil {
+				t.Errorf("NewAddress() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("NewAddress() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAddressBuildersSetAllFields(t *testing.T) {
+	t.Parallel()
+	source, _ := NewAlphanumericAddress("MyBrand")
+	destination, _ := NewInternationalAddress("+15551234567")
+	submitSm := NewSubmitSM().WithSource(source).WithDestination(destination)
+
+	expectedSubmitSm := NewSubmitSM().
+		WithSourceAddressTon(5).
+		WithSourceAddressNpi(0).
+		WithSourceAddress("MyBrand").
+		WithDestinationAddressTon(1).
+		WithDestinationAddressNpi(1).
+		WithDestinationAddress("15551234567")
+	comparePdu(submitSm, expectedSubmitSm, t)
+
+	if submitSm.GetSource() != source || submitSm.GetDestination() != destination {
+		t.Errorf("Addresses read back aren't the ones set : %v, %v", submitSm.GetSource(), submitSm.GetDestination())
+	}
+	if destination.String() != "+15551234567" || source.String() != "MyBrand" {
+		t.Errorf("Addresses aren't rendered as expected : %v, %v", destination, source)
+	}
+}
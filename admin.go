@@ -0,0 +1,268 @@
+package smpp
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// NewAdminHandler gives an HTTP API to look at and control the SMSC, meant
+// for simulators shared between teams.  Sessions are identified by their
+// remote address :
+//
+//	GET    /sessions                        lists the sessions and their counters
+//	DELETE /sessions/{remote_addr}          closes the connection of a session
+//	POST   /sessions/{remote_addr}/unbind   sends an unbind to a session
+//	GET    /messages?system_id=&state=      lists the stored messages
+//	GET    /messages/{message_id}           shows a stored message
+//	POST   /deliver_sm                      sends a deliver_sm to a system_id
+//
+// The deliver_sm is described as {"system_id", "source", "destination",
+// "short_message", "data_coding"}, addresses being given as to NewAddress.
+// Errors are answered as {"error": "..."}.  Mount it under a prefix with
+// http.StripPrefix, it's up to the caller to protect it.
+func NewAdminHandler(s *SMSC) http.Handler {
+	admin := &adminHandler{s}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/sessions", admin.listSessions)
+	mux.HandleFunc("/sessions/", admin.controlSession)
+	mux.HandleFunc("/messages", admin.listMessages)
+	mux.HandleFunc("/messages/", admin.showMessage)
+	mux.HandleFunc("/deliver_sm", admin.injectDeliverSm)
+	return mux
+}
+
+type adminHandler struct {
+	smsc *SMSC
+}
+
+type adminSession struct {
+	RemoteAddr    string        `json:"remote_addr"`
+	SystemId      string        `json:"system_id,omitempty"`
+	BindType      string        `json:"bind_type,omitempty"`
+	State         string        `json:"state"`
+	ConnectedAt   time.Time     `json:"connected_at"`
+	BoundAt       *time.Time    `json:"bound_at,omitempty"`
+	UptimeSeconds float64       `json:"uptime_seconds"`
+	Counters      adminCounters `json:"counters"`
+}
+
+type adminCounters struct {
+	PdusReceived      uint64 `json:"pdus_received"`
+	PdusSent          uint64 `json:"pdus_sent"`
+	MessagesSubmitted uint64 `json:"messages_submitted"`
+	MessagesDelivered uint64 `json:"messages_delivered"`
+}
+
+type adminMessage struct {
+	MessageId            string     `json:"message_id"`
+	SystemId             string     `json:"system_id"`
+	Source               string     `json:"source"`
+	Destination          string     `json:"destination"`
+	State                string     `json:"state"`
+	SubmitDate           time.Time  `json:"submit_date"`
+	ScheduleDeliveryTime *time.Time `json:"schedule_delivery_time,omitempty"`
+	ExpiryTime           *time.Time `json:"expiry_time,omitempty"`
+	DoneDate             *time.Time `json:"done_date,omitempty"`
+	ErrorCode            int        `json:"error_code"`
+	Pdu                  *PDU       `json:"pdu,omitempty"`
+}
+
+type adminDeliverSm struct {
+	SystemId     string `json:"system_id"`
+	Source       string `json:"source"`
+	Destination  string `json:"destination"`
+	ShortMessage string `json:"short_message"`
+	DataCoding   int    `json:"data_coding"`
+}
+
+func (a *adminHandler) listSessions(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+	now := a.smsc.Clock.Now()
+	sessions := []adminSession{}
+	for _, session := range a.smsc.Sessions() {
+		counters := session.Counters()
+		view := adminSession{
+			RemoteAddr:    session.RemoteAddr().String(),
+			SystemId:      session.SystemId(),
+			BindType:      session.BindType(),
+			State:         session.GetEsmeState(),
+			ConnectedAt:   session.ConnectedAt(),
+			BoundAt:       optionalTime(session.BoundAt()),
+			UptimeSeconds: now.Sub(session.ConnectedAt()).Seconds(),
+			Counters:      adminCounters(counters),
+		}
+		sessions = append(sessions, view)
+	}
+	writeJSON(w, http.StatusOK, sessions)
+}
+
+func (a *adminHandler) controlSession(w http.ResponseWriter, r *http.Request) {
+	remoteAddr, action, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/sessions/"), "/")
+	session := a.findSession(remoteAddr)
+	if session == nil {
+		writeError(w, http.StatusNotFound, fmt.Errorf("No session connected from %v", remoteAddr))
+		return
+	}
+	switch action {
+	case "":
+		if !allowMethod(w, r, http.MethodDelete) {
+			return
+		}
+		session.log().Info("Closing the session on admin request")
+		a.smsc.closeAndRemoveSession(session)
+		w.WriteHeader(http.StatusNoContent)
+	case "unbind":
+		if !allowMethod(w, r, http.MethodPost) {
+			return
+		}
+		if !session.isTransmitterState() && !session.isReceiverState() {
+			writeError(w, http.StatusConflict, fmt.Errorf("Session from %v isn't bound", remoteAddr))
+			return
+		}
+		unbind := NewUnbind()
+		if _, err := session.Send(&unbind); err != nil {
+			writeError(w, http.StatusBadGateway, fmt.Errorf("Couldn't unbind : %v", err))
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (a *adminHandler) findSession(remoteAddr string) *Session {
+	for _, session := range a.smsc.Sessions() {
+		if session.RemoteAddr().String() == remoteAddr {
+			return session
+		}
+	}
+	return nil
+}
+
+func (a *adminHandler) listMessages(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+	stored, err := a.smsc.MessageStore.List()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Errorf("Couldn't list the messages : %v", err))
+		return
+	}
+	systemId, state := r.URL.Query().Get("system_id"), r.URL.Query().Get("state")
+	messages := []adminMessage{}
+	for _, message := range stored {
+		if (systemId != "" && message.SystemId != systemId) || (state != "" && message.State != state) {
+			continue
+		}
+		messages = append(messages, newAdminMessage(message, false))
+	}
+	writeJSON(w, http.StatusOK, messages)
+}
+
+func (a *adminHandler) showMessage(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+	messageId := strings.TrimPrefix(r.URL.Path, "/messages/")
+	message, err := a.smsc.MessageStore.Get(messageId)
+	if errors.Is(err, ErrMessageNotFound) {
+		writeError(w, http.StatusNotFound, fmt.Errorf("No message %v", messageId))
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Errorf("Couldn't get the message : %v", err))
+		return
+	}
+	writeJSON(w, http.StatusOK, newAdminMessage(message, true))
+}
+
+func newAdminMessage(message StoredMessage, withPdu bool) adminMessage {
+	view := adminMessage{
+		MessageId:            message.MessageId,
+		SystemId:             message.SystemId,
+		Source:               message.Source.String(),
+		Destination:          message.Destination.String(),
+		State:                message.State,
+		SubmitDate:           message.SubmitDate,
+		ScheduleDeliveryTime: optionalTime(message.ScheduleDeliveryTime),
+		ExpiryTime:           optionalTime(message.ExpiryTime),
+		DoneDate:             optionalTime(message.DoneDate),
+		ErrorCode:            message.ErrorCode,
+	}
+	if withPdu {
+		view.Pdu = &message.Pdu
+	}
+	return view
+}
+
+func (a *adminHandler) injectDeliverSm(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodPost) {
+		return
+	}
+	var request adminDeliverSm
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("Couldn't decode the deliver_sm : %v", err))
+		return
+	}
+	source, err := NewAddress(request.Source)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("Invalid source : %v", err))
+		return
+	}
+	destination, err := NewAddress(request.Destination)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("Invalid destination : %v", err))
+		return
+	}
+	receiver := a.smsc.findReceiverBoundAs(request.SystemId)
+	if receiver == nil {
+		writeError(w, http.StatusNotFound, fmt.Errorf("No receiver bound as %q", request.SystemId))
+		return
+	}
+	deliverSm := NewDeliverSM().
+		WithSource(source).
+		WithDestination(destination).
+		WithDataCoding(request.DataCoding).
+		WithMessage(request.ShortMessage)
+	sequenceNumber, err := receiver.Send(&deliverSm)
+	if err != nil {
+		writeError(w, http.StatusBadGateway, fmt.Errorf("Couldn't send the deliver_sm : %v", err))
+		return
+	}
+	writeJSON(w, http.StatusAccepted, map[string]interface{}{
+		"remote_addr":     receiver.RemoteAddr().String(),
+		"sequence_number": sequenceNumber,
+	})
+}
+
+func allowMethod(w http.ResponseWriter, r *http.Request, method string) bool {
+	if r.Method == method {
+		return true
+	}
+	w.Header().Set("Allow", method)
+	writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("Method %v not allowed", r.Method))
+	return false
+}
+
+func optionalTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+func writeJSON(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(value)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,93 @@
+package smpp
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func adminRequest(t *testing.T, handler http.Handler, method string, path string, body string, wantStatus int, response interface{}) {
+	t.Helper()
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(method, path, strings.NewReader(body)))
+	if recorder.Code != wantStatus {
+		t.Fatalf("%v %v answered %v, want %v : %v", method, path, recorder.Code, wantStatus, recorder.Body)
+	}
+	if response != nil {
+		if err := json.Unmarshal(recorder.Body.Bytes(), response); err != nil {
+			t.Fatalf("Couldn't decode the answer to %v %v : %v", method, path, err)
+		}
+	}
+}
+
+func TestAdminHandlerShowsSessionsAndMessages(t *testing.T) {
+	smsc, _, Esme := connectEsmeAndSmscTogether(t)
+	defer CloseAndAssertClean(smsc, Esme, t)
+	admin := NewAdminHandler(smsc)
+	if _, err := Esme.BindTransceiver(validSystemID, validPassword); err != nil {
+		t.Fatalf("Couldn't bind with the SMSC : %v", err)
+	}
+	resp, err := Esme.sendAndWaitForResponse(NewSubmitSM().WithDestinationAddress("5551234").WithMessage("Hello"))
+	if err != nil {
+		t.Fatalf("Couldn't submit : %v", err)
+	}
+	messageId := resp.Body.MandatoryParameter["message_id"].(string)
+
+	var sessions []adminSession
+	adminRequest(t, admin, http.MethodGet, "/sessions", "", http.StatusOK, &sessions)
+	if len(sessions) != 1 || sessions[0].SystemId != validSystemID || sessions[0].BindType != "bind_transceiver" ||
+		sessions[0].RemoteAddr != Esme.clientSocket.LocalAddr().String() || sessions[0].Counters.MessagesSubmitted != 1 {
+		t.Errorf("Sessions listed as %+v", sessions)
+	}
+
+	var messages []adminMessage
+	adminRequest(t, admin, http.MethodGet, "/messages?system_id="+validSystemID, "", http.StatusOK, &messages)
+	if len(messages) != 1 || messages[0].MessageId != messageId || messages[0].Destination != "5551234" {
+		t.Errorf("Messages listed as %+v", messages)
+	}
+	adminRequest(t, admin, http.MethodGet, "/messages?system_id=someone_else", "", http.StatusOK, &messages)
+	if len(messages) != 0 {
+		t.Errorf("Messages of another system_id listed as %+v", messages)
+	}
+
+	var message adminMessage
+	adminRequest(t, admin, http.MethodGet, "/messages/"+messageId, "", http.StatusOK, &message)
+	if message.Pdu == nil || message.Pdu.Body.MandatoryParameter["short_message"] != "Hello" {
+		t.Errorf("Message shown as %+v", message)
+	}
+	adminRequest(t, admin, http.MethodGet, "/messages/unknown", "", http.StatusNotFound, nil)
+	adminRequest(t, admin, http.MethodPost, "/sessions", "", http.StatusMethodNotAllowed, nil)
+}
+
+func TestAdminHandlerInjectsDeliverSmAndControlsSessions(t *testing.T) {
+	smsc, _, Esme := connectEsmeAndSmscTogether(t)
+	defer CloseAndAssertClean(smsc, Esme, t)
+	admin := NewAdminHandler(smsc)
+	if _, err := Esme.BindReceiver(validSystemID, validPassword); err != nil {
+		t.Fatalf("Couldn't bind with the SMSC : %v", err)
+	}
+
+	adminRequest(t, admin, http.MethodPost, "/deliver_sm", `{"system_id": "nobody", "source": "+15551234", "destination": "1234"}`, http.StatusNotFound, nil)
+	adminRequest(t, admin, http.MethodPost, "/deliver_sm",
+		`{"system_id": "`+validSystemID+`", "source": "+15551234", "destination": "1234", "short_message": "Injected"}`, http.StatusAccepted, nil)
+	deliverSm, err := Esme.receivePdu()
+	if err != nil || deliverSm.Header.CommandId != "deliver_sm" || deliverSm.Body.MandatoryParameter["short_message"] != "Injected" ||
+		deliverSm.GetSource().String() != "+15551234" {
+		t.Fatalf("Didn't receive the injected deliver_sm : %v, %v", deliverSm, err)
+	}
+
+	session := "/sessions/" + Esme.clientSocket.LocalAddr().String()
+	adminRequest(t, admin, http.MethodPost, session+"/unbind", "", http.StatusAccepted, nil)
+	unbind, err := Esme.receivePdu()
+	if err != nil || unbind.Header.CommandId != "unbind" {
+		t.Fatalf("Didn't receive the unbind : %v, %v", unbind, err)
+	}
+
+	adminRequest(t, admin, http.MethodDelete, session, "", http.StatusNoContent, nil)
+	if smsc.GetNumberOfConnection() != 0 {
+		t.Errorf("Session wasn't closed")
+	}
+	adminRequest(t, admin, http.MethodDelete, session, "", http.StatusNotFound, nil)
+}
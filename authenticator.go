@@ -0,0 +1,148 @@
+package smpp
+
+import (
+	"net"
+	"sync"
+)
+
+// BindRequest holds what an Authenticator needs to grant or deny a bind.
+// BindType is the command_id of the bind (ie. "bind_transceiver").
+type BindRequest struct {
+	SystemId   string
+	Password   string
+	SystemType string
+	BindType   string
+	RemoteAddr net.Addr
+}
+
+// Authenticator is consulted by the SMSC on every bind.  It returns the
+// command_status of the bind response, ESME_ROK granting the bind.  Any other
+// status (ie. ESME_RINVPASWD, ESME_RINVSYSID) is sent back to the ESME as is.
+type Authenticator interface {
+	Authenticate(request BindRequest) string
+}
+
+// BindLimiter can be implemented by an Authenticator to limit the number of
+// sessions an account can keep bound at once, by bind type.  The SMSC refuses
+// binds over the limit with ESME_RBINDFAIL.
+type BindLimiter interface {
+	MaxBinds(systemId string, bindType string) (limit int, limited bool)
+}
+
+// Account is an entry of an AccountTable.  Empty SystemType,
+// AllowedBindTypes or AllowedNetworks mean no restriction.  AllowedNetworks
+// entries are either IPs or CIDRs.  MaxBinds is keyed by bind type (ie.
+// "bind_transmitter"), bind types missing from it have no limit.
+type Account struct {
+	SystemId         string
+	Password         string
+	SystemType       string
+	AllowedBindTypes []string
+	AllowedNetworks  []string
+	MaxBinds         map[string]int
+}
+
+// AccountTable is the in-memory Authenticator used by default by the SMSC.
+// It's safe to add or remove accounts while the SMSC is running.
+type AccountTable struct {
+	mu       sync.RWMutex
+	accounts map[string]Account
+}
+
+func NewAccountTable(accounts ...Account) *AccountTable {
+	table := &AccountTable{accounts: map[string]Account{}}
+	for _, account := range accounts {
+		table.AddAccount(account)
+	}
+	return table
+}
+
+func (t *AccountTable) AddAccount(account Account) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.accounts[account.SystemId] = account
+}
+
+func (t *AccountTable) RemoveAccount(systemId string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.accounts, systemId)
+}
+
+func (t *AccountTable) GetAccount(systemId string) (Account, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	account, ok := t.accounts[systemId]
+	return account, ok
+}
+
+func (t *AccountTable) Authenticate(request BindRequest) string {
+	account, ok := t.GetAccount(request.SystemId)
+	switch {
+	case !ok:
+		return ESME_RINVSYSID
+	case account.Password != request.Password:
+		return ESME_RINVPASWD
+	case account.SystemType != "" && account.SystemType != request.SystemType:
+		return ESME_RINVSYSTYP
+	case !account.isBindTypeAllowed(request.BindType):
+		return ESME_RBINDFAIL
+	case !account.isRemoteAddrAllowed(request.RemoteAddr):
+		return ESME_RBINDFAIL
+	}
+	return ESME_ROK
+}
+
+func (t *AccountTable) MaxBinds(systemId string, bindType string) (int, bool) {
+	account, ok := t.GetAccount(systemId)
+	if !ok {
+		return 0, false
+	}
+	limit, limited := account.MaxBinds[bindType]
+	return limit, limited
+}
+
+func (a Account) isBindTypeAllowed(bindType string) bool {
+	if len(a.AllowedBindTypes) == 0 {
+		return true
+	}
+	for _, allowed := range a.AllowedBindTypes {
+		if allowed == bindType {
+			return true
+		}
+	}
+	return false
+}
+
+func (a Account) isRemoteAddrAllowed(remoteAddr net.Addr) bool {
+	if len(a.AllowedNetworks) == 0 {
+		return true
+	}
+	ip := ipOfAddr(remoteAddr)
+	if ip == nil {
+		return false
+	}
+	for _, allowed := range a.AllowedNetworks {
+		if _, network, err := net.ParseCIDR(allowed); err == nil && network.Contains(ip) {
+			return true
+		}
+		if allowedIp := net.ParseIP(allowed); allowedIp != nil && allowedIp.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func ipOfAddr(addr net.Addr) net.IP {
+	if addr == nil {
+		return nil
+	}
+	if tcpAddr, ok := addr.(*net.TCPAddr); ok {
+		return tcpAddr.IP
+	}
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		host = addr.String()
+	}
+	return net.ParseIP(host)
+}
@@ -0,0 +1,72 @@
+package smpp
+
+import (
+	"net"
+	"testing"
+)
+
+func TestAccountTableAuthenticate(t *testing.T) {
+	t.Parallel()
+	accounts := NewAccountTable(
+		Account{SystemId: "open", Password: "secret"},
+		Account{SystemId: "typed", Password: "secret", SystemType: "VMS"},
+		Account{SystemId: "receiver", Password: "secret", AllowedBindTypes: []string{"bind_receiver", "bind_transceiver"}},
+		Account{SystemId: "office", Password: "secret", AllowedNetworks: []string{"10.0.0.0/8", "192.168.1.10"}},
+	)
+	localAddr := &net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 2775}
+	tests := []struct {
+		name       string
+		request    BindRequest
+		wantStatus string
+	}{
+		{"valid credentials", BindRequest{SystemId: "open", Password: "secret", BindType: "bind_transmitter", RemoteAddr: localAddr}, ESME_ROK},
+		{"unknown system id", BindRequest{SystemId: "nobody", Password: "secret", BindType: "bind_transmitter", RemoteAddr: localAddr}, ESME_RINVSYSID},
+		{"wrong password", BindRequest{SystemId: "open", Password: "guess", BindType: "bind_transmitter", RemoteAddr: localAddr}, ESME_RINVPASWD},
+		{"wrong system type", BindRequest{SystemId: "typed", Password: "secret", SystemType: "OTHER", BindType: "bind_transmitter", RemoteAddr: localAddr}, ESME_RINVSYSTYP},
+		{"expected system type", BindRequest{SystemId: "typed", Password: "secret", SystemType: "VMS", BindType: "bind_transmitter", RemoteAddr: localAddr}, ESME_ROK},
+		{"bind type not allowed", BindRequest{SystemId: "receiver", Password: "secret", BindType: "bind_transmitter", RemoteAddr: localAddr}, ESME_RBINDFAIL},
+		{"bind type allowed", BindRequest{SystemId: "receiver", Password: "secret", BindType: "bind_transceiver", RemoteAddr: localAddr}, ESME_ROK},
+		{"remote address outside allowed networks", BindRequest{SystemId: "office", Password: "secret", BindType: "bind_transmitter", RemoteAddr: localAddr}, ESME_RBINDFAIL},
+		{"remote address within allowed CIDR", BindRequest{SystemId: "office", Password: "secret", BindType: "bind_transmitter", RemoteAddr: &net.TCPAddr{IP: net.ParseIP("10.1.2.3"), Port: 2775}}, ESME_ROK},
+		{"remote address is an allowed IP", BindRequest{SystemId: "office", Password: "secret", BindType: "bind_transmitter", RemoteAddr: &net.TCPAddr{IP: net.ParseIP("192.168.1.10"), Port: 2775}}, ESME_ROK},
+		{"unknown remote address", BindRequest{SystemId: "office", Password: "secret", BindType: "bind_transmitter"}, ESME_RBINDFAIL},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := accounts.Authenticate(tt.request); got != tt.wantStatus {
+				t.Errorf("Authenticate() = %v, want %v", got, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestAccountTableCanBeUpdated(t *testing.T) {
+	t.Parallel()
+	accounts := NewAccountTable()
+	request := BindRequest{SystemId: "late", Password: "secret", BindType: "bind_transmitter"}
+	if status := accounts.Authenticate(request); status != ESME_RINVSYSID {
+		t.Errorf("Account shouldn't exist yet : %v", status)
+	}
+	accounts.AddAccount(Account{SystemId: "late", Password: "secret"})
+	if status := accounts.Authenticate(request); status != ESME_ROK {
+		t.Errorf("Account should have been added : %v", status)
+	}
+	accounts.RemoveAccount("late")
+	if _, ok := accounts.GetAccount("late"); ok {
+		t.Errorf("Account should have been removed")
+	}
+}
+
+func TestAccountTableGivesBindLimitsByType(t *testing.T) {
+	t.Parallel()
+	var limiter BindLimiter = NewAccountTable(Account{SystemId: "limited", MaxBinds: map[string]int{"bind_transmitter": 2}})
+	if limit, limited := limiter.MaxBinds("limited", "bind_transmitter"); !limited || limit != 2 {
+		t.Errorf("MaxBinds() = %v, %v, want 2, true", limit, limited)
+	}
+	if _, limited := limiter.MaxBinds("limited", "bind_receiver"); limited {
+		t.Errorf("Bind types missing from MaxBinds shouldn't be limited")
+	}
+	if _, limited := limiter.MaxBinds("unknown", "bind_transmitter"); limited {
+		t.Errorf("Unknown accounts shouldn't be limited")
+	}
+}
@@ -0,0 +1,137 @@
+package smpp
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// EsmClass is the esm_class field of submit_sm, deliver_sm and data_sm
+// (SMPP v3.4, section 5.2.12).  Names used by the constructor and accessors
+// are the ones of esm_class_bits without their group prefix (ie.
+// "store_and_forward" for "mode_store_and_forward").
+type EsmClass int
+
+// RegisteredDelivery is the registered_delivery field of submit_sm,
+// deliver_sm and data_sm (SMPP v3.4, section 5.2.17).  Names used by the
+// constructor and accessors are the ones of registered_delivery_bits
+// without their group prefix (ie. "on_fail" for "receipt_on_fail").
+type RegisteredDelivery int
+
+func NewEsmClass(mode string, messageType string, features ...string) (EsmClass, error) {
+	modeBits, err := fieldMappingGroupBits("esm_class_bits", "mode", mode)
+	if err != nil {
+		return 0, err
+	}
+	typeBits, err := fieldMappingGroupBits("esm_class_bits", "type", messageType)
+	if err != nil {
+		return 0, err
+	}
+	esmClass := modeBits | typeBits
+	for _, feature := range features {
+		featureBits, err := fieldMappingGroupBits("esm_class_bits", "feature", feature)
+		if err != nil {
+			return 0, err
+		}
+		esmClass |= featureBits
+	}
+	return EsmClass(esmClass), nil
+}
+
+func (c EsmClass) MessagingMode() string {
+	return fieldMappingGroupName("esm_class_bits", "mode", int(c))
+}
+
+func (c EsmClass) MessageType() string {
+	return fieldMappingGroupName("esm_class_bits", "type", int(c))
+}
+
+func (c EsmClass) HasUDHI() bool {
+	return int(c)&fieldMappingBits("esm_class_bits", "feature_UDHI") != 0
+}
+
+func (c EsmClass) HasReplyPath() bool {
+	return int(c)&fieldMappingBits("esm_class_bits", "feature_reply_path") != 0
+}
+
+func (c EsmClass) IsDeliveryReceipt() bool {
+	return c.MessageType() == "delivery_receipt"
+}
+
+func NewRegisteredDelivery(receipt string, ack string, intermediateNotification bool) (RegisteredDelivery, error) {
+	receiptBits, err := fieldMappingGroupBits("registered_delivery_bits", "receipt", receipt)
+	if err != nil {
+		return 0, err
+	}
+	ackBits, err := fieldMappingGroupBits("registered_delivery_bits", "ack", ack)
+	if err != nil {
+		return 0, err
+	}
+	registeredDelivery := receiptBits | ackBits
+	if intermediateNotification {
+		registeredDelivery |= fieldMappingBits("registered_delivery_bits", "intermed_notif")
+	}
+	return RegisteredDelivery(registeredDelivery), nil
+}
+
+// Receipt tells which SMSC delivery receipt is requested ("nil", "always",
+// "on_fail" or "res").
+func (r RegisteredDelivery) Receipt() string {
+	return fieldMappingGroupName("registered_delivery_bits", "receipt", int(r))
+}
+
+// SmeAck tells which SME originated acknowledgement is requested ("nil",
+// "delivery", "user" or "delivery_and_user").
+func (r RegisteredDelivery) SmeAck() string {
+	return fieldMappingGroupName("registered_delivery_bits", "ack", int(r))
+}
+
+func (r RegisteredDelivery) IntermediateNotification() bool {
+	return int(r)&fieldMappingBits("registered_delivery_bits", "intermed_notif_mask") != 0
+}
+
+func (p PDU) WithEsmClass(c EsmClass) PDU {
+	p.Body.MandatoryParameter["esm_class"] = int(c)
+	return p
+}
+
+func (p PDU) WithRegisteredDelivery(r RegisteredDelivery) PDU {
+	p.Body.MandatoryParameter["registered_delivery"] = int(r)
+	return p
+}
+
+func (p PDU) GetEsmClass() EsmClass {
+	esmClass, _ := p.Body.MandatoryParameter["esm_class"].(int)
+	return EsmClass(esmClass)
+}
+
+func (p PDU) GetRegisteredDelivery() RegisteredDelivery {
+	registeredDelivery, _ := p.Body.MandatoryParameter["registered_delivery"].(int)
+	return RegisteredDelivery(registeredDelivery)
+}
+
+func fieldMappingBits(mapping string, name string) int {
+	bits, err := strconv.ParseInt(fieldMappingMap[mapping][name].(string), 16, 0)
+	if err != nil {
+		panic(fmt.Sprintf("%v of %v isn't an hexadecimal value", name, mapping))
+	}
+	return int(bits)
+}
+
+func fieldMappingGroupBits(mapping string, group string, name string) (int, error) {
+	if _, ok := fieldMappingMap[mapping][group+"_"+name]; !ok || name == "mask" {
+		return 0, fmt.Errorf("Unknown %v %v for %v", group, name, mapping)
+	}
+	return fieldMappingBits(mapping, group+"_"+name), nil
+}
+
+func fieldMappingGroupName(mapping string, group string, value int) string {
+	maskedValue := value & fieldMappingBits(mapping, group+"_mask")
+	for fullName := range fieldMappingMap[mapping] {
+		name, isInGroup := strings.CutPrefix(fullName, group+"_")
+		if isInGroup && name != "mask" && fieldMappingBits(mapping, fullName) == maskedValue {
+			return name
+		}
+	}
+	return ""
+}
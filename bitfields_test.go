@@ -0,0 +1,139 @@
+package smpp
+
+import (
+	"testing"
+)
+
+func TestNewEsmClass(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name        string
+		mode        string
+		messageType string
+		features    []string
+		want        EsmClass
+		wantErr     bool
+	}{
+		{"default values", "default", "default", nil, 0x00, false},
+		{"store and forward delivery receipt", "store_and_forward", "delivery_receipt", nil, 0x07, false},
+		{"datagram with UDHI", "datagram", "default", []string{"UDHI"}, 0x41, false},
+		{"forward with UDHI and reply path", "forward", "default", []string{"UDHI", "reply_path"}, 0xc2, false},
+		{"intermediate notification", "default", "intermed_deliv_notif", nil, 0x20, false},
+		{"unknown mode", "carrier_pigeon", "default", nil, 0, true},
+		{"unknown message type", "default", "receipt", nil, 0, true},
+		{"unknown feature", "default", "default", []string{"UDH"}, 0, true},
+		{"masks aren't values", "mask", "default", nil, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NewEsmClass(tt.mode, tt.messageType, tt.features...)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewEsmClass() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("NewEsmClass() = %#x, want %#x", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEsmClassAccessors(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name          string
+		esmClass      EsmClass
+		wantMode      string
+		wantType      string
+		wantUDHI      bool
+		wantReplyPath bool
+		wantIsReceipt bool
+	}{
+		{"default", 0x00, "default", "default", false, false, false},
+		{"delivery receipt", 0x04, "default", "delivery_receipt", false, false, true},
+		{"store and forward user ack with UDHI", 0x53, "store_and_forward", "user_ack", true, false, false},
+		{"datagram with reply path", 0x81, "datagram", "default", false, true, false},
+		{"reserved message type", 0x0c, "default", "0011", false, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.esmClass.MessagingMode(); got != tt.wantMode {
+				t.Errorf("MessagingMode() = %v, want %v", got, tt.wantMode)
+			}
+			if got := tt.esmClass.MessageType(); got != tt.wantType {
+				t.Errorf("MessageType() = %v, want %v", got, tt.wantType)
+			}
+			if got := tt.esmClass.HasUDHI(); got != tt.wantUDHI {
+				t.Errorf("HasUDHI() = %v, want %v", got, tt.wantUDHI)
+			}
+			if got := tt.esmClass.HasReplyPath(); got != tt.wantReplyPath {
+				t.Errorf("HasReplyPath() = %v, want %v", got, tt.wantReplyPath)
+			}
+			if got := tt.esmClass.IsDeliveryReceipt(); got != tt.wantIsReceipt {
+				t.Errorf("IsDeliveryReceipt() = %v, want %v", got, tt.wantIsReceipt)
+			}
+		})
+	}
+}
+
+func TestNewRegisteredDelivery(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name         string
+		receipt      string
+		ack          string
+		intermediate bool
+		want         RegisteredDelivery
+		wantErr      bool
+	}{
+		{"nothing requested", "nil", "nil", false, 0x00, false},
+		{"receipt always", "always", "nil", false, 0x01, false},
+		{"receipt on failure with delivery ack", "on_fail", "delivery", false, 0x06, false},
+		{"everything requested", "always", "delivery_and_user", true, 0x1d, false},
+		{"unknown receipt", "sometimes", "nil", false, 0, true},
+		{"unknown ack", "nil", "manager", false, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NewRegisteredDelivery(tt.receipt, tt.ack, tt.intermediate)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewRegisteredDelivery() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("NewRegisteredDelivery() = %#x, want %#x", got, tt.want)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got.Receipt() != tt.receipt || got.SmeAck() != tt.ack || got.IntermediateNotification() != tt.intermediate {
+				t.Errorf("Accessors aren't returning the constructor values : %v, %v, %v", got.Receipt(), got.SmeAck(), got.IntermediateNotification())
+			}
+		})
+	}
+}
+
+func TestParsedPduExposesDecodedBitfields(t *testing.T) {
+	t.Parallel()
+	esmClass, _ := NewEsmClass("store_and_forward", "default", "UDHI", "reply_path")
+	registeredDelivery, _ := NewRegisteredDelivery("on_fail", "user", true)
+	submitSm := NewSubmitSM().
+		WithEsmClass(esmClass).
+		WithRegisteredDelivery(registeredDelivery).
+		WithSequenceNumber(1)
+	pduBytes, err := EncodePdu(submitSm)
+	if err != nil {
+		t.Fatalf("Couldn't encode submit_sm : %v", err)
+	}
+	parsedPdu, err := ParsePdu(pduBytes)
+	if err != nil {
+		t.Fatalf("Couldn't parse submit_sm : %v", err)
+	}
+
+	actualEsmClass := parsedPdu.GetEsmClass()
+	if actualEsmClass != esmClass || actualEsmClass.MessagingMode() != "store_and_forward" || !actualEsmClass.HasUDHI() || !actualEsmClass.HasReplyPath() {
+		t.Errorf("esm_class wasn't decoded as expected : %#x", actualEsmClass)
+	}
+	actualRegisteredDelivery := parsedPdu.GetRegisteredDelivery()
+	if actualRegisteredDelivery != registeredDelivery || actualRegisteredDelivery.Receipt() != "on_fail" || actualRegisteredDelivery.SmeAck() != "user" || !actualRegisteredDelivery.IntermediateNotification() {
+		t.Errorf("registered_delivery wasn't decoded as expected : %#x", actualRegisteredDelivery)
+	}
+}
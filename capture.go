@@ -0,0 +1,554 @@
+package smpp
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// Directions of the captured PDUs, from the point of view of the ESME or
+// session capturing them.
+const (
+	Inbound  = "inbound"
+	Outbound = "outbound"
+)
+
+// CapturedPdu is a raw PDU as it went over the wire.  SystemId is the one a
+// session of the SMSC is bound as, empty otherwise.  CommandId and
+// SequenceNumber are decoded from Bytes for convenience.
+type CapturedPdu struct {
+	Time           time.Time `json:"time"`
+	Direction      string    `json:"direction"`
+	LocalAddr      string    `json:"local_addr"`
+	RemoteAddr     string    `json:"remote_addr"`
+	SystemId       string    `json:"system_id,omitempty"`
+	CommandId      string    `json:"command_id"`
+	SequenceNumber int       `json:"sequence_number"`
+	Bytes          []byte    `json:"pdu"`
+}
+
+// Capture records every raw PDU read or written by an ESME or the sessions
+// of an SMSC.  It's called from many goroutines at once, errors are logged.
+type Capture interface {
+	CapturePdu(pdu CapturedPdu) error
+}
+
+// SetCapture gives the Capture of the ESME, nil stopping the capture.  It
+// must be set before starting the control loop.
+func (e *ESME) SetCapture(capture Capture) {
+	e.capture = capture
+}
+
+func (e *ESME) capturePdu(direction string, pduBytes []byte) {
+	if e.capture == nil {
+		return
+	}
+	captured := CapturedPdu{
+		Time:       time.Now(),
+		Direction:  direction,
+		LocalAddr:  addrString(e.clientSocket.LocalAddr()),
+		RemoteAddr: addrString(e.clientSocket.RemoteAddr()),
+		Bytes:      pduBytes,
+	}
+	if header, err := parseHeader(pduBytes); err == nil {
+		captured.CommandId = header.CommandId
+		captured.SequenceNumber = header.SequenceNumber
+	}
+	if err := e.capture.CapturePdu(captured); err != nil {
+		e.logger.Warn("Couldn't capture the PDU", "direction", direction, "error", err)
+	}
+}
+
+func addrString(addr net.Addr) string {
+	if addr == nil {
+		return ""
+	}
+	return addr.String()
+}
+
+// sessionCapture adds the system_id of the session to what it captures.
+type sessionCapture struct {
+	Capture
+	session *Session
+}
+
+func (c sessionCapture) CapturePdu(pdu CapturedPdu) error {
+	pdu.SystemId = c.session.SystemId()
+	return c.Capture.CapturePdu(pdu)
+}
+
+// JSONLCapture writes the captured PDUs as JSON, one per line.
+type JSONLCapture struct {
+	mu      sync.Mutex
+	encoder *json.Encoder
+}
+
+func NewJSONLCapture(w io.Writer) *JSONLCapture {
+	return &JSONLCapture{encoder: json.NewEncoder(w)}
+}
+
+func (c *JSONLCapture) CapturePdu(pdu CapturedPdu) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.encoder.Encode(pdu)
+}
+
+// ReadJSONLCapture reads back the PDUs written by a JSONLCapture.
+func ReadJSONLCapture(r io.Reader) (capture []CapturedPdu, err error) {
+	decoder := json.NewDecoder(r)
+	for {
+		var pdu CapturedPdu
+		err = decoder.Decode(&pdu)
+		if errors.Is(err, io.EOF) {
+			return capture, nil
+		}
+		if err != nil {
+			return capture, fmt.Errorf("Couldn't read PDU %v of the capture : %w", len(capture)+1, err)
+		}
+		capture = append(capture, pdu)
+	}
+}
+
+const (
+	pcapMagic         = 0xa1b2c3d4
+	pcapLinkTypeRaw   = 101 // raw IPv4 or IPv6 packets
+	pcapSnapshotLen   = 262144
+	tcpFlagsPushAck   = 0x18
+	ipProtocolTcp     = 6
+	ipv4HeaderLength  = 20
+	ipv6HeaderLength  = 40
+	tcpHeaderLength   = 20
+	maxSegmentPayload = 65535 - ipv4HeaderLength - tcpHeaderLength // IP lengths are 16 bits
+)
+
+// PcapCapture writes the captured PDUs in the pcap format, each PDU in its
+// own TCP segment between the local and remote addresses so Wireshark's
+// SMPP dissector can decode them (use "Decode As..." for ports other than
+// 2775).  PDUs too large for an IP packet are split over several segments.
+// The IP and TCP headers are synthetic, there is no handshake.
+type PcapCapture struct {
+	mu        sync.Mutex
+	w         io.Writer
+	sequences map[[2]string]uint32 // next TCP sequence number by flow
+}
+
+// NewPcapCapture writes the pcap file header, use CreatePcapCapture for a
+// file.
+func NewPcapCapture(w io.Writer) (*PcapCapture, error) {
+	header := make([]byte, 24)
+	binary.LittleEndian.PutUint32(header[0:], pcapMagic)
+	binary.LittleEndian.PutUint16(header[4:], 2)
+	binary.LittleEndian.PutUint16(header[6:], 4)
+	binary.LittleEndian.PutUint32(header[16:], pcapSnapshotLen)
+	binary.LittleEndian.PutUint32(header[20:], pcapLinkTypeRaw)
+	if _, err := w.Write(header); err != nil {
+		return nil, fmt.Errorf("Couldn't write the pcap header : %w", err)
+	}
+	return &PcapCapture{w: w, sequences: map[[2]string]uint32{}}, nil
+}
+
+func (c *PcapCapture) CapturePdu(pdu CapturedPdu) error {
+	source, destination := pdu.LocalAddr, pdu.RemoteAddr
+	if pdu.Direction == Inbound {
+		source, destination = destination, source
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	flow, reverse := [2]string{source, destination}, [2]string{destination, source}
+	if _, ok := c.sequences[flow]; !ok {
+		c.sequences[flow] = 1
+	}
+	if _, ok := c.sequences[reverse]; !ok {
+		c.sequences[reverse] = 1
+	}
+	payload := pdu.Bytes
+	for {
+		segment := payload
+		if len(segment) > maxSegmentPayload {
+			segment = segment[:maxSegmentPayload]
+		}
+		payload = payload[len(segment):]
+		sequence := c.sequences[flow]
+		c.sequences[flow] += uint32(len(segment))
+		if err := c.writePacket(pdu.Time, tcpPacket(source, destination, sequence, c.sequences[reverse], segment)); err != nil {
+			return err
+		}
+		if len(payload) == 0 {
+			return nil
+		}
+	}
+}
+
+func (c *PcapCapture) writePacket(at time.Time, packet []byte) error {
+	record := make([]byte, 16, 16+len(packet))
+	binary.LittleEndian.PutUint32(record[0:], uint32(at.Unix()))
+	binary.LittleEndian.PutUint32(record[4:], uint32(at.Nanosecond()/1000))
+	binary.LittleEndian.PutUint32(record[8:], uint32(len(packet)))
+	binary.LittleEndian.PutUint32(record[12:], uint32(len(packet)))
+	_, err := c.w.Write(append(record, packet...))
+	return err
+}
+
+func tcpPacket(source string, destination string, sequence uint32, ack uint32, payload []byte) []byte {
+	sourceIp, sourcePort := splitCapturedAddr(source)
+	destinationIp, destinationPort := splitCapturedAddr(destination)
+	if sourceIp.To4() == nil || destinationIp.To4() == nil {
+		sourceIp, destinationIp = sourceIp.To16(), destinationIp.To16()
+	} else {
+		sourceIp, destinationIp = sourceIp.To4(), destinationIp.To4()
+	}
+
+	segment := make([]byte, tcpHeaderLength, tcpHeaderLength+len(payload))
+	binary.BigEndian.PutUint16(segment[0:], sourcePort)
+	binary.BigEndian.PutUint16(segment[2:], destinationPort)
+	binary.BigEndian.PutUint32(segment[4:], sequence)
+	binary.BigEndian.PutUint32(segment[8:], ack)
+	segment[12] = tcpHeaderLength / 4 << 4
+	segment[13] = tcpFlagsPushAck
+	binary.BigEndian.PutUint16(segment[14:], 65535)
+	segment = append(segment, payload...)
+
+	pseudoHeader := append(append([]byte{}, sourceIp...), destinationIp...)
+	pseudoHeader = append(pseudoHeader, 0, ipProtocolTcp, byte(len(segment)>>8), byte(len(segment)))
+	binary.BigEndian.PutUint16(segment[16:], checksum(pseudoHeader, segment))
+
+	if len(sourceIp) == net.IPv4len {
+		header := make([]byte, ipv4HeaderLength)
+		header[0] = 0x45
+		binary.BigEndian.PutUint16(header[2:], uint16(ipv4HeaderLength+len(segment)))
+		binary.BigEndian.PutUint16(header[6:], 0x4000) // don't fragment
+		header[8] = 64
+		header[9] = ipProtocolTcp
+		copy(header[12:], sourceIp)
+		copy(header[16:], destinationIp)
+		binary.BigEndian.PutUint16(header[10:], checksum(header))
+		return append(header, segment...)
+	}
+	header := make([]byte, ipv6HeaderLength)
+	header[0] = 0x60
+	binary.BigEndian.PutUint16(header[4:], uint16(len(segment)))
+	header[6] = ipProtocolTcp
+	header[7] = 64
+	copy(header[8:], sourceIp)
+	copy(header[24:], destinationIp)
+	return append(header, segment...)
+}
+
+// splitCapturedAddr gives the IP and port of a captured address, 0.0.0.0:0
+// for addresses which aren't IP ones (ie. net.Pipe).
+func splitCapturedAddr(addr string) (net.IP, uint16) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return net.IPv4zero, 0
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		ip = net.IPv4zero
+	}
+	var portNumber uint16
+	fmt.Sscan(port, &portNumber)
+	return ip, portNumber
+}
+
+func checksum(parts ...[]byte) uint16 {
+	var sum uint32
+	odd := false
+	for _, part := range parts {
+		for _, b := range part {
+			if odd {
+				sum += uint32(b)
+			} else {
+				sum += uint32(b) << 8
+			}
+			odd = !odd
+		}
+	}
+	for sum>>16 != 0 {
+		sum = sum&0xffff + sum>>16
+	}
+	return ^uint16(sum)
+}
+
+// CreatePcapCapture creates the pcap file, close the returned file once the
+// capture is over.
+func CreatePcapCapture(name string) (*PcapCapture, *os.File, error) {
+	file, err := os.Create(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	capture, err := NewPcapCapture(file)
+	if err != nil {
+		file.Close()
+		return nil, nil, err
+	}
+	return capture, file, nil
+}
+
+const (
+	pcapMagicNanoseconds = 0xa1b23c4d
+	pcapLinkTypeEthernet = 1
+	pcapLinkTypeLinuxSll = 113
+	ethernetHeaderLength = 14
+	linuxSllHeaderLength = 16
+)
+
+// ReadPcapCapture reads back the PDUs of a pcap file, the ones written by a
+// PcapCapture or captured on the wire over Ethernet or Linux "any".  The TCP
+// payloads of each flow are put back together in the order of the packets,
+// without handling retransmissions.  Directions are given from the point of
+// view of the SMSC : the side sending a bind is the ESME, or without any
+// bind the side sending the first PDU, and its PDUs are Inbound.
+func ReadPcapCapture(r io.Reader) ([]CapturedPdu, error) {
+	header := make([]byte, 24)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, fmt.Errorf("Couldn't read the pcap header : %w", err)
+	}
+	var order binary.ByteOrder = binary.LittleEndian
+	magic := order.Uint32(header)
+	if magic != pcapMagic && magic != pcapMagicNanoseconds {
+		order = binary.BigEndian
+		magic = order.Uint32(header)
+	}
+	if magic != pcapMagic && magic != pcapMagicNanoseconds {
+		return nil, fmt.Errorf("Not a pcap file, magic is %x", header[:4])
+	}
+	linkType := order.Uint32(header[20:])
+	reader := pcapReader{flows: map[[2]string][]byte{}}
+	record := make([]byte, 16)
+	for {
+		_, err := io.ReadFull(r, record)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Couldn't read pcap record %v : %w", reader.records+1, err)
+		}
+		fraction := time.Duration(order.Uint32(record[4:])) * time.Microsecond
+		if magic == pcapMagicNanoseconds {
+			fraction = time.Duration(order.Uint32(record[4:]))
+		}
+		captured := time.Unix(int64(order.Uint32(record)), int64(fraction))
+		frame := make([]byte, order.Uint32(record[8:]))
+		if _, err = io.ReadFull(r, frame); err != nil {
+			return nil, fmt.Errorf("Couldn't read pcap record %v : %w", reader.records+1, err)
+		}
+		reader.records++
+		packet, ok := linkPayload(frame, linkType)
+		if !ok {
+			continue
+		}
+		if err = reader.readPacket(captured, packet); err != nil {
+			return nil, fmt.Errorf("pcap record %v : %w", reader.records, err)
+		}
+	}
+	return reader.pdus(), nil
+}
+
+func linkPayload(frame []byte, linkType uint32) ([]byte, bool) {
+	switch linkType {
+	case pcapLinkTypeRaw:
+		return frame, true
+	case pcapLinkTypeEthernet:
+		if len(frame) < ethernetHeaderLength {
+			return nil, false
+		}
+		return frame[ethernetHeaderLength:], true
+	case pcapLinkTypeLinuxSll:
+		if len(frame) < linuxSllHeaderLength {
+			return nil, false
+		}
+		return frame[linuxSllHeaderLength:], true
+	}
+	return nil, false
+}
+
+// pcapReader puts back together the PDUs of every TCP flow of a pcap file.
+type pcapReader struct {
+	records  int
+	flows    map[[2]string][]byte // payload not yet decoded by source and destination
+	captured []CapturedPdu
+}
+
+func (p *pcapReader) readPacket(captured time.Time, packet []byte) error {
+	source, destination, payload, ok := tcpPayload(packet)
+	if !ok || len(payload) == 0 {
+		return nil
+	}
+	flow := [2]string{source, destination}
+	buffer := append(p.flows[flow], payload...)
+	for len(buffer) >= 4 {
+		length := int(binary.BigEndian.Uint32(buffer))
+		if length <= 4 || length > maxCommandLength {
+			return fmt.Errorf("Malformed PDU from %v to %v : %v", source, destination, buffer[:4])
+		}
+		if len(buffer) < length {
+			break
+		}
+		pdu := CapturedPdu{Time: captured, LocalAddr: destination, RemoteAddr: source, Bytes: buffer[:length:length]}
+		if header, err := parseHeader(pdu.Bytes); err == nil {
+			pdu.CommandId = header.CommandId
+			pdu.SequenceNumber = header.SequenceNumber
+		}
+		p.captured = append(p.captured, pdu)
+		buffer = buffer[length:]
+	}
+	p.flows[flow] = buffer
+	return nil
+}
+
+// pdus gives the PDUs captured with their direction, the ESME known.
+func (p *pcapReader) pdus() []CapturedPdu {
+	esmes := map[string]bool{}
+	for _, pdu := range p.captured {
+		if IsBindOperation(PDU{Header: Header{CommandId: pdu.CommandId}}) {
+			esmes[pdu.RemoteAddr] = true
+		}
+	}
+	firstSources := map[[2]string]string{}
+	for i, pdu := range p.captured {
+		connection := [2]string{pdu.RemoteAddr, pdu.LocalAddr}
+		if pdu.LocalAddr < pdu.RemoteAddr {
+			connection = [2]string{pdu.LocalAddr, pdu.RemoteAddr}
+		}
+		if _, ok := firstSources[connection]; !ok {
+			firstSources[connection] = pdu.RemoteAddr
+		}
+		fromEsme := esmes[pdu.RemoteAddr] || (!esmes[pdu.LocalAddr] && firstSources[connection] == pdu.RemoteAddr)
+		if fromEsme {
+			p.captured[i].Direction = Inbound
+		} else {
+			p.captured[i].Direction = Outbound
+			p.captured[i].LocalAddr, p.captured[i].RemoteAddr = pdu.RemoteAddr, pdu.LocalAddr
+		}
+	}
+	return p.captured
+}
+
+// tcpPayload gives the addresses and payload of an IPv4 or IPv6 TCP packet.
+func tcpPayload(packet []byte) (source string, destination string, payload []byte, ok bool) {
+	if len(packet) < 1 {
+		return "", "", nil, false
+	}
+	var sourceIp, destinationIp net.IP
+	var segment []byte
+	switch packet[0] >> 4 {
+	case 4:
+		if len(packet) < ipv4HeaderLength || packet[9] != ipProtocolTcp {
+			return "", "", nil, false
+		}
+		headerLength, totalLength := int(packet[0]&0x0f)*4, int(binary.BigEndian.Uint16(packet[2:]))
+		if totalLength > len(packet) || totalLength < headerLength {
+			totalLength = len(packet) // ie. TCP segmentation offload
+		}
+		sourceIp, destinationIp = net.IP(packet[12:16]), net.IP(packet[16:20])
+		segment = packet[headerLength:totalLength]
+	case 6:
+		if len(packet) < ipv6HeaderLength || packet[6] != ipProtocolTcp {
+			return "", "", nil, false
+		}
+		end := ipv6HeaderLength + int(binary.BigEndian.Uint16(packet[4:]))
+		if end > len(packet) {
+			end = len(packet)
+		}
+		sourceIp, destinationIp = net.IP(packet[8:24]), net.IP(packet[24:40])
+		segment = packet[ipv6HeaderLength:end]
+	default:
+		return "", "", nil, false
+	}
+	if len(segment) < tcpHeaderLength || int(segment[12]>>4)*4 > len(segment) {
+		return "", "", nil, false
+	}
+	source = net.JoinHostPort(sourceIp.String(), fmt.Sprint(binary.BigEndian.Uint16(segment)))
+	destination = net.JoinHostPort(destinationIp.String(), fmt.Sprint(binary.BigEndian.Uint16(segment[2:])))
+	return source, destination, segment[int(segment[12]>>4)*4:], true
+}
+
+// Replay feeds the raw PDUs of the capture going in the direction to the
+// connection, in their order, to see how a local SMSC or ESME reacts to
+// them.  With pace, the delays between the PDUs are kept.  The PDUs coming
+// back are read until nothing came for settle once the capture is fed, and
+// returned.  To replay into an ESME, give it one end of a net.Pipe and
+// Replay the other one.
+func Replay(conn net.Conn, capture []CapturedPdu, direction string, pace bool, settle time.Duration) ([]PDU, error) {
+	fed := make(chan struct{})
+	var feedErr error
+	go func() {
+		defer close(fed)
+		feedErr = feedCapture(conn, capture, direction, pace)
+	}()
+	replies, err := readReplies(conn, fed, settle)
+	if err != nil {
+		conn.SetWriteDeadline(time.Now()) // nobody reads what's left to feed
+	}
+	<-fed
+	if err == nil {
+		err = feedErr
+	}
+	return replies, err
+}
+
+func feedCapture(conn net.Conn, capture []CapturedPdu, direction string, pace bool) error {
+	var previous time.Time
+	for _, pdu := range capture {
+		if pdu.Direction != direction {
+			continue
+		}
+		if pace && !previous.IsZero() {
+			time.Sleep(pdu.Time.Sub(previous))
+		}
+		previous = pdu.Time
+		if _, err := conn.Write(pdu.Bytes); err != nil {
+			return fmt.Errorf("Couldn't replay %v %v : %w", pdu.CommandId, pdu.SequenceNumber, err)
+		}
+	}
+	return nil
+}
+
+// readReplies reads without ever losing bytes to a timeout, so it polls
+// every settle until the capture is fed.
+func readReplies(conn net.Conn, fed <-chan struct{}, settle time.Duration) ([]PDU, error) {
+	replies := []PDU{}
+	buffer := []byte{}
+	chunk := make([]byte, 4096)
+	for {
+		if err := conn.SetReadDeadline(time.Now().Add(settle)); err != nil {
+			return replies, err
+		}
+		n, err := conn.Read(chunk)
+		buffer = append(buffer, chunk[:n]...)
+		for len(buffer) >= 4 {
+			length := int(binary.BigEndian.Uint32(buffer))
+			if length <= 4 || length > maxCommandLength {
+				return replies, fmt.Errorf("Received malformed packet : %v", buffer[:4])
+			}
+			if len(buffer) < length {
+				break
+			}
+			pdu, parseErr := ParsePdu(buffer[:length])
+			if parseErr != nil {
+				return replies, parseErr
+			}
+			replies = append(replies, pdu)
+			buffer = buffer[length:]
+		}
+		var netErr net.Error
+		switch {
+		case errors.As(err, &netErr) && netErr.Timeout():
+			select {
+			case <-fed:
+				return replies, nil
+			default:
+			}
+		case isConnectionClosed(err):
+			return replies, nil
+		case err != nil:
+			return replies, err
+		}
+	}
+}
@@ -0,0 +1,263 @@
+package smpp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func captureBindAndSubmit(t *testing.T, capture Capture) {
+	smsc, err := GetSmscSimulatorServer()
+	if err != nil {
+		t.Fatalf("couldn't start server successfully: %v", err)
+	}
+	smsc.Capture = capture
+	smsc.Start()
+	Esme, err := InstantiateEsme(smsc.listeningSocket.Addr(), connType)
+	if err != nil {
+		t.Fatalf("couldn't connect client to server successfully: %v", err)
+	}
+	defer CloseAndAssertClean(smsc, Esme, t)
+	if _, err = Esme.BindTransmitter(validSystemID, validPassword); err != nil {
+		t.Fatalf("Couldn't bind with the SMSC : %v", err)
+	}
+	if _, err = Esme.sendAndWaitForResponse(NewSubmitSM().WithDestinationAddress("5551234").WithMessage("Hello")); err != nil {
+		t.Fatalf("Couldn't submit : %v", err)
+	}
+	if _, err = Esme.Unbind(); err != nil {
+		t.Fatalf("Couldn't unbind : %v", err)
+	}
+}
+
+func TestJSONLCaptureRecordsTheRawPdusOfTheSessions(t *testing.T) {
+	output := bytes.Buffer{}
+	captureBindAndSubmit(t, NewJSONLCapture(&output))
+
+	capture, err := ReadJSONLCapture(&output)
+	if err != nil {
+		t.Fatalf("Couldn't read the capture back : %v", err)
+	}
+	want := []struct {
+		direction string
+		commandId string
+		systemId  string
+	}{
+		{Inbound, "bind_transmitter", ""},
+		{Outbound, "bind_transmitter_resp", validSystemID},
+		{Inbound, "submit_sm", validSystemID},
+		{Outbound, "submit_sm_resp", validSystemID},
+		{Inbound, "unbind", validSystemID},
+	}
+	if len(capture) < len(want) {
+		t.Fatalf("Captured %v PDUs, want at least %v : %v", len(capture), len(want), capture)
+	}
+	for i, w := range want {
+		got := capture[i]
+		if got.Direction != w.direction || got.CommandId != w.commandId || got.SystemId != w.systemId {
+			t.Errorf("PDU %v captured as %v %v of %q, want %v %v of %q", i, got.Direction, got.CommandId, got.SystemId, w.direction, w.commandId, w.systemId)
+		}
+		if pdu, err := ParsePdu(got.Bytes); err != nil || pdu.Header.CommandId != w.commandId {
+			t.Errorf("PDU %v captured bytes don't decode to %v : %v %v", i, w.commandId, pdu, err)
+		}
+	}
+}
+
+func TestPcapCaptureFramesEachPduInATcpSegment(t *testing.T) {
+	output := bytes.Buffer{}
+	capture, err := NewPcapCapture(&output)
+	if err != nil {
+		t.Fatalf("Couldn't start the capture : %v", err)
+	}
+	enquireLink, _ := EncodePdu(NewEnquireLink().WithSequenceNumber(1))
+	captured := CapturedPdu{Time: time.Unix(1700000000, 5000), Direction: Inbound, LocalAddr: "10.0.0.1:2775", RemoteAddr: "10.0.0.2:40000", Bytes: enquireLink}
+	capture.CapturePdu(captured)
+	capture.CapturePdu(captured)
+
+	file := output.Bytes()
+	if magic, linkType := binary.LittleEndian.Uint32(file), binary.LittleEndian.Uint32(file[20:]); magic != pcapMagic || linkType != pcapLinkTypeRaw {
+		t.Fatalf("pcap header has magic %x and link type %v", magic, linkType)
+	}
+	records := file[24:]
+	packetLength := ipv4HeaderLength + tcpHeaderLength + len(enquireLink)
+	if len(records) != 2*(16+packetLength) {
+		t.Fatalf("pcap records are %v bytes long, want 2 of %v", len(records), 16+packetLength)
+	}
+	if seconds, micros := binary.LittleEndian.Uint32(records), binary.LittleEndian.Uint32(records[4:]); seconds != 1700000000 || micros != 5 {
+		t.Errorf("Record timestamp = %v.%06d", seconds, micros)
+	}
+	for i, record := range [][]byte{records[16 : 16+packetLength], records[32+packetLength:]} {
+		ip, tcp := record[:ipv4HeaderLength], record[ipv4HeaderLength:]
+		if !net.IP(ip[12:16]).Equal(net.ParseIP("10.0.0.2")) || binary.BigEndian.Uint16(tcp) != 40000 || binary.BigEndian.Uint16(tcp[2:]) != 2775 {
+			t.Errorf("Packet %v isn't from the remote end to the local one : %v", i, record[:ipv4HeaderLength+4])
+		}
+		if checksum(ip) != 0 {
+			t.Errorf("Packet %v has an invalid IP checksum", i)
+		}
+		if sequence := binary.BigEndian.Uint32(tcp[4:]); sequence != uint32(1+i*len(enquireLink)) {
+			t.Errorf("Packet %v has TCP sequence number %v", i, sequence)
+		}
+		if !bytes.Equal(tcp[tcpHeaderLength:], enquireLink) {
+			t.Errorf("Packet %v carries %v, want %v", i, tcp[tcpHeaderLength:], enquireLink)
+		}
+	}
+}
+
+func TestPcapCaptureIsReadBackFromTheSmscPointOfView(t *testing.T) {
+	output := bytes.Buffer{}
+	pcap, err := NewPcapCapture(&output)
+	if err != nil {
+		t.Fatalf("Couldn't start the capture : %v", err)
+	}
+	captureBindAndSubmit(t, pcap)
+
+	capture, err := ReadPcapCapture(&output)
+	if err != nil {
+		t.Fatalf("Couldn't read the capture back : %v", err)
+	}
+	want := []struct {
+		direction string
+		commandId string
+	}{
+		{Inbound, "bind_transmitter"},
+		{Outbound, "bind_transmitter_resp"},
+		{Inbound, "submit_sm"},
+		{Outbound, "submit_sm_resp"},
+		{Inbound, "unbind"},
+	}
+	if len(capture) < len(want) {
+		t.Fatalf("Read %v PDUs, want at least %v : %v", len(capture), len(want), capture)
+	}
+	for i, w := range want {
+		got := capture[i]
+		if got.Direction != w.direction || got.CommandId != w.commandId {
+			t.Errorf("PDU %v read as %v %v, want %v %v", i, got.Direction, got.CommandId, w.direction, w.commandId)
+		}
+		if got.LocalAddr != capture[0].LocalAddr || got.RemoteAddr != capture[0].RemoteAddr {
+			t.Errorf("PDU %v read between %v and %v, want %v and %v", i, got.LocalAddr, got.RemoteAddr, capture[0].LocalAddr, capture[0].RemoteAddr)
+		}
+	}
+}
+
+func TestReadPcapCapturePutsBackPdusSplitOverSegments(t *testing.T) {
+	output := bytes.Buffer{}
+	capture, err := NewPcapCapture(&output)
+	if err != nil {
+		t.Fatalf("Couldn't start the capture : %v", err)
+	}
+	enquireLink, _ := EncodePdu(NewEnquireLink().WithSequenceNumber(7))
+	bind, _ := EncodePdu(NewBindTransmitter().WithSystemId(validSystemID).WithPassword(validPassword).WithSequenceNumber(1))
+	stream := append(append([]byte{}, bind...), enquireLink...)
+	segment := CapturedPdu{Time: time.Unix(1700000000, 0), Direction: Outbound, LocalAddr: "[::1]:40000", RemoteAddr: "[::1]:2775"}
+	for _, part := range [][]byte{stream[:10], stream[10 : len(bind)+3], stream[len(bind)+3:]} {
+		segment.Bytes = part
+		capture.CapturePdu(segment)
+	}
+
+	read, err := ReadPcapCapture(&output)
+	if err != nil {
+		t.Fatalf("Couldn't read the capture back : %v", err)
+	}
+	if len(read) != 2 || read[0].CommandId != "bind_transmitter" || read[1].CommandId != "enquire_link" || read[1].SequenceNumber != 7 {
+		t.Fatalf("Read %v, want the bind_transmitter and enquire_link", read)
+	}
+	if read[0].Direction != Inbound || read[0].RemoteAddr != "[::1]:40000" || !bytes.Equal(read[0].Bytes, bind) {
+		t.Errorf("Read %v %v from %v, want the bind from the ESME", read[0].Direction, read[0].Bytes, read[0].RemoteAddr)
+	}
+}
+
+func TestPcapCaptureSplitsPdusLargerThanAnIpPacket(t *testing.T) {
+	output := bytes.Buffer{}
+	capture, err := NewPcapCapture(&output)
+	if err != nil {
+		t.Fatalf("Couldn't start the capture : %v", err)
+	}
+	submitSm := NewSubmitSM().WithDestinationAddress("5551234").WithSequenceNumber(1)
+	empty, _ := EncodePdu(submitSm)
+	messagePayload, err := NewOptionalParameter("message_payload", strings.Repeat("61", maxCommandLength-len(empty)-4))
+	if err != nil {
+		t.Fatalf("Couldn't build the message_payload : %v", err)
+	}
+	pduBytes, err := EncodePdu(submitSm.WithOptionalParameter(messagePayload))
+	if err != nil || len(pduBytes) != maxCommandLength {
+		t.Fatalf("Encoded a submit_sm of %v bytes : %v", len(pduBytes), err)
+	}
+	captured := CapturedPdu{Time: time.Unix(1700000000, 0), Direction: Inbound, LocalAddr: "10.0.0.1:2775", RemoteAddr: "10.0.0.2:40000", Bytes: pduBytes}
+	if err = capture.CapturePdu(captured); err != nil {
+		t.Fatalf("Couldn't capture the submit_sm : %v", err)
+	}
+
+	records := output.Bytes()[24:]
+	first := records[16 : 16+binary.LittleEndian.Uint32(records[8:])]
+	second := records[32+len(first):]
+	if len(first) != 65535 || binary.BigEndian.Uint16(first[2:]) != 65535 || len(second) != ipv4HeaderLength+tcpHeaderLength+len(pduBytes)-maxSegmentPayload {
+		t.Errorf("Captured packets of %v and %v bytes", len(first), len(second))
+	}
+	if sequence := binary.BigEndian.Uint32(second[ipv4HeaderLength+4:]); sequence != 1+maxSegmentPayload {
+		t.Errorf("Second segment has TCP sequence number %v", sequence)
+	}
+	read, err := ReadPcapCapture(&output)
+	if err != nil || len(read) != 1 || !bytes.Equal(read[0].Bytes, pduBytes) {
+		t.Errorf("Read %v PDUs back, %v", len(read), err)
+	}
+}
+
+func TestReadPcapCaptureRefusesOtherFiles(t *testing.T) {
+	if _, err := ReadPcapCapture(bytes.NewReader([]byte(`{"time":"2023-11-14T22:13:20Z","direction":"inbound"}`))); err == nil {
+		t.Errorf("Read a JSONL capture as a pcap file")
+	}
+}
+
+func TestReplayFeedsACaptureToAnSmsc(t *testing.T) {
+	output := bytes.Buffer{}
+	captureBindAndSubmit(t, NewJSONLCapture(&output))
+	capture, err := ReadJSONLCapture(&output)
+	if err != nil {
+		t.Fatalf("Couldn't read the capture back : %v", err)
+	}
+	assertReplayIsAnswered(t, capture)
+}
+
+func TestReplayFeedsAPcapCaptureToAnSmsc(t *testing.T) {
+	output := bytes.Buffer{}
+	pcap, err := NewPcapCapture(&output)
+	if err != nil {
+		t.Fatalf("Couldn't start the capture : %v", err)
+	}
+	captureBindAndSubmit(t, pcap)
+	capture, err := ReadPcapCapture(&output)
+	if err != nil {
+		t.Fatalf("Couldn't read the capture back : %v", err)
+	}
+	assertReplayIsAnswered(t, capture)
+}
+
+func assertReplayIsAnswered(t *testing.T, capture []CapturedPdu) {
+	t.Helper()
+	smsc, err := StartSmscSimulatorServerAndAccept()
+	if err != nil {
+		t.Fatalf("couldn't start server successfully: %v", err)
+	}
+	defer smsc.Close()
+	conn, err := net.Dial(connType, smsc.listeningSocket.Addr().String())
+	if err != nil {
+		t.Fatalf("Couldn't connect to the SMSC : %v", err)
+	}
+	defer conn.Close()
+
+	replies, err := Replay(conn, capture, Inbound, false, 100*time.Millisecond)
+	if err != nil {
+		t.Fatalf("Couldn't replay : %v", err)
+	}
+	want := []string{"bind_transmitter_resp", "submit_sm_resp", "unbind_resp"}
+	if len(replies) != len(want) {
+		t.Fatalf("Replay got %v, want %v", replies, want)
+	}
+	for i := range want {
+		if replies[i].Header.CommandId != want[i] || replies[i].Header.CommandStatus != ESME_ROK {
+			t.Errorf("Reply %v = %v %v, want %v", i, replies[i].Header.CommandId, replies[i].Header.CommandStatus, want[i])
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package smpp
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock gives the time to the SMSC.  Tests replace it with a FakeClock to
+// fast-forward through scheduled deliveries and validity periods.
+type Clock interface {
+	Now() time.Time
+	AfterFunc(d time.Duration, f func()) Timer
+}
+
+type Timer interface {
+	Stop() bool
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) AfterFunc(d time.Duration, f func()) Timer {
+	return time.AfterFunc(d, f)
+}
+
+// FakeClock only moves forward when told to.  Timers due when advancing the
+// clock are run in order, on the goroutine calling Advance, with the clock
+// set to their due time.
+type FakeClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers []*fakeTimer
+}
+
+type fakeTimer struct {
+	clock *FakeClock
+	when  time.Time
+	f     func()
+}
+
+func NewFakeClock(now time.Time) *FakeClock {
+	return &FakeClock{now: now}
+}
+
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// AfterFunc runs f on its own goroutine when d isn't positive, like
+// time.AfterFunc would.
+func (c *FakeClock) AfterFunc(d time.Duration, f func()) Timer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	timer := &fakeTimer{clock: c, when: c.now.Add(d), f: f}
+	if d <= 0 {
+		go f()
+		return timer
+	}
+	c.timers = append(c.timers, timer)
+	return timer
+}
+
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	target := c.now.Add(d)
+	for {
+		timer := c.nextTimerDueBy(target)
+		if timer == nil {
+			break
+		}
+		c.removeTimer(timer)
+		if timer.when.After(c.now) {
+			c.now = timer.when
+		}
+		c.mu.Unlock()
+		timer.f()
+		c.mu.Lock()
+	}
+	c.now = target
+	c.mu.Unlock()
+}
+
+func (c *FakeClock) nextTimerDueBy(target time.Time) (next *fakeTimer) {
+	for _, timer := range c.timers {
+		if !timer.when.After(target) && (next == nil || timer.when.Before(next.when)) {
+			next = timer
+		}
+	}
+	return next
+}
+
+func (c *FakeClock) removeTimer(timer *fakeTimer) bool {
+	for i, t := range c.timers {
+		if t == timer {
+			c.timers = append(c.timers[:i], c.timers[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+func (t *fakeTimer) Stop() bool {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+	return t.clock.removeTimer(t)
+}
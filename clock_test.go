@@ -0,0 +1,36 @@
+package smpp
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestFakeClockRunsDueTimersInOrder(t *testing.T) {
+	t.Parallel()
+	clock := NewFakeClock(smppTimeReference)
+	fired := []string{}
+	record := func(name string) func() {
+		return func() { fired = append(fired, name+" at "+clock.Now().Sub(smppTimeReference).String()) }
+	}
+	clock.AfterFunc(3*time.Minute, record("third"))
+	clock.AfterFunc(time.Minute, func() {
+		record("first")()
+		clock.AfterFunc(time.Minute, record("second"))
+	})
+	stopped := clock.AfterFunc(2*time.Minute, record("stopped"))
+	clock.AfterFunc(time.Hour, record("later"))
+	if !stopped.Stop() || stopped.Stop() {
+		t.Errorf("Stop() should only report the first stop of a pending timer")
+	}
+
+	clock.Advance(5 * time.Minute)
+
+	want := []string{"first at 1m0s", "second at 2m0s", "third at 3m0s"}
+	if !reflect.DeepEqual(fired, want) {
+		t.Errorf("Timers fired = %v, want %v", fired, want)
+	}
+	if !clock.Now().Equal(smppTimeReference.Add(5 * time.Minute)) {
+		t.Errorf("Now() = %v after advancing 5 minutes", clock.Now())
+	}
+}
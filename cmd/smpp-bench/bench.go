@@ -0,0 +1,340 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/elafontaine/smpp"
+)
+
+// session is one bound ESME submitting within its window.
+type session struct {
+	esme    *smpp.ESME
+	window  chan struct{}
+	unbound chan struct{}
+
+	// mu is held while sending so the submit_sm is pending before its
+	// response is handled.
+	mu      sync.Mutex
+	pending map[int]time.Time
+}
+
+// receiptTracker matches the delivery receipts to the submit_sm they are
+// for.  A receipt can come to any session bound as the same system_id, even
+// before the submit_sm_resp is handled by its own session.
+type receiptTracker struct {
+	mu      sync.Mutex
+	pending map[string]time.Time
+	early   map[string]time.Time
+}
+
+type benchmark struct {
+	options     options
+	source      smpp.Address
+	destination smpp.Address
+	stats       *stats
+	receipts    *receiptTracker
+	stop        chan struct{}
+	stopOnce    sync.Once
+	sent        atomic.Int64
+}
+
+func bench(o options) (Report, error) {
+	b := &benchmark{
+		options:  o,
+		stats:    newStats(),
+		receipts: &receiptTracker{pending: map[string]time.Time{}, early: map[string]time.Time{}},
+		stop:     make(chan struct{}),
+	}
+	var err error
+	if o.source != "" {
+		if b.source, err = smpp.NewAddress(o.source); err != nil {
+			return Report{}, fmt.Errorf("Invalid source : %v", err)
+		}
+	}
+	if b.destination, err = smpp.NewAddress(o.dest); err != nil {
+		return Report{}, fmt.Errorf("Invalid destination : %v", err)
+	}
+	sessions := []*session{}
+	defer func() {
+		for _, s := range sessions {
+			s.unbind(o.timeout)
+			s.esme.Close()
+		}
+	}()
+	for i := 0; i < o.sessions; i++ {
+		s, err := b.openSession()
+		if err != nil {
+			return Report{}, fmt.Errorf("Couldn't open session %v : %v", i+1, err)
+		}
+		sessions = append(sessions, s)
+	}
+
+	start := time.Now()
+	tokens := b.pace()
+	submitters := sync.WaitGroup{}
+	for i, s := range sessions {
+		submitters.Add(1)
+		go func(s *session, seed int64) {
+			defer submitters.Done()
+			b.submit(s, tokens, rand.New(rand.NewSource(seed)))
+		}(s, start.UnixNano()+int64(i))
+	}
+	select {
+	case <-time.After(o.duration):
+		b.halt()
+	case <-b.stop:
+	}
+	submitters.Wait()
+	elapsed := time.Since(start)
+
+	drainStart := time.Now()
+	waitFor(o.timeout, func() bool {
+		for _, s := range sessions {
+			if s.outstanding() > 0 {
+				return false
+			}
+		}
+		return true
+	})
+	drain := time.Since(drainStart)
+	if o.receipts {
+		waitFor(o.receiptWait, func() bool { return b.receipts.outstanding() == 0 })
+	}
+	return b.stats.report(o.sessions, elapsed, drain, o.receipts), nil
+}
+
+func (b *benchmark) openSession() (*session, error) {
+	esme, err := connect(b.options)
+	if err != nil {
+		return nil, err
+	}
+	var resp *smpp.PDU
+	if b.options.receipts {
+		resp, err = esme.BindTransceiver(b.options.systemId, b.options.password)
+	} else {
+		resp, err = esme.BindTransmitter(b.options.systemId, b.options.password)
+	}
+	if err != nil {
+		esme.Close()
+		if resp != nil {
+			return nil, fmt.Errorf("Couldn't bind : %v (%v)", resp.Header.CommandStatus, err)
+		}
+		return nil, fmt.Errorf("Couldn't bind : %v", err)
+	}
+	s := &session{
+		esme:    esme,
+		window:  make(chan struct{}, b.options.window),
+		unbound: make(chan struct{}, 1),
+		pending: map[int]time.Time{},
+	}
+	esme.CommandFunctions["submit_sm_resp"] = b.handleResponse(s)
+	esme.CommandFunctions["generic_nack"] = b.handleResponse(s)
+	esme.CommandFunctions["deliver_sm"] = b.handleDeliverSm
+	esme.CommandFunctions["unbind_resp"] = func(*smpp.ESME, smpp.PDU) error {
+		select {
+		case s.unbound <- struct{}{}:
+		default:
+		}
+		return nil
+	}
+	esme.StartControlLoop()
+	return s, nil
+}
+
+// pace hands out a token per submit_sm at the target rate, or never runs out
+// of them without one.  Tokens aren't saved up while the windows are full.
+func (b *benchmark) pace() chan struct{} {
+	tokens := make(chan struct{}, b.options.sessions)
+	if b.options.tps == 0 {
+		close(tokens)
+		return tokens
+	}
+	interval := time.Duration(float64(time.Second) / b.options.tps)
+	if interval < time.Millisecond {
+		interval = time.Millisecond
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		start, handedOut := time.Now(), 0
+		for {
+			select {
+			case now := <-ticker.C:
+				// Ticks come late or get dropped, the tokens are counted out
+				// of the time elapsed.
+				for due := int(now.Sub(start).Seconds() * b.options.tps); handedOut < due; handedOut++ {
+					select {
+					case tokens <- struct{}{}:
+					default:
+					}
+				}
+			case <-b.stop:
+				return
+			}
+		}
+	}()
+	return tokens
+}
+
+func (b *benchmark) halt() {
+	b.stopOnce.Do(func() { close(b.stop) })
+}
+
+func (b *benchmark) submit(s *session, tokens chan struct{}, random *rand.Rand) {
+	for {
+		select {
+		case <-tokens:
+		case <-b.stop:
+			return
+		}
+		select {
+		case s.window <- struct{}{}:
+		case <-b.stop:
+			return
+		}
+		if b.options.count > 0 && b.sent.Add(1) > int64(b.options.count) {
+			<-s.window
+			b.halt()
+			return
+		}
+		submitSm := b.buildSubmitSm(b.options.mix.pick(random))
+		if err := s.send(&submitSm); err != nil {
+			<-s.window
+			b.stats.sendFailed()
+			continue
+		}
+		b.stats.submitted()
+	}
+}
+
+func (b *benchmark) buildSubmitSm(kind messageKind) smpp.PDU {
+	submitSm := smpp.NewSubmitSM().
+		WithSource(b.source).
+		WithDestination(b.destination).
+		WithDataCoding(kind.dataCoding).
+		WithMessage(kind.text)
+	if b.options.receipts {
+		registeredDelivery, _ := smpp.NewRegisteredDelivery("always", "nil", false)
+		submitSm = submitSm.WithRegisteredDelivery(registeredDelivery)
+	}
+	return submitSm
+}
+
+func (b *benchmark) handleResponse(s *session) func(*smpp.ESME, smpp.PDU) error {
+	return func(_ *smpp.ESME, pdu smpp.PDU) error {
+		sentAt, ok := s.answered(pdu.Header.SequenceNumber)
+		if !ok {
+			return nil
+		}
+		b.stats.responded(pdu.Header.CommandStatus, time.Since(sentAt))
+		messageId, _ := pdu.Body.MandatoryParameter["message_id"].(string)
+		if b.options.receipts && pdu.Header.CommandStatus == smpp.ESME_ROK {
+			if latency, received := b.receipts.accepted(messageId, sentAt); received {
+				b.stats.receiptReceived(latency)
+			}
+		}
+		return nil
+	}
+}
+
+func (b *benchmark) handleDeliverSm(e *smpp.ESME, pdu smpp.PDU) error {
+	resp := smpp.NewDeliverSMResp().WithMessageId("").WithSequenceNumber(pdu.Header.SequenceNumber)
+	if _, err := e.Send(&resp); err != nil {
+		return err
+	}
+	if !smpp.IsDeliveryReceipt(pdu) {
+		return nil
+	}
+	dlr, err := smpp.ParseDeliveryReceipt(pdu)
+	if err != nil {
+		return nil
+	}
+	if latency, matched := b.receipts.received(dlr.MessageId); matched {
+		b.stats.receiptReceived(latency)
+	}
+	return nil
+}
+
+// send gives the submit_sm the next sequence number of the ESME and records
+// it as pending.
+func (s *session) send(submitSm *smpp.PDU) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sentAt := time.Now()
+	sequenceNumber, err := s.esme.Send(submitSm)
+	if err != nil {
+		return err
+	}
+	s.pending[sequenceNumber] = sentAt
+	return nil
+}
+
+// answered frees the window slot of the submit_sm and gives when it was sent.
+func (s *session) answered(sequenceNumber int) (time.Time, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sentAt, ok := s.pending[sequenceNumber]
+	if ok {
+		delete(s.pending, sequenceNumber)
+		<-s.window
+	}
+	return sentAt, ok
+}
+
+func (s *session) outstanding() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.pending)
+}
+
+func (s *session) unbind(timeout time.Duration) {
+	unbindPdu := smpp.NewUnbind()
+	if _, err := s.esme.Send(&unbindPdu); err != nil {
+		return
+	}
+	select {
+	case <-s.unbound:
+	case <-time.After(timeout):
+	}
+}
+
+// accepted waits for the receipt of the message, or gives its latency when
+// the receipt came first.
+func (r *receiptTracker) accepted(messageId string, sentAt time.Time) (time.Duration, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if receivedAt, ok := r.early[messageId]; ok {
+		delete(r.early, messageId)
+		return receivedAt.Sub(sentAt), true
+	}
+	r.pending[messageId] = sentAt
+	return 0, false
+}
+
+func (r *receiptTracker) received(messageId string) (time.Duration, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if sentAt, ok := r.pending[messageId]; ok {
+		delete(r.pending, messageId)
+		return time.Since(sentAt), true
+	}
+	r.early[messageId] = time.Now()
+	return 0, false
+}
+
+func (r *receiptTracker) outstanding() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.pending)
+}
+
+func waitFor(timeout time.Duration, done func() bool) {
+	deadline := time.Now().Add(timeout)
+	for !done() && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+}
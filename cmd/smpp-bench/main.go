@@ -0,0 +1,134 @@
+// Command smpp-bench loads an SMSC with submit_sm over several sessions and
+// reports the throughput, the command_status of the responses and the
+// submit_sm to submit_sm_resp latency percentiles.
+//
+//	smpp-bench -addr localhost:2775 -system-id SystemId -password Password \
+//		-sessions 4 -tps 200 -window 10 -duration 30s -mix gsm=8,ucs2=1,long=1 -receipts
+//
+// With -receipts, delivery receipts are requested and the sessions bind as
+// transceivers to measure the submit_sm to receipt latency as well.
+package main
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/elafontaine/smpp"
+)
+
+type options struct {
+	addr        string
+	systemId    string
+	password    string
+	useTLS      bool
+	tlsInsecure bool
+	sessions    int
+	tps         float64
+	window      int
+	duration    time.Duration
+	count       int
+	mix         mixFlag
+	source      string
+	dest        string
+	receipts    bool
+	timeout     time.Duration
+	receiptWait time.Duration
+	output      string
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdout io.Writer, stderr io.Writer) int {
+	flags := flag.NewFlagSet("smpp-bench", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	o := options{mix: defaultMix()}
+	flags.StringVar(&o.addr, "addr", "localhost:2775", "SMSC address as host:port")
+	flags.StringVar(&o.systemId, "system-id", "", "system_id to bind with")
+	flags.StringVar(&o.password, "password", "", "password to bind with")
+	flags.BoolVar(&o.useTLS, "tls", false, "connect over TLS")
+	flags.BoolVar(&o.tlsInsecure, "tls-insecure", false, "don't verify the certificate of the SMSC")
+	flags.IntVar(&o.sessions, "sessions", 1, "number of sessions to bind")
+	flags.Float64Var(&o.tps, "tps", 100, "target submit_sm per second over all the sessions, 0 for as fast as the windows allow")
+	flags.IntVar(&o.window, "window", 10, "maximum submit_sm waiting for their response, per session")
+	flags.DurationVar(&o.duration, "duration", 10*time.Second, "how long to submit for")
+	flags.IntVar(&o.count, "count", 0, "stop after that many submit_sm, when positive")
+	flags.Var(&o.mix, "mix", "message mix as kind=weight, out of "+kindNames())
+	flags.StringVar(&o.source, "source", "", "source_addr")
+	flags.StringVar(&o.dest, "dest", "15550000000", "destination_addr")
+	flags.BoolVar(&o.receipts, "receipts", false, "request delivery receipts and measure their latency")
+	flags.DurationVar(&o.timeout, "timeout", 10*time.Second, "how long to wait for the bind responses and the last submit_sm_resp")
+	flags.DurationVar(&o.receiptWait, "receipt-timeout", 30*time.Second, "how long to wait for the last delivery receipts")
+	flags.StringVar(&o.output, "output", "text", "text or json")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if o.output != "text" && o.output != "json" {
+		fmt.Fprintf(stderr, "Unknown output %q, use text or json\n", o.output)
+		return 2
+	}
+	if o.sessions < 1 || o.window < 1 || o.tps < 0 {
+		fmt.Fprintln(stderr, "-sessions and -window must be positive, -tps can't be negative")
+		return 2
+	}
+
+	report, err := bench(o)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	printReport(stdout, o.output, report)
+	return 0
+}
+
+func connect(o options) (*smpp.ESME, error) {
+	if !o.useTLS {
+		serverAddress, err := net.ResolveTCPAddr("tcp", o.addr)
+		if err != nil {
+			return nil, err
+		}
+		return smpp.InstantiateEsme(serverAddress, "tcp")
+	}
+	host, _, _ := net.SplitHostPort(o.addr)
+	dialer := &net.Dialer{Timeout: o.timeout}
+	conn, err := tls.DialWithDialer(dialer, "tcp", o.addr, &tls.Config{ServerName: host, InsecureSkipVerify: o.tlsInsecure})
+	if err != nil {
+		return nil, err
+	}
+	return smpp.NewEsme(conn), nil
+}
+
+func printReport(w io.Writer, output string, report Report) {
+	if output == "json" {
+		json.NewEncoder(w).Encode(report)
+		return
+	}
+	fmt.Fprintf(w, "sessions: %v duration: %.2fs drain: %.2fs\n", report.Sessions, report.DurationSeconds, report.DrainSeconds)
+	fmt.Fprintf(w, "sent: %v (%.1f/s) send errors: %v responses: %v unanswered: %v\n",
+		report.Sent, report.SentPerSecond, report.SendErrors, report.Responses, report.Unanswered)
+	fmt.Fprintf(w, "throughput: %.1f accepted/s\n", report.Throughput)
+	statuses := make([]string, 0, len(report.Statuses))
+	for status := range report.Statuses {
+		statuses = append(statuses, status)
+	}
+	sort.Strings(statuses)
+	for _, status := range statuses {
+		fmt.Fprintf(w, "  %v: %v\n", status, report.Statuses[status])
+	}
+	fmt.Fprintf(w, "submit_sm_resp latency: %v\n", report.SubmitLatency)
+	if report.ReceiptLatency != nil {
+		fmt.Fprintf(w, "receipts: %v latency: %v\n", report.Receipts, *report.ReceiptLatency)
+	}
+}
+
+func (l Latencies) String() string {
+	return fmt.Sprintf("p50=%vms p95=%vms p99=%vms max=%vms", l.P50, l.P95, l.P99, l.Max)
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"math/rand"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/elafontaine/smpp"
+)
+
+func startSmsc(t *testing.T, configure ...func(*smpp.SMSC)) (*smpp.SMSC, string) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Couldn't listen : %v", err)
+	}
+	smsc := smpp.NewSMSC(&listener, "SystemId", "Password")
+	smsc.DeliveryReceiptDelay = 10 * time.Millisecond
+	for _, apply := range configure {
+		apply(smsc)
+	}
+	smsc.Start()
+	t.Cleanup(smsc.Close)
+	return smsc, listener.Addr().String()
+}
+
+func TestBenchReportsResponsesAndReceipts(t *testing.T) {
+	smsc, addr := startSmsc(t)
+	stdout, stderr := bytes.Buffer{}, bytes.Buffer{}
+
+	code := run([]string{
+		"-addr", addr, "-system-id", "SystemId", "-password", "Password",
+		"-sessions", "2", "-tps", "0", "-window", "5", "-count", "40",
+		"-mix", "gsm=2,ucs2=1,long=1,binary=1", "-receipts", "-output", "json",
+	}, &stdout, &stderr)
+
+	if code != 0 {
+		t.Fatalf("Exited with %v : %v %v", code, stdout.String(), stderr.String())
+	}
+	var report Report
+	if err := json.Unmarshal(stdout.Bytes(), &report); err != nil {
+		t.Fatalf("Couldn't decode the output %q : %v", stdout.String(), err)
+	}
+	if report.Sessions != 2 || report.Sent != 40 || report.Responses != 40 || report.Unanswered != 0 ||
+		report.Statuses[smpp.ESME_ROK] != 40 || report.Throughput <= 0 {
+		t.Errorf("Reported %+v", report)
+	}
+	if report.SubmitLatency.P50 <= 0 || report.SubmitLatency.P50 > report.SubmitLatency.P99 {
+		t.Errorf("Submit latencies are %+v", report.SubmitLatency)
+	}
+	if report.Receipts != 40 || report.ReceiptLatency == nil || report.ReceiptLatency.P50 < 10 {
+		t.Errorf("Reported %v receipts with latencies %+v", report.Receipts, report.ReceiptLatency)
+	}
+	if messages, _ := smsc.MessageStore.List(); len(messages) != 40 {
+		t.Errorf("SMSC stored %v messages", len(messages))
+	}
+}
+
+func TestBenchBreaksDownTheErrorStatuses(t *testing.T) {
+	_, addr := startSmsc(t, func(smsc *smpp.SMSC) {
+		smsc.InboundInterceptors = append(smsc.InboundInterceptors, func(e *smpp.ESME, pdu smpp.PDU, next smpp.PduHandler) error {
+			if pdu.Header.CommandId == "submit_sm" && pdu.Header.SequenceNumber%2 == 0 {
+				return smpp.RejectPdu(pdu, smpp.ESME_RTHROTTLED)
+			}
+			return next(e, pdu)
+		})
+	})
+	stdout, stderr := bytes.Buffer{}, bytes.Buffer{}
+
+	code := run([]string{
+		"-addr", addr, "-system-id", "SystemId", "-password", "Password",
+		"-tps", "200", "-window", "1", "-count", "10",
+	}, &stdout, &stderr)
+
+	if code != 0 {
+		t.Fatalf("Exited with %v : %v %v", code, stdout.String(), stderr.String())
+	}
+	for _, line := range []string{"sent: 10 ", "  ESME_ROK: 5\n", "  ESME_RTHROTTLED: 5\n", "submit_sm_resp latency: p50="} {
+		if !strings.Contains(stdout.String(), line) {
+			t.Errorf("%q missing from the report :\n%v", line, stdout.String())
+		}
+	}
+}
+
+func TestBenchTimesTheSubmissionsApartFromTheDrain(t *testing.T) {
+	_, addr := startSmsc(t, func(smsc *smpp.SMSC) {
+		smsc.OutboundInterceptors = append(smsc.OutboundInterceptors, func(e *smpp.ESME, pdu smpp.PDU, next smpp.PduHandler) error {
+			if pdu.Header.CommandId == "submit_sm_resp" {
+				time.Sleep(300 * time.Millisecond)
+			}
+			return next(e, pdu)
+		})
+	})
+	stdout, stderr := bytes.Buffer{}, bytes.Buffer{}
+
+	code := run([]string{
+		"-addr", addr, "-system-id", "SystemId", "-password", "Password",
+		"-tps", "0", "-window", "5", "-count", "1", "-output", "json",
+	}, &stdout, &stderr)
+
+	if code != 0 {
+		t.Fatalf("Exited with %v : %v %v", code, stdout.String(), stderr.String())
+	}
+	var report Report
+	if err := json.Unmarshal(stdout.Bytes(), &report); err != nil {
+		t.Fatalf("Couldn't decode the output %q : %v", stdout.String(), err)
+	}
+	if report.Responses != 1 || report.DurationSeconds >= 0.2 || report.DrainSeconds < 0.2 {
+		t.Errorf("Reported %v responses in %vs with a drain of %vs", report.Responses, report.DurationSeconds, report.DrainSeconds)
+	}
+	if accepted := report.Throughput * (report.DurationSeconds + report.DrainSeconds); math.Abs(accepted-1) > 0.01 {
+		t.Errorf("Reported a throughput of %v/s for 1 message accepted in %vs", report.Throughput, report.DurationSeconds+report.DrainSeconds)
+	}
+}
+
+func TestBenchRefusesBadOptions(t *testing.T) {
+	for _, args := range [][]string{
+		{"-mix", "mms=1"},
+		{"-mix", "gsm=0"},
+		{"-sessions", "0"},
+		{"-output", "xml"},
+	} {
+		if code := run(args, &bytes.Buffer{}, &bytes.Buffer{}); code != 2 {
+			t.Errorf("Exited with %v for %v", code, args)
+		}
+	}
+}
+
+func TestPercentilesUseTheNearestRank(t *testing.T) {
+	durations := []time.Duration{}
+	for i := 100; i > 0; i-- {
+		durations = append(durations, time.Duration(i)*time.Millisecond)
+	}
+	got := latencies(durations)
+	if got != (Latencies{P50: 50, P95: 95, P99: 99, Max: 100}) {
+		t.Errorf("Latencies are %+v", got)
+	}
+	if got := latencies(nil); got != (Latencies{}) {
+		t.Errorf("Latencies of nothing are %+v", got)
+	}
+}
+
+func TestMixPicksByWeight(t *testing.T) {
+	mix := mixFlag{}
+	if err := mix.Set("gsm=3,ucs2=1,binary=0"); err != nil {
+		t.Fatalf("Couldn't set the mix : %v", err)
+	}
+	random := rand.New(rand.NewSource(1))
+	picked := map[int]int{}
+	for i := 0; i < 4000; i++ {
+		picked[mix.pick(random).dataCoding]++
+	}
+	if picked[4] != 0 || picked[0] < 2800 || picked[0] > 3200 || picked[0]+picked[8] != 4000 {
+		t.Errorf("Picked %v", picked)
+	}
+}
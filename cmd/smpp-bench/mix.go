@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// messageKind is one of the messages the mix is made of.
+type messageKind struct {
+	dataCoding int
+	text       string
+}
+
+var messageKinds = map[string]messageKind{
+	"gsm":    {0, "Load test message"},
+	"long":   {0, strings.Repeat("Long load test message, 160 characters. ", 4)[:160]},
+	"ucs2":   {8, ucs2("Message de test de charge, très chargé")},
+	"binary": {4, "\x00\x01\x02\x03\x04\x05\x06\x07\xf8\xf9\xfa\xfb\xfc\xfd\xfe\xff"},
+}
+
+func ucs2(text string) string {
+	encoded := []byte{}
+	for _, unit := range utf16.Encode([]rune(text)) {
+		encoded = append(encoded, byte(unit>>8), byte(unit))
+	}
+	return string(encoded)
+}
+
+func kindNames() string {
+	names := []string{}
+	for name := range messageKinds {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+type weightedKind struct {
+	name   string
+	weight int
+}
+
+// mixFlag is the message mix as kind=weight pairs, separated by commas.
+type mixFlag []weightedKind
+
+func defaultMix() mixFlag {
+	return mixFlag{{"gsm", 1}}
+}
+
+func (m *mixFlag) String() string {
+	if m == nil {
+		return ""
+	}
+	pairs := []string{}
+	for _, kind := range *m {
+		pairs = append(pairs, fmt.Sprintf("%v=%v", kind.name, kind.weight))
+	}
+	return strings.Join(pairs, ",")
+}
+
+func (m *mixFlag) Set(value string) error {
+	mix := mixFlag{}
+	for _, pair := range strings.Split(value, ",") {
+		name, weight, found := strings.Cut(pair, "=")
+		if !found {
+			weight = "1"
+		}
+		if _, ok := messageKinds[name]; !ok {
+			return fmt.Errorf("Unknown message kind %q, use %v", name, kindNames())
+		}
+		w, err := strconv.Atoi(weight)
+		if err != nil || w < 0 {
+			return fmt.Errorf("Invalid weight %q for %v", weight, name)
+		}
+		mix = append(mix, weightedKind{name, w})
+	}
+	if mix.total() == 0 {
+		return fmt.Errorf("The message mix weighs nothing")
+	}
+	*m = mix
+	return nil
+}
+
+func (m mixFlag) total() (total int) {
+	for _, kind := range m {
+		total += kind.weight
+	}
+	return total
+}
+
+// pick draws a message kind according to the weights.
+func (m mixFlag) pick(random *rand.Rand) messageKind {
+	draw := random.Intn(m.total())
+	for _, kind := range m {
+		if draw < kind.weight {
+			return messageKinds[kind.name]
+		}
+		draw -= kind.weight
+	}
+	return messageKinds[m[len(m)-1].name]
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// stats gathers the outcome of every submit_sm of the run, from every
+// session.
+type stats struct {
+	mu               sync.Mutex
+	sent             int
+	sendErrors       int
+	statuses         map[string]int
+	submitLatencies  []time.Duration
+	receiptLatencies []time.Duration
+}
+
+func newStats() *stats {
+	return &stats{statuses: map[string]int{}}
+}
+
+func (s *stats) submitted() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sent++
+}
+
+func (s *stats) sendFailed() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sendErrors++
+}
+
+func (s *stats) responded(status string, latency time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.statuses[status]++
+	s.submitLatencies = append(s.submitLatencies, latency)
+}
+
+func (s *stats) receiptReceived(latency time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.receiptLatencies = append(s.receiptLatencies, latency)
+}
+
+// Report is what smpp-bench prints, as JSON with -output json.
+type Report struct {
+	Sessions        int            `json:"sessions"`
+	DurationSeconds float64        `json:"duration_seconds"` // until the submitters stopped
+	DrainSeconds    float64        `json:"drain_seconds"`    // waiting for the last responses
+	Sent            int            `json:"sent"`
+	SendErrors      int            `json:"send_errors"`
+	Responses       int            `json:"responses"`
+	Unanswered      int            `json:"unanswered"`
+	SentPerSecond   float64        `json:"sent_per_second"`
+	Throughput      float64        `json:"throughput"` // accepted messages per second, drain included
+	Statuses        map[string]int `json:"statuses"`
+	SubmitLatency   Latencies      `json:"submit_latency"`
+	Receipts        int            `json:"receipts,omitempty"`
+	ReceiptLatency  *Latencies     `json:"receipt_latency,omitempty"`
+}
+
+// Latencies are in milliseconds.
+type Latencies struct {
+	P50 float64 `json:"p50_ms"`
+	P95 float64 `json:"p95_ms"`
+	P99 float64 `json:"p99_ms"`
+	Max float64 `json:"max_ms"`
+}
+
+func (s *stats) report(sessions int, elapsed time.Duration, drain time.Duration, receipts bool) Report {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	statuses := map[string]int{}
+	responses := 0
+	for status, count := range s.statuses {
+		statuses[status] = count
+		responses += count
+	}
+	report := Report{
+		Sessions:        sessions,
+		DurationSeconds: elapsed.Seconds(),
+		DrainSeconds:    drain.Seconds(),
+		Sent:            s.sent,
+		SendErrors:      s.sendErrors,
+		Responses:       responses,
+		Unanswered:      s.sent - responses,
+		SentPerSecond:   float64(s.sent) / elapsed.Seconds(),
+		Throughput:      float64(statuses["ESME_ROK"]) / (elapsed + drain).Seconds(),
+		Statuses:        statuses,
+		SubmitLatency:   latencies(s.submitLatencies),
+	}
+	if receipts {
+		receiptLatency := latencies(s.receiptLatencies)
+		report.Receipts = len(s.receiptLatencies)
+		report.ReceiptLatency = &receiptLatency
+	}
+	return report
+}
+
+func latencies(durations []time.Duration) Latencies {
+	sorted := append([]time.Duration{}, durations...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return Latencies{
+		P50: milliseconds(percentile(sorted, 50)),
+		P95: milliseconds(percentile(sorted, 95)),
+		P99: milliseconds(percentile(sorted, 99)),
+		Max: milliseconds(percentile(sorted, 100)),
+	}
+}
+
+// percentile of sorted durations, by the nearest rank method.
+func percentile(sorted []time.Duration, p int) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := (p*len(sorted) + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
@@ -0,0 +1,189 @@
+// Command smpp-replay feeds a capture written by the JSONL or pcap Capture
+// to an SMSC and prints the PDUs it answers with.
+//
+//	smpp-replay -capture smsc.pcap -addr localhost:2775
+//
+// Directions are the ones of the capture : -direction inbound replays what
+// the ESMEs sent to a capturing SMSC, and the ESME side of a pcap file, while
+// -direction outbound replays what a capturing ESME sent.  A capture of
+// several sessions is replayed one session at a time, chosen with -session.
+//
+// With -listen, the capture is replayed to the first ESME connecting instead,
+// ie. what a capturing SMSC sent to its ESMEs :
+//
+//	smpp-replay -capture smsc.pcap -listen localhost:2775 -direction outbound
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/elafontaine/smpp"
+)
+
+type options struct {
+	capture     string
+	addr        string
+	listen      string
+	direction   string
+	session     string
+	pace        bool
+	settle      time.Duration
+	useTLS      bool
+	tlsInsecure bool
+	timeout     time.Duration
+	output      string
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdout io.Writer, stderr io.Writer) int {
+	flags := flag.NewFlagSet("smpp-replay", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	o := options{}
+	flags.StringVar(&o.capture, "capture", "", "JSONL or pcap capture to replay")
+	flags.StringVar(&o.addr, "addr", "localhost:2775", "SMSC address as host:port")
+	flags.StringVar(&o.listen, "listen", "", "listen on host:port and replay to the first ESME connecting rather than connecting to -addr")
+	flags.StringVar(&o.direction, "direction", smpp.Inbound, "direction of the captured PDUs to replay, inbound or outbound")
+	flags.StringVar(&o.session, "session", "", "remote address of the captured session to replay")
+	flags.BoolVar(&o.pace, "pace", false, "keep the delays between the captured PDUs")
+	flags.DurationVar(&o.settle, "settle", time.Second, "how long to wait for more PDUs once the capture is replayed")
+	flags.BoolVar(&o.useTLS, "tls", false, "connect over TLS")
+	flags.BoolVar(&o.tlsInsecure, "tls-insecure", false, "don't verify the certificate of the SMSC")
+	flags.DurationVar(&o.timeout, "timeout", 10*time.Second, "how long to wait for the connection, made or accepted")
+	flags.StringVar(&o.output, "output", "text", "text or json")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if o.capture == "" {
+		fmt.Fprintln(stderr, "A capture is needed, give it with -capture")
+		return 2
+	}
+	if o.listen != "" && o.useTLS {
+		fmt.Fprintln(stderr, "-tls is only for connecting to an SMSC, not with -listen")
+		return 2
+	}
+	if o.direction != smpp.Inbound && o.direction != smpp.Outbound {
+		fmt.Fprintf(stderr, "Unknown direction %q, use inbound or outbound\n", o.direction)
+		return 2
+	}
+	if o.output != "text" && o.output != "json" {
+		fmt.Fprintf(stderr, "Unknown output %q, use text or json\n", o.output)
+		return 2
+	}
+
+	replies, err := replay(o)
+	printReplies(stdout, o.output, replies)
+	if err != nil {
+		fmt.Fprintf(stderr, "error: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+func replay(o options) ([]smpp.PDU, error) {
+	capture, err := readCapture(o.capture)
+	if err != nil {
+		return nil, err
+	}
+	if capture, err = sessionOf(capture, o.session); err != nil {
+		return nil, err
+	}
+	var conn net.Conn
+	if o.listen != "" {
+		if conn, err = accept(o); err != nil {
+			return nil, fmt.Errorf("Couldn't accept an ESME on %v : %v", o.listen, err)
+		}
+	} else if conn, err = connect(o); err != nil {
+		return nil, fmt.Errorf("Couldn't connect to %v : %v", o.addr, err)
+	}
+	defer conn.Close()
+	return smpp.Replay(conn, capture, o.direction, o.pace, o.settle)
+}
+
+// readCapture tells a pcap file from a JSONL one by its magic number.
+func readCapture(path string) ([]smpp.CapturedPdu, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(content) >= 4 {
+		switch binary.LittleEndian.Uint32(content) {
+		case 0xa1b2c3d4, 0xd4c3b2a1, 0xa1b23c4d, 0x4d3cb2a1:
+			return smpp.ReadPcapCapture(bytes.NewReader(content))
+		}
+	}
+	return smpp.ReadJSONLCapture(bytes.NewReader(content))
+}
+
+// sessionOf keeps the PDUs of the session with the remote address, which can
+// be left empty when the capture has a single one.
+func sessionOf(capture []smpp.CapturedPdu, remoteAddr string) ([]smpp.CapturedPdu, error) {
+	sessions := map[string][]smpp.CapturedPdu{}
+	for _, pdu := range capture {
+		sessions[pdu.RemoteAddr] = append(sessions[pdu.RemoteAddr], pdu)
+	}
+	if remoteAddr != "" {
+		if _, ok := sessions[remoteAddr]; !ok {
+			return nil, fmt.Errorf("No session with %v in the capture", remoteAddr)
+		}
+		return sessions[remoteAddr], nil
+	}
+	if len(sessions) > 1 {
+		addrs := []string{}
+		for addr := range sessions {
+			addrs = append(addrs, addr)
+		}
+		sort.Strings(addrs)
+		return nil, fmt.Errorf("The capture has %v sessions, pick one with -session : %v", len(sessions), strings.Join(addrs, ", "))
+	}
+	return capture, nil
+}
+
+func connect(o options) (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: o.timeout}
+	if !o.useTLS {
+		return dialer.Dial("tcp", o.addr)
+	}
+	host, _, _ := net.SplitHostPort(o.addr)
+	return tls.DialWithDialer(dialer, "tcp", o.addr, &tls.Config{ServerName: host, InsecureSkipVerify: o.tlsInsecure})
+}
+
+// accept waits for the first connection on the listen address, no more are
+// accepted.
+func accept(o options) (net.Conn, error) {
+	listener, err := net.Listen("tcp", o.listen)
+	if err != nil {
+		return nil, err
+	}
+	defer listener.Close()
+	if err = listener.(*net.TCPListener).SetDeadline(time.Now().Add(o.timeout)); err != nil {
+		return nil, err
+	}
+	return listener.Accept()
+}
+
+func printReplies(w io.Writer, output string, replies []smpp.PDU) {
+	if output == "json" {
+		if replies == nil {
+			replies = []smpp.PDU{}
+		}
+		json.NewEncoder(w).Encode(replies)
+		return
+	}
+	for _, reply := range replies {
+		fmt.Fprintln(w, reply.String())
+	}
+}
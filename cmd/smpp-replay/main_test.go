@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/elafontaine/smpp"
+)
+
+func startSmsc(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Couldn't listen : %v", err)
+	}
+	smsc := smpp.NewSMSC(&listener, "SystemId", "Password")
+	smsc.Start()
+	t.Cleanup(smsc.Close)
+	return listener.Addr().String()
+}
+
+// writePcapCapture writes a pcap file of an ESME binding, submitting and
+// unbinding from each of the remote addresses.
+func writePcapCapture(t *testing.T, remoteAddrs ...string) string {
+	path := filepath.Join(t.TempDir(), "capture.pcap")
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("Couldn't create the capture : %v", err)
+	}
+	defer file.Close()
+	capture, err := smpp.NewPcapCapture(file)
+	if err != nil {
+		t.Fatalf("Couldn't start the capture : %v", err)
+	}
+	for _, remoteAddr := range remoteAddrs {
+		for i, pdu := range []smpp.PDU{
+			smpp.NewBindTransmitter().WithSystemId("SystemId").WithPassword("Password"),
+			smpp.NewSubmitSM().WithDestinationAddress("5551234").WithMessage("Hello"),
+			smpp.NewUnbind(),
+		} {
+			pduBytes, err := smpp.EncodePdu(pdu.WithSequenceNumber(i + 1))
+			if err != nil {
+				t.Fatalf("Couldn't encode %v : %v", pdu.Header.CommandId, err)
+			}
+			captured := smpp.CapturedPdu{Time: time.Now(), Direction: smpp.Inbound, LocalAddr: "10.0.0.1:2775", RemoteAddr: remoteAddr, Bytes: pduBytes}
+			if err = capture.CapturePdu(captured); err != nil {
+				t.Fatalf("Couldn't capture %v : %v", pdu.Header.CommandId, err)
+			}
+		}
+	}
+	return path
+}
+
+func TestReplayPrintsTheAnswersOfTheSmsc(t *testing.T) {
+	addr := startSmsc(t)
+	path := writePcapCapture(t, "10.0.0.2:40000")
+	stdout, stderr := bytes.Buffer{}, bytes.Buffer{}
+
+	code := run([]string{"-capture", path, "-addr", addr, "-settle", "100ms", "-output", "json"}, &stdout, &stderr)
+
+	if code != 0 {
+		t.Fatalf("Exited with %v : %v %v", code, stdout.String(), stderr.String())
+	}
+	var replies []smpp.PDU
+	if err := json.Unmarshal(stdout.Bytes(), &replies); err != nil {
+		t.Fatalf("Couldn't decode the output %q : %v", stdout.String(), err)
+	}
+	want := []string{"bind_transmitter_resp", "submit_sm_resp", "unbind_resp"}
+	if len(replies) != len(want) {
+		t.Fatalf("Printed %v, want %v", replies, want)
+	}
+	for i := range want {
+		if replies[i].Header.CommandId != want[i] || replies[i].Header.CommandStatus != smpp.ESME_ROK {
+			t.Errorf("Reply %v = %v %v, want %v", i, replies[i].Header.CommandId, replies[i].Header.CommandStatus, want[i])
+		}
+	}
+}
+
+func TestReplayAsksWhichSessionToReplay(t *testing.T) {
+	addr := startSmsc(t)
+	path := writePcapCapture(t, "10.0.0.2:40000", "10.0.0.3:40000")
+	stdout, stderr := bytes.Buffer{}, bytes.Buffer{}
+
+	code := run([]string{"-capture", path, "-addr", addr, "-settle", "100ms"}, &stdout, &stderr)
+	if code != 1 || !strings.Contains(stderr.String(), "10.0.0.2:40000, 10.0.0.3:40000") {
+		t.Errorf("Exited with %v printing %q", code, stderr.String())
+	}
+
+	stdout.Reset()
+	code = run([]string{"-capture", path, "-addr", addr, "-settle", "100ms", "-session", "10.0.0.3:40000"}, &stdout, &stderr)
+	if code != 0 || strings.Count(stdout.String(), "_resp") != 3 {
+		t.Errorf("Exited with %v printing %q", code, stdout.String())
+	}
+}
+
+func TestReplayListensForAnEsmeToReplayTheSmscSideTo(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "capture.jsonl")
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("Couldn't create the capture : %v", err)
+	}
+	capture := smpp.NewJSONLCapture(file)
+	for i, pdu := range []smpp.PDU{smpp.NewEnquireLink(), smpp.NewDeliverSM().WithMessage("Hello")} {
+		pduBytes, _ := smpp.EncodePdu(pdu.WithSequenceNumber(i + 1))
+		captured := smpp.CapturedPdu{Time: time.Now(), Direction: smpp.Outbound, LocalAddr: "10.0.0.1:2775", RemoteAddr: "10.0.0.2:40000", Bytes: pduBytes}
+		if err = capture.CapturePdu(captured); err != nil {
+			t.Fatalf("Couldn't capture %v : %v", pdu.Header.CommandId, err)
+		}
+	}
+	file.Close()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Couldn't find a free port : %v", err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+	stdout, stderr := bytes.Buffer{}, bytes.Buffer{}
+	code := make(chan int)
+	go func() {
+		code <- run([]string{"-capture", path, "-listen", addr, "-direction", "outbound", "-settle", "100ms", "-timeout", "2s"}, &stdout, &stderr)
+	}()
+
+	var conn net.Conn
+	for i := 0; i < 100; i++ {
+		if conn, err = net.Dial("tcp", addr); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatalf("Couldn't connect to the replay : %v", err)
+	}
+	esme := smpp.NewEsme(conn)
+	defer esme.Close()
+	esme.StartControlLoop()
+
+	if exit := <-code; exit != 0 {
+		t.Fatalf("Exited with %v : %v", exit, stderr.String())
+	}
+	if !strings.Contains(stdout.String(), "enquire_link_resp") || !strings.Contains(stdout.String(), "deliver_sm_resp") {
+		t.Errorf("Printed %q, want the answers of the ESME", stdout.String())
+	}
+}
@@ -0,0 +1,338 @@
+// Command smpp-send binds to an SMSC, submits one message and prints the
+// submit_sm_resp along with the delivery receipt when asked to wait for it.
+//
+//	smpp-send -addr localhost:2775 -system-id SystemId -password Password \
+//		-source +15551234567 -dest 5557654321 -message "Hello" -wait-receipt
+//
+// TLVs are added with -tlv name=value, as many times as needed.  It exits
+// with 1 when the message isn't accepted or the receipt doesn't come.
+package main
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/elafontaine/smpp"
+)
+
+type tlvFlags []string
+
+func (t *tlvFlags) String() string {
+	return strings.Join(*t, ",")
+}
+
+func (t *tlvFlags) Set(value string) error {
+	if !strings.Contains(value, "=") {
+		return fmt.Errorf("TLVs are given as name=value")
+	}
+	*t = append(*t, value)
+	return nil
+}
+
+type options struct {
+	addr        string
+	systemId    string
+	password    string
+	bindType    string
+	useTLS      bool
+	tlsInsecure bool
+	source      string
+	sourceTon   int
+	sourceNpi   int
+	dest        string
+	destTon     int
+	destNpi     int
+	message     string
+	dataCoding  int
+	tlvs        tlvFlags
+	waitReceipt bool
+	timeout     time.Duration
+	receiptWait time.Duration
+	output      string
+}
+
+// result is what gets printed, as JSON with -output json.
+type result struct {
+	CommandStatus    string   `json:"command_status"`
+	MessageId        string   `json:"message_id,omitempty"`
+	SequenceNumber   int      `json:"sequence_number"`
+	SubmitLatencyMs  float64  `json:"submit_latency_ms"`
+	Receipt          *receipt `json:"receipt,omitempty"`
+	ReceiptLatencyMs float64  `json:"receipt_latency_ms,omitempty"`
+	Error            string   `json:"error,omitempty"`
+}
+
+type receipt struct {
+	MessageId string    `json:"message_id"`
+	State     string    `json:"state"`
+	Stat      string    `json:"stat"`
+	Err       string    `json:"err"`
+	DoneDate  time.Time `json:"done_date"`
+	Text      string    `json:"text"`
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdout io.Writer, stderr io.Writer) int {
+	flags := flag.NewFlagSet("smpp-send", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	o := options{}
+	flags.StringVar(&o.addr, "addr", "localhost:2775", "SMSC address as host:port")
+	flags.StringVar(&o.systemId, "system-id", "", "system_id to bind with")
+	flags.StringVar(&o.password, "password", "", "password to bind with")
+	flags.StringVar(&o.bindType, "bind", "transceiver", "bind as a transmitter or a transceiver")
+	flags.BoolVar(&o.useTLS, "tls", false, "connect over TLS")
+	flags.BoolVar(&o.tlsInsecure, "tls-insecure", false, "don't verify the certificate of the SMSC")
+	flags.StringVar(&o.source, "source", "", "source_addr")
+	flags.IntVar(&o.sourceTon, "source-ton", -1, "source_addr_ton, inferred from the address when negative")
+	flags.IntVar(&o.sourceNpi, "source-npi", -1, "source_addr_npi, inferred from the address when negative")
+	flags.StringVar(&o.dest, "dest", "", "destination_addr")
+	flags.IntVar(&o.destTon, "dest-ton", -1, "dest_addr_ton, inferred from the address when negative")
+	flags.IntVar(&o.destNpi, "dest-npi", -1, "dest_addr_npi, inferred from the address when negative")
+	flags.StringVar(&o.message, "message", "", "short_message")
+	flags.IntVar(&o.dataCoding, "data-coding", 0, "data_coding")
+	flags.Var(&o.tlvs, "tlv", "TLV as name=value (or 0xTAG=hex), repeatable")
+	flags.BoolVar(&o.waitReceipt, "wait-receipt", false, "request a delivery receipt and wait for it")
+	flags.DurationVar(&o.timeout, "timeout", 10*time.Second, "how long to wait for the bind and submit responses")
+	flags.DurationVar(&o.receiptWait, "receipt-timeout", time.Minute, "how long to wait for the delivery receipt")
+	flags.StringVar(&o.output, "output", "text", "text or json")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if o.output != "text" && o.output != "json" {
+		fmt.Fprintf(stderr, "Unknown output %q, use text or json\n", o.output)
+		return 2
+	}
+
+	res, err := send(o)
+	if err != nil {
+		res.Error = err.Error()
+	}
+	printResult(stdout, o.output, res)
+	if err != nil {
+		return 1
+	}
+	return 0
+}
+
+func send(o options) (res result, err error) {
+	submitSm, err := buildSubmitSm(o)
+	if err != nil {
+		return res, err
+	}
+	if o.waitReceipt && o.bindType != "transceiver" {
+		return res, errors.New("Delivery receipts only come on transceiver binds")
+	}
+	esme, err := connect(o)
+	if err != nil {
+		return res, fmt.Errorf("Couldn't connect to %v : %v", o.addr, err)
+	}
+	defer esme.Close()
+
+	if err = bind(esme, o); err != nil {
+		return res, err
+	}
+	responses := make(chan smpp.PDU, 1)
+	receipts := make(chan smpp.PDU, 16)
+	unbound := make(chan struct{}, 1)
+	esme.CommandFunctions["submit_sm_resp"] = forwardTo(responses)
+	esme.CommandFunctions["generic_nack"] = forwardTo(responses)
+	esme.CommandFunctions["deliver_sm"] = acknowledgeReceipt(receipts)
+	esme.CommandFunctions["unbind_resp"] = func(*smpp.ESME, smpp.PDU) error {
+		select {
+		case unbound <- struct{}{}:
+		default:
+		}
+		return nil
+	}
+	esme.StartControlLoop()
+	defer unbind(esme, unbound, o.timeout)
+
+	sentAt := time.Now()
+	res.SequenceNumber, err = esme.Send(&submitSm)
+	if err != nil {
+		return res, fmt.Errorf("Couldn't send the submit_sm : %v", err)
+	}
+	select {
+	case resp := <-responses:
+		res.SubmitLatencyMs = milliseconds(time.Since(sentAt))
+		res.CommandStatus = resp.Header.CommandStatus
+		res.MessageId, _ = resp.Body.MandatoryParameter["message_id"].(string)
+	case <-time.After(o.timeout):
+		return res, errors.New("No response to the submit_sm")
+	}
+	if res.CommandStatus != smpp.ESME_ROK {
+		return res, fmt.Errorf("Message refused with %v", res.CommandStatus)
+	}
+	if !o.waitReceipt {
+		return res, nil
+	}
+	deadline := time.After(o.receiptWait)
+	for {
+		select {
+		case pdu := <-receipts:
+			dlr, err := smpp.ParseDeliveryReceipt(pdu)
+			if err != nil || dlr.MessageId != res.MessageId {
+				continue
+			}
+			res.ReceiptLatencyMs = milliseconds(time.Since(sentAt))
+			res.Receipt = &receipt{dlr.MessageId, dlr.MessageState, dlr.Stat, dlr.Err, dlr.DoneDate, dlr.Text}
+			return res, nil
+		case <-deadline:
+			return res, errors.New("No delivery receipt received")
+		}
+	}
+}
+
+func buildSubmitSm(o options) (smpp.PDU, error) {
+	source, err := address(o.source, o.sourceTon, o.sourceNpi)
+	if err != nil {
+		return smpp.PDU{}, fmt.Errorf("Invalid source : %v", err)
+	}
+	destination, err := address(o.dest, o.destTon, o.destNpi)
+	if err != nil {
+		return smpp.PDU{}, fmt.Errorf("Invalid destination : %v", err)
+	}
+	submitSm := smpp.NewSubmitSM().
+		WithSource(source).
+		WithDestination(destination).
+		WithDataCoding(o.dataCoding).
+		WithMessage(o.message)
+	if o.waitReceipt {
+		registeredDelivery, _ := smpp.NewRegisteredDelivery("always", "nil", false)
+		submitSm = submitSm.WithRegisteredDelivery(registeredDelivery)
+	}
+	for _, tlv := range o.tlvs {
+		tag, value, _ := strings.Cut(tlv, "=")
+		optionalParameter, err := smpp.NewOptionalParameter(tag, value)
+		if err != nil {
+			return smpp.PDU{}, err
+		}
+		submitSm = submitSm.WithOptionalParameter(optionalParameter)
+	}
+	return submitSm, nil
+}
+
+// address infers the TON and NPI left negative out of the address.
+func address(addr string, ton int, npi int) (smpp.Address, error) {
+	inferred := smpp.Address{Addr: addr}
+	if addr != "" && (ton < 0 || npi < 0) {
+		var err error
+		if inferred, err = smpp.NewAddress(addr); err != nil {
+			return inferred, err
+		}
+	}
+	if ton >= 0 {
+		inferred.Ton = ton
+	}
+	if npi >= 0 {
+		inferred.Npi = npi
+	}
+	return inferred, nil
+}
+
+func connect(o options) (*smpp.ESME, error) {
+	if !o.useTLS {
+		serverAddress, err := net.ResolveTCPAddr("tcp", o.addr)
+		if err != nil {
+			return nil, err
+		}
+		return smpp.InstantiateEsme(serverAddress, "tcp")
+	}
+	host, _, _ := net.SplitHostPort(o.addr)
+	dialer := &net.Dialer{Timeout: o.timeout}
+	conn, err := tls.DialWithDialer(dialer, "tcp", o.addr, &tls.Config{ServerName: host, InsecureSkipVerify: o.tlsInsecure})
+	if err != nil {
+		return nil, err
+	}
+	return smpp.NewEsme(conn), nil
+}
+
+func bind(esme *smpp.ESME, o options) error {
+	var resp *smpp.PDU
+	var err error
+	switch o.bindType {
+	case "transmitter":
+		resp, err = esme.BindTransmitter(o.systemId, o.password)
+	case "transceiver":
+		resp, err = esme.BindTransceiver(o.systemId, o.password)
+	default:
+		return fmt.Errorf("Unknown bind type %q, use transmitter or transceiver", o.bindType)
+	}
+	if err != nil {
+		if resp != nil {
+			return fmt.Errorf("Couldn't bind : %v (%v)", resp.Header.CommandStatus, err)
+		}
+		return fmt.Errorf("Couldn't bind : %v", err)
+	}
+	return nil
+}
+
+func forwardTo(pdus chan smpp.PDU) func(*smpp.ESME, smpp.PDU) error {
+	return func(_ *smpp.ESME, pdu smpp.PDU) error {
+		select {
+		case pdus <- pdu:
+		default:
+		}
+		return nil
+	}
+}
+
+// acknowledgeReceipt answers every deliver_sm and keeps the delivery
+// receipts.
+func acknowledgeReceipt(receipts chan smpp.PDU) func(*smpp.ESME, smpp.PDU) error {
+	return func(e *smpp.ESME, pdu smpp.PDU) error {
+		resp := smpp.NewDeliverSMResp().WithMessageId("").WithSequenceNumber(pdu.Header.SequenceNumber)
+		if _, err := e.Send(&resp); err != nil {
+			return err
+		}
+		if smpp.IsDeliveryReceipt(pdu) {
+			select {
+			case receipts <- pdu:
+			default:
+			}
+		}
+		return nil
+	}
+}
+
+func unbind(esme *smpp.ESME, unbound chan struct{}, timeout time.Duration) {
+	unbindPdu := smpp.NewUnbind()
+	if _, err := esme.Send(&unbindPdu); err != nil {
+		return
+	}
+	select {
+	case <-unbound:
+	case <-time.After(timeout):
+	}
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+func printResult(w io.Writer, output string, res result) {
+	if output == "json" {
+		json.NewEncoder(w).Encode(res)
+		return
+	}
+	if res.CommandStatus != "" {
+		fmt.Fprintf(w, "submit_sm_resp: %v message_id=%q sequence_number=%v latency=%vms\n", res.CommandStatus, res.MessageId, res.SequenceNumber, res.SubmitLatencyMs)
+	}
+	if res.Receipt != nil {
+		fmt.Fprintf(w, "receipt: %v (stat=%v err=%v) done=%v latency=%vms\n", res.Receipt.State, res.Receipt.Stat, res.Receipt.Err, res.Receipt.DoneDate.Format(time.RFC3339), res.ReceiptLatencyMs)
+	}
+	if res.Error != "" {
+		fmt.Fprintf(w, "error: %v\n", res.Error)
+	}
+}
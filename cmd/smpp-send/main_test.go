@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/elafontaine/smpp"
+)
+
+func startSmsc(t *testing.T) (*smpp.SMSC, string) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Couldn't listen : %v", err)
+	}
+	smsc := smpp.NewSMSC(&listener, "SystemId", "Password")
+	smsc.DeliveryReceiptDelay = 10 * time.Millisecond
+	smsc.Start()
+	t.Cleanup(smsc.Close)
+	return smsc, listener.Addr().String()
+}
+
+func TestSendSubmitsAndWaitsForTheReceipt(t *testing.T) {
+	smsc, addr := startSmsc(t)
+	stdout, stderr := bytes.Buffer{}, bytes.Buffer{}
+
+	code := run([]string{
+		"-addr", addr, "-system-id", "SystemId", "-password", "Password",
+		"-source", "+15551234567", "-dest", "5557654321", "-message", "Hello",
+		"-tlv", "user_message_reference=42", "-wait-receipt", "-output", "json",
+	}, &stdout, &stderr)
+
+	if code != 0 {
+		t.Fatalf("Exited with %v : %v %v", code, stdout.String(), stderr.String())
+	}
+	var res result
+	if err := json.Unmarshal(stdout.Bytes(), &res); err != nil {
+		t.Fatalf("Couldn't decode the output %q : %v", stdout.String(), err)
+	}
+	if res.CommandStatus != smpp.ESME_ROK || res.MessageId == "" || res.Receipt == nil ||
+		res.Receipt.MessageId != res.MessageId || res.Receipt.State != "DELIVERED" {
+		t.Errorf("Printed %+v", res)
+	}
+	messages, _ := smsc.MessageStore.List()
+	if len(messages) != 1 || messages[0].Source.String() != "+15551234567" || messages[0].Destination.Addr != "5557654321" {
+		t.Errorf("SMSC stored %+v", messages)
+	}
+}
+
+func TestSendReportsRefusals(t *testing.T) {
+	_, addr := startSmsc(t)
+	stdout, stderr := bytes.Buffer{}, bytes.Buffer{}
+
+	code := run([]string{"-addr", addr, "-system-id", "SystemId", "-password", "Wrong", "-dest", "5557654321"}, &stdout, &stderr)
+
+	if code != 1 || !strings.Contains(stdout.String(), "error: Couldn't bind") {
+		t.Errorf("Exited with %v printing %q", code, stdout.String())
+	}
+	if code := run([]string{"-tlv", "not_a_tlv=1"}, &stdout, &stderr); code != 1 {
+		t.Errorf("Exited with %v on an unknown TLV", code)
+	}
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/elafontaine/smpp"
+	"gopkg.in/yaml.v3"
+)
+
+// Config is the simulator configuration, read from YAML or JSON (which is
+// YAML too) :
+//
+//	listeners:
+//	  - address: 0.0.0.0:2775
+//	  - address: 0.0.0.0:3775
+//	    tls: {cert_file: server.crt, key_file: server.key}
+//	accounts:
+//	  - {system_id: SystemId, password: Password}
+//	  - system_id: receiver
+//	    password: secret
+//	    allowed_bind_types: [bind_receiver]
+//	    max_binds: {bind_receiver: 2}
+//	routes:
+//	  - {destination_prefix: "1555", system_id: receiver}
+//	delivery_receipts: {state: DELIVERED, delay: 1s}
+//	message_id: hex
+//	message_store: {max_age: 1h, max_final_messages: 100000}
+//	response_delays: {submit_sm: 200ms}
+//	admin: 127.0.0.1:8080
+type Config struct {
+	Listeners        []ListenerConfig         `yaml:"listeners"`
+	Accounts         []AccountConfig          `yaml:"accounts"`
+	Routes           []RouteConfig            `yaml:"routes"`
+	DeliveryReceipts DeliveryReceiptConfig    `yaml:"delivery_receipts"`
+	MessageId        string                   `yaml:"message_id"`
+	MessageStore     MessageStoreConfig       `yaml:"message_store"`
+	ResponseDelays   map[string]time.Duration `yaml:"response_delays"`
+	MaxConnections   int                      `yaml:"max_connections"`
+	Admin            string                   `yaml:"admin"`
+	Verbose          bool                     `yaml:"verbose"`
+}
+
+type ListenerConfig struct {
+	Address string     `yaml:"address"`
+	TLS     *TLSConfig `yaml:"tls"`
+}
+
+type TLSConfig struct {
+	CertFile string `yaml:"cert_file"`
+	KeyFile  string `yaml:"key_file"`
+}
+
+type AccountConfig struct {
+	SystemId         string         `yaml:"system_id"`
+	Password         string         `yaml:"password"`
+	SystemType       string         `yaml:"system_type"`
+	AllowedBindTypes []string       `yaml:"allowed_bind_types"`
+	AllowedNetworks  []string       `yaml:"allowed_networks"`
+	MaxBinds         map[string]int `yaml:"max_binds"`
+}
+
+type RouteConfig struct {
+	DestinationPrefix string `yaml:"destination_prefix"`
+	SourceSystemId    string `yaml:"source_system_id"`
+	SystemId          string `yaml:"system_id"`
+}
+
+// DeliveryReceiptConfig is the final state reached by the messages no
+// receiver takes, and how long they take to reach it.
+type DeliveryReceiptConfig struct {
+	State string        `yaml:"state"`
+	Delay time.Duration `yaml:"delay"`
+}
+
+// MessageStoreConfig limits the messages in a final state kept for query_sm
+// and the admin API, zero meaning no limit.
+type MessageStoreConfig struct {
+	MaxAge           time.Duration `yaml:"max_age"`
+	MaxFinalMessages int           `yaml:"max_final_messages"`
+}
+
+var messageIdGenerators = map[string]func() smpp.MessageIdGenerator{
+	"counter": smpp.NewCounterMessageIdGenerator,
+	"hex":     smpp.NewHexMessageIdGenerator,
+	"uuid":    smpp.NewUUIDMessageIdGenerator,
+}
+
+func loadConfig(name string) (Config, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return Config{}, err
+	}
+	defer file.Close()
+	return parseConfig(file)
+}
+
+func parseConfig(r io.Reader) (config Config, err error) {
+	decoder := yaml.NewDecoder(r)
+	decoder.KnownFields(true)
+	if err = decoder.Decode(&config); err != nil {
+		return config, fmt.Errorf("Couldn't read the configuration : %v", err)
+	}
+	return config, config.validate()
+}
+
+func (c Config) validate() error {
+	if len(c.Listeners) == 0 {
+		return fmt.Errorf("No listener configured")
+	}
+	if len(c.Accounts) == 0 {
+		return fmt.Errorf("No account configured")
+	}
+	if state := c.DeliveryReceipts.State; state != "" && !smpp.IsMessageState(state) {
+		return fmt.Errorf("Unknown delivery_receipts state %q, use a message_state name like DELIVERED or UNDELIVERABLE", state)
+	}
+	if _, ok := messageIdGenerators[c.MessageId]; c.MessageId != "" && !ok {
+		return fmt.Errorf("Unknown message_id format %q, use counter, hex or uuid", c.MessageId)
+	}
+	for _, route := range c.Routes {
+		if route.SystemId == "" {
+			return fmt.Errorf("Route to %q has no system_id", route.DestinationPrefix)
+		}
+	}
+	for command := range c.ResponseDelays {
+		if strings.HasSuffix(command, "_resp") {
+			return fmt.Errorf("Response delays are given by request, use %v", strings.TrimSuffix(command, "_resp"))
+		}
+	}
+	return nil
+}
+
+// newSMSC listens as configured and gives the SMSC, not started yet.
+func newSMSC(config Config) (*smpp.SMSC, error) {
+	listeners := []net.Listener{}
+	for _, listenerConfig := range config.Listeners {
+		listener, err := listen(listenerConfig)
+		if err != nil {
+			for _, opened := range listeners {
+				opened.Close()
+			}
+			return nil, fmt.Errorf("Couldn't listen on %v : %v", listenerConfig.Address, err)
+		}
+		listeners = append(listeners, listener)
+	}
+	first := config.Accounts[0]
+	smsc := smpp.NewSMSC(&listeners[0], first.SystemId, first.Password)
+	for _, listener := range listeners[1:] {
+		smsc.AddListener(listener)
+	}
+
+	accounts := smpp.NewAccountTable()
+	for _, account := range config.Accounts {
+		accounts.AddAccount(smpp.Account(account))
+	}
+	smsc.Authenticator = accounts
+	for _, route := range config.Routes {
+		if err := smsc.RoutingTable.AddRoute(smpp.Route(route)); err != nil {
+			smsc.Close()
+			return nil, err
+		}
+	}
+	if config.DeliveryReceipts.State != "" {
+		smsc.DeliveryReceiptState = config.DeliveryReceipts.State
+	}
+	smsc.DeliveryReceiptDelay = config.DeliveryReceipts.Delay
+	if newGenerator, ok := messageIdGenerators[config.MessageId]; ok {
+		smsc.MessageIdGenerator = newGenerator()
+	}
+	store := smpp.NewInMemoryMessageStore()
+	store.MaxAge = config.MessageStore.MaxAge
+	store.MaxFinalMessages = config.MessageStore.MaxFinalMessages
+	smsc.MessageStore = store
+	if len(config.ResponseDelays) > 0 {
+		smsc.OutboundInterceptors = append(smsc.OutboundInterceptors, delayResponses(config.ResponseDelays))
+	}
+	smsc.MaxConnections = config.MaxConnections
+	return smsc, nil
+}
+
+func listen(config ListenerConfig) (net.Listener, error) {
+	if config.TLS == nil {
+		return net.Listen("tcp", config.Address)
+	}
+	certificate, err := tls.LoadX509KeyPair(config.TLS.CertFile, config.TLS.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+	return tls.Listen("tcp", config.Address, &tls.Config{Certificates: []tls.Certificate{certificate}})
+}
+
+// delayResponses holds the responses to the configured requests.  The
+// session doesn't read while its response is held, like an SMSC with a
+// window of one.
+func delayResponses(delays map[string]time.Duration) smpp.Interceptor {
+	return func(e *smpp.ESME, pdu smpp.PDU, next smpp.PduHandler) error {
+		if request, isResponse := strings.CutSuffix(pdu.Header.CommandId, "_resp"); isResponse {
+			time.Sleep(delays[request])
+		}
+		return next(e, pdu)
+	}
+}
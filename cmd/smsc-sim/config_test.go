@@ -0,0 +1,123 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/elafontaine/smpp"
+)
+
+const yamlConfig = `
+listeners:
+  - address: 127.0.0.1:0
+  - address: 127.0.0.1:0
+accounts:
+  - {system_id: sender, password: secret}
+  - system_id: receiver
+    password: secret
+    allowed_bind_types: [bind_receiver]
+routes:
+  - {destination_prefix: "1555", system_id: receiver}
+delivery_receipts: {state: UNDELIVERABLE, delay: 2s}
+message_id: hex
+message_store: {max_age: 1h, max_final_messages: 1000}
+response_delays: {submit_sm: 100ms}
+`
+
+const jsonConfig = `{
+	"listeners": [{"address": "127.0.0.1:0"}],
+	"accounts": [{"system_id": "sender", "password": "secret", "max_binds": {"bind_transmitter": 1}}],
+	"delivery_receipts": {"state": "DELIVERED", "delay": "1s"}
+}`
+
+func TestConfigIsReadFromYamlOrJson(t *testing.T) {
+	config, err := parseConfig(strings.NewReader(yamlConfig))
+	if err != nil {
+		t.Fatalf("Couldn't parse the YAML configuration : %v", err)
+	}
+	if len(config.Listeners) != 2 || len(config.Accounts) != 2 || config.Accounts[1].AllowedBindTypes[0] != "bind_receiver" ||
+		config.Routes[0].SystemId != "receiver" || config.DeliveryReceipts.Delay != 2*time.Second ||
+		config.ResponseDelays["submit_sm"] != 100*time.Millisecond || config.MessageId != "hex" ||
+		config.MessageStore.MaxAge != time.Hour || config.MessageStore.MaxFinalMessages != 1000 {
+		t.Errorf("YAML configuration read as %+v", config)
+	}
+
+	config, err = parseConfig(strings.NewReader(jsonConfig))
+	if err != nil {
+		t.Fatalf("Couldn't parse the JSON configuration : %v", err)
+	}
+	if config.Accounts[0].MaxBinds["bind_transmitter"] != 1 || config.DeliveryReceipts.State != "DELIVERED" {
+		t.Errorf("JSON configuration read as %+v", config)
+	}
+}
+
+func TestConfigRefusesWhatTheSimulatorCantRun(t *testing.T) {
+	for _, document := range []string{
+		`accounts: [{system_id: sender}]`,
+		`listeners: [{address: ":0"}]`,
+		"listeners: [{address: \":0\"}]\naccounts: [{system_id: sender}]\nmessage_id: random",
+		"listeners: [{address: \":0\"}]\naccounts: [{system_id: sender}]\ndelivery_receipts: {state: delivered}",
+		"listeners: [{address: \":0\"}]\naccounts: [{system_id: sender}]\nroutes: [{destination_prefix: \"1555\"}]",
+		"listeners: [{address: \":0\"}]\naccounts: [{system_id: sender}]\nresponse_delays: {submit_sm_resp: 1s}",
+		"listeners: [{address: \":0\"}]\naccounts: [{system_id: sender}]\nunknown_setting: true",
+	} {
+		if _, err := parseConfig(strings.NewReader(document)); err == nil {
+			t.Errorf("Expected an error reading %q", document)
+		}
+	}
+}
+
+func TestSimulatorRunsAsConfigured(t *testing.T) {
+	config, _ := parseConfig(strings.NewReader(yamlConfig))
+	smsc, err := newSMSC(config)
+	if err != nil {
+		t.Fatalf("Couldn't create the SMSC : %v", err)
+	}
+	smsc.Start()
+	defer smsc.Close()
+	addrs := smsc.Addrs()
+	if len(addrs) != 2 {
+		t.Fatalf("SMSC listens on %v", addrs)
+	}
+
+	receiver, err := smpp.InstantiateEsme(addrs[1], "tcp")
+	if err != nil {
+		t.Fatalf("Couldn't connect : %v", err)
+	}
+	defer receiver.Close()
+	if _, err := receiver.BindTransmitter("receiver", "secret"); err == nil {
+		t.Errorf("receiver bound as a transmitter")
+	}
+
+	sender, err := smpp.InstantiateEsme(addrs[0], "tcp")
+	if err != nil {
+		t.Fatalf("Couldn't connect : %v", err)
+	}
+	defer sender.Close()
+	if _, err := sender.BindTransmitter("sender", "secret"); err != nil {
+		t.Fatalf("Couldn't bind : %v", err)
+	}
+	responses := make(chan smpp.PDU, 1)
+	sender.CommandFunctions["submit_sm_resp"] = func(_ *smpp.ESME, pdu smpp.PDU) error {
+		responses <- pdu
+		return nil
+	}
+	sender.StartControlLoop()
+	submitSm := smpp.NewSubmitSM().WithDestinationAddress("15551234").WithMessage("Hello")
+	sentAt := time.Now()
+	if _, err := sender.Send(&submitSm); err != nil {
+		t.Fatalf("Couldn't submit : %v", err)
+	}
+	select {
+	case resp := <-responses:
+		if elapsed := time.Since(sentAt); elapsed < 100*time.Millisecond {
+			t.Errorf("submit_sm_resp came after %v, before its delay", elapsed)
+		}
+		if resp.Body.MandatoryParameter["message_id"] != "0000000001" {
+			t.Errorf("Message id isn't in the hex format : %v", resp)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("No submit_sm_resp")
+	}
+}
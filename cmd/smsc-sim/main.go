@@ -0,0 +1,78 @@
+// Command smsc-sim runs an SMSC simulator out of a YAML or JSON
+// configuration, see Config for its content.
+//
+//	smsc-sim -config smsc.yaml
+//
+// When an admin address is configured, the admin API of the SMSC is served
+// there along with its metrics on /debug/vars.  It shuts down gracefully on
+// SIGINT and SIGTERM.
+package main
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/elafontaine/smpp"
+)
+
+func main() {
+	configFile := flag.String("config", "smsc.yaml", "configuration file, YAML or JSON")
+	shutdownTimeout := flag.Duration("shutdown-timeout", 10*time.Second, "how long to wait for sessions to unbind when stopping")
+	flag.Parse()
+	logger := log.New(os.Stderr, "", log.LstdFlags)
+
+	config, err := loadConfig(*configFile)
+	if err != nil {
+		logger.Fatalf("Couldn't load %v : %v", *configFile, err)
+	}
+	smsc, err := newSMSC(config)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	if config.Verbose {
+		smsc.Logger = smpp.NewStdLogger(logger)
+	}
+	metrics := smpp.NewExpvarMetrics()
+	expvar.Publish("smpp", metrics)
+	smsc.Metrics = metrics
+	smsc.Start()
+	logger.Printf("SMSC listening on %v", smsc.Addrs())
+
+	var admin *http.Server
+	if config.Admin != "" {
+		admin = &http.Server{Addr: config.Admin, Handler: adminMux(smsc)}
+		go func() {
+			if err := admin.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				logger.Fatalf("Couldn't serve the admin API : %v", err)
+			}
+		}()
+		logger.Printf("Admin API on %v", config.Admin)
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	logger.Printf("Shutting down on %v", <-signals)
+	ctx, cancel := context.WithTimeout(context.Background(), *shutdownTimeout)
+	defer cancel()
+	if admin != nil {
+		admin.Shutdown(ctx)
+	}
+	if err := smsc.Shutdown(ctx); err != nil {
+		logger.Printf("Sessions closed before unbinding : %v", err)
+	}
+}
+
+func adminMux(smsc *smpp.SMSC) http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/", smpp.NewAdminHandler(smsc))
+	mux.Handle("/debug/vars", expvar.Handler())
+	return mux
+}
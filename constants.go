@@ -288,8 +288,6 @@ var mandatoryParameterLists = map[string][]map[string]interface{}{
 		{"name": "schedule_delivery_time", "min": 1, "max": 17, "var": false, "type": "string", "map": nil},
 		{"name": "validity_period", "min": 1, "max": 17, "var": false, "type": "string", "map": nil},
 		{"name": "registered_delivery", "min": 1, "max": 1, "var": false, "type": "integer", "map": nil},
-		{"name": "replace_if_present_flag", "min": 1, "max": 1, "var": false, "type": "integer", "map": nil},
-		{"name": "data_coding", "min": 1, "max": 1, "var": false, "type": "integer", "map": nil},
 		{"name": "sm_default_msg_id", "min": 1, "max": 1, "var": false, "type": "integer", "map": nil},
 		{"name": "sm_length", "min": 1, "max": 1, "var": false, "type": "integer", "map": nil},
 		{"name": "short_message", "min": 0, "max": 254, "var": "sm_length", "type": "xstring", "map": nil},
@@ -446,19 +444,19 @@ var fieldMappingMap = map[string]map[string]interface{}{
 		"type_default":                "00",
 		"type_delivery_receipt":       "04",
 		"type_delivery_ack":           "08",
-		"type_0011":                   "0a",
+		"type_0011":                   "0c",
 		"type_user_ack":               "10",
 		"type_0101":                   "14",
 		"type_conversation_abort":     "18",
-		"type_0111":                   "1a",
+		"type_0111":                   "1c",
 		"type_intermed_deliv_notif":   "20",
 		"type_1001":                   "24",
 		"type_1010":                   "28",
-		"type_1011":                   "2a",
+		"type_1011":                   "2c",
 		"type_1100":                   "30",
 		"type_1101":                   "34",
 		"type_1110":                   "38",
-		"type_1111":                   "3a",
+		"type_1111":                   "3c",
 		"feature_nil":                 "00",
 		"feature_UDHI":                "40",
 		"feature_reply_path":          "80",
@@ -470,7 +468,7 @@ var fieldMappingMap = map[string]map[string]interface{}{
 	"registered_delivery_bits": {
 		"receipt_mask":          "03",
 		"ack_mask":              "0c",
-		"intermed_notif_mask":   "80",
+		"intermed_notif_mask":   "10",
 		"receipt_nil":           "00",
 		"receipt_always":        "01",
 		"receipt_on_fail":       "02",
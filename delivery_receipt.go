@@ -0,0 +1,259 @@
+package smpp
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DeliveryReceipt is the decoded content of a deliver_sm (or data_sm) used by
+// an SMSC to report the outcome of a previously submitted message.  The
+// fields are taken from the receipt text (SMPP v3.4, appendix B) and completed
+// by the receipted_message_id, message_state and network_error_code TLVs
+// when those are present on the PDU.
+type DeliveryReceipt struct {
+	MessageId        string
+	Submitted        int
+	Delivered        int
+	SubmitDate       time.Time
+	DoneDate         time.Time
+	Stat             string // stat as found in the text (ie. "DELIVRD")
+	MessageState     string // name as found in message_state_by_name (ie. "DELIVERED")
+	Err              string
+	Text             string
+	NetworkType      int
+	NetworkErrorCode int
+}
+
+// Receipt "stat" values are abbreviated to 7 characters in the text format,
+// this is the mapping toward the message_state_by_name names.
+var receiptStatToMessageState = map[string]string{
+	"ENROUTE": "ENROUTE",
+	"DELIVRD": "DELIVERED",
+	"EXPIRED": "EXPIRED",
+	"DELETED": "DELETED",
+	"UNDELIV": "UNDELIVERABLE",
+	"ACCEPTD": "ACCEPTED",
+	"UNKNOWN": "UNKNOWN",
+	"REJECTD": "REJECTED",
+	"SKIPPED": "SKIPPED",
+}
+
+// Vendors aren't consistent on the case, the separator within "submit date" and
+// "done date", nor on the spacing around the colon.
+var receiptFieldRegex = regexp.MustCompile(`(?i)(?:^|\s)(id|sub|dlvrd|submit[ _]?date|done[ _]?date|stat|err|text)\s*:`)
+
+// Receipt dates are specified as YYMMDDhhmm, but some SMSCs add the seconds or
+// the century.
+var receiptDateLayouts = map[int]string{
+	10: receiptDateLayout,
+	12: "060102150405",
+	14: "20060102150405",
+}
+
+const receiptDateLayout = "0601021504"
+
+// NewDeliveryReceipt builds the deliver_sm an SMSC sends to report the state
+// of a message.  The addresses are left to the caller as they are the reverse
+// of the ones found on the original submit_sm.
+func NewDeliveryReceipt(receipt DeliveryReceipt) PDU {
+	esmClass, _ := NewEsmClass("default", "delivery_receipt")
+	pdu := NewDeliverSM().WithMessage(receipt.String()).WithEsmClass(esmClass)
+	pdu.Body.OptionalParameters = []map[string]interface{}{
+		{"tag": "receipted_message_id", "length": len(receipt.MessageId) + 1, "value": receipt.MessageId},
+	}
+	if state, ok := fieldMappingMap["message_state_by_name"][receipt.MessageState]; ok {
+		pdu.Body.OptionalParameters = append(pdu.Body.OptionalParameters,
+			map[string]interface{}{"tag": "message_state", "length": 1, "value": state})
+	}
+	if receipt.NetworkType != 0 || receipt.NetworkErrorCode != 0 {
+		errorCode := []byte{byte(receipt.NetworkType), byte(receipt.NetworkErrorCode >> 8), byte(receipt.NetworkErrorCode)}
+		pdu.Body.OptionalParameters = append(pdu.Body.OptionalParameters,
+			map[string]interface{}{"tag": "network_error_code", "length": len(errorCode), "value": errorCode})
+	}
+	return pdu
+}
+
+// String renders the receipt in the SMPP v3.4 appendix B text format.
+func (r DeliveryReceipt) String() string {
+	stat := r.Stat
+	if stat == "" {
+		stat = receiptStatFromMessageState(r.MessageState)
+	}
+	errorCode := r.Err
+	if errorCode == "" {
+		errorCode = "000"
+	}
+	return fmt.Sprintf("id:%s sub:%03d dlvrd:%03d submit date:%s done date:%s stat:%s err:%s text:%s",
+		r.MessageId, r.Submitted, r.Delivered,
+		r.SubmitDate.Format(receiptDateLayout), r.DoneDate.Format(receiptDateLayout),
+		stat, errorCode, r.Text)
+}
+
+func receiptStatFromMessageState(state string) string {
+	for stat, name := range receiptStatToMessageState {
+		if name == state {
+			return stat
+		}
+	}
+	return "UNKNOWN"
+}
+
+// IsDeliveryReceipt tells if the PDU is a deliver_sm or data_sm flagged as a
+// delivery receipt in its esm_class.
+func IsDeliveryReceipt(pdu PDU) bool {
+	if pdu.Header.CommandId != "deliver_sm" && pdu.Header.CommandId != "data_sm" {
+		return false
+	}
+	return pdu.GetEsmClass().IsDeliveryReceipt()
+}
+
+// ParseDeliveryReceipt extracts the delivery receipt out of the PDU text and
+// TLVs.  The TLVs take precedence over the text as they are the
+// authoritative source in SMPP v3.4.
+func ParseDeliveryReceipt(pdu PDU) (receipt DeliveryReceipt, err error) {
+	shortMessage, _ := pdu.Body.MandatoryParameter["short_message"].(string)
+	receipt, err = parseDeliveryReceiptText(shortMessage)
+	if err != nil {
+		return receipt, err
+	}
+	err = applyDeliveryReceiptOptionalParameters(pdu, &receipt)
+	if err != nil {
+		return receipt, err
+	}
+	if receipt.MessageId == "" {
+		return receipt, fmt.Errorf("No message id found in delivery receipt : %v", pdu)
+	}
+	return receipt, nil
+}
+
+func parseDeliveryReceiptText(text string) (receipt DeliveryReceipt, err error) {
+	fields := splitDeliveryReceiptText(text)
+	receipt.MessageId = fields["id"]
+	receipt.Err = fields["err"]
+	receipt.Text = fields["text"]
+	if receipt.Submitted, err = parseReceiptCounter(fields, "sub"); err != nil {
+		return receipt, err
+	}
+	if receipt.Delivered, err = parseReceiptCounter(fields, "dlvrd"); err != nil {
+		return receipt, err
+	}
+	if receipt.SubmitDate, err = parseReceiptDate(fields, "submit date"); err != nil {
+		return receipt, err
+	}
+	if receipt.DoneDate, err = parseReceiptDate(fields, "done date"); err != nil {
+		return receipt, err
+	}
+	if stat, ok := fields["stat"]; ok {
+		receipt.Stat = stat
+		receipt.MessageState = messageStateFromReceiptStat(stat)
+	}
+	return receipt, nil
+}
+
+func splitDeliveryReceiptText(text string) map[string]string {
+	fields := map[string]string{}
+	matches := receiptFieldRegex.FindAllStringSubmatchIndex(text, -1)
+	for i, match := range matches {
+		key := normalizeReceiptKey(text[match[2]:match[3]])
+		end := len(text)
+		if key != "text" && i+1 < len(matches) {
+			end = matches[i+1][0]
+		}
+		fields[key] = strings.TrimSpace(text[match[1]:end])
+		if key == "text" {
+			break // the text is free form and could contain anything looking like a key
+		}
+	}
+	return fields
+}
+
+func normalizeReceiptKey(key string) string {
+	key = strings.ToLower(key)
+	key = strings.ReplaceAll(key, "_", " ")
+	switch key {
+	case "submitdate":
+		return "submit date"
+	case "donedate":
+		return "done date"
+	}
+	return key
+}
+
+func parseReceiptCounter(fields map[string]string, key string) (int, error) {
+	value, ok := fields[key]
+	if !ok || value == "" {
+		return 0, nil
+	}
+	counter, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("Invalid %v value in delivery receipt : %w", key, err)
+	}
+	return counter, nil
+}
+
+func parseReceiptDate(fields map[string]string, key string) (time.Time, error) {
+	value, ok := fields[key]
+	if !ok || value == "" {
+		return time.Time{}, nil
+	}
+	layout, ok := receiptDateLayouts[len(value)]
+	if !ok {
+		return time.Time{}, fmt.Errorf("Invalid %v value in delivery receipt : %v", key, value)
+	}
+	date, err := time.Parse(layout, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("Invalid %v value in delivery receipt : %w", key, err)
+	}
+	return date, nil
+}
+
+func messageStateFromReceiptStat(stat string) string {
+	stat = strings.ToUpper(stat)
+	if state, ok := receiptStatToMessageState[stat]; ok {
+		return state
+	}
+	if _, ok := fieldMappingMap["message_state_by_name"][stat]; ok {
+		return stat
+	}
+	return "UNKNOWN"
+}
+
+func messageStateNameFromValue(value int) (string, bool) {
+	for name, state := range fieldMappingMap["message_state_by_name"] {
+		if state == value {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+func applyDeliveryReceiptOptionalParameters(pdu PDU, receipt *DeliveryReceipt) error {
+	if value, ok := pdu.getOptionalParameter("receipted_message_id"); ok {
+		if messageId, ok := value.(string); ok && messageId != "" {
+			receipt.MessageId = messageId
+		}
+	}
+	if value, ok := pdu.getOptionalParameter("message_state"); ok {
+		state, ok := value.(int)
+		if !ok {
+			return fmt.Errorf("Invalid message_state in delivery receipt : %v", value)
+		}
+		name, ok := messageStateNameFromValue(state)
+		if !ok {
+			return fmt.Errorf("Unknown message_state in delivery receipt : %v", state)
+		}
+		receipt.MessageState = name
+	}
+	if value, ok := pdu.getOptionalParameter("network_error_code"); ok {
+		errorCode, ok := value.([]byte)
+		if !ok || len(errorCode) != 3 {
+			return fmt.Errorf("Invalid network_error_code in delivery receipt : %v", value)
+		}
+		receipt.NetworkType = int(errorCode[0])
+		receipt.NetworkErrorCode = int(errorCode[1])<<8 | int(errorCode[2])
+	}
+	return nil
+}
@@ -0,0 +1,185 @@
+package smpp
+
+import (
+	"encoding/hex"
+	"reflect"
+	"testing"
+	"time"
+)
+
+var deliveryReceiptWithNetworkErrorFixture, _ = hex.DecodeString("00000041000000050000000000000001000000000000353535353535313233340004000000000000000000001e000631313130370004270001050423000303000a")
+
+func TestIsDeliveryReceipt(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name string
+		pdu  PDU
+		want bool
+	}{
+		{"deliver_sm flagged as receipt", NewDeliverSM().WithDefaults(map[string]interface{}{"esm_class": 4}), true},
+		{"data_sm flagged as receipt", NewDataSM().WithDefaults(map[string]interface{}{"esm_class": 4}), true},
+		{"receipt flag with UDHI", NewDeliverSM().WithDefaults(map[string]interface{}{"esm_class": 0x44}), true},
+		{"deliver_sm as mobile originated", NewDeliverSM(), false},
+		{"intermediate notification isn't a receipt", NewDeliverSM().WithDefaults(map[string]interface{}{"esm_class": 0x20}), false},
+		{"submit_sm can't be a receipt", NewSubmitSM().WithDefaults(map[string]interface{}{"esm_class": 4}), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsDeliveryReceipt(tt.pdu); got != tt.want {
+				t.Errorf("IsDeliveryReceipt() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseDeliveryReceiptText(t *testing.T) {
+	t.Parallel()
+	submitDate := time.Date(2023, 5, 17, 13, 45, 0, 0, time.UTC)
+	doneDate := time.Date(2023, 5, 17, 13, 46, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		text string
+		want DeliveryReceipt
+	}{
+		{
+			"SMPP v3.4 appendix B format",
+			"id:0123456789 sub:001 dlvrd:001 submit date:2305171345 done date:2305171346 stat:DELIVRD err:000 text:Hello world",
+			DeliveryReceipt{MessageId: "0123456789", Submitted: 1, Delivered: 1, SubmitDate: submitDate, DoneDate: doneDate, Stat: "DELIVRD", MessageState: "DELIVERED", Err: "000", Text: "Hello world"},
+		},
+		{
+			"underscores, upper case keys and seconds in dates",
+			"id:abc123 sub:1 dlvrd:0 submit_date:230517134500 done_date:230517134600 stat:UNDELIV err:042 Text:Hello",
+			DeliveryReceipt{MessageId: "abc123", Submitted: 1, SubmitDate: submitDate, DoneDate: doneDate, Stat: "UNDELIV", MessageState: "UNDELIVERABLE", Err: "042", Text: "Hello"},
+		},
+		{
+			"missing optional fields and full state name",
+			"id:42 stat:REJECTED",
+			DeliveryReceipt{MessageId: "42", Stat: "REJECTED", MessageState: "REJECTED"},
+		},
+		{
+			"text containing keys isn't split",
+			"id:42 stat:EXPIRED text:stat:DELIVRD id:1",
+			DeliveryReceipt{MessageId: "42", Stat: "EXPIRED", MessageState: "EXPIRED", Text: "stat:DELIVRD id:1"},
+		},
+		{
+			"unknown stat is reported as UNKNOWN",
+			"id:42 stat:WHATEVER",
+			DeliveryReceipt{MessageId: "42", Stat: "WHATEVER", MessageState: "UNKNOWN"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pdu := NewDeliverSM().WithMessage(tt.text).WithDefaults(map[string]interface{}{"esm_class": 4})
+			got, err := ParseDeliveryReceipt(pdu)
+			if err != nil {
+				t.Errorf("ParseDeliveryReceipt() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseDeliveryReceipt() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseDeliveryReceiptOptionalParameters(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name    string
+		fixture []byte
+		want    DeliveryReceipt
+	}{
+		{"receipted_message_id and message_state", deliverSmOptionsFixture, DeliveryReceipt{MessageId: "11107", MessageState: "DELIVERED"}},
+		{"network_error_code", deliveryReceiptWithNetworkErrorFixture, DeliveryReceipt{MessageId: "11107", MessageState: "UNDELIVERABLE", NetworkType: 3, NetworkErrorCode: 10}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pdu, err := ParsePdu(tt.fixture)
+			if err != nil {
+				t.Fatalf("Couldn't parse fixture : %v", err)
+			}
+			if !IsDeliveryReceipt(pdu) {
+				t.Errorf("Fixture should be a delivery receipt : %v", pdu)
+			}
+			got, err := ParseDeliveryReceipt(pdu)
+			if err != nil {
+				t.Errorf("ParseDeliveryReceipt() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseDeliveryReceipt() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseDeliveryReceiptTlvTakesPrecedenceOverText(t *testing.T) {
+	t.Parallel()
+	pdu := NewDeliverSM().WithMessage("id:1 stat:ENROUTE")
+	pdu.Body.OptionalParameters = []map[string]interface{}{
+		{"tag": "receipted_message_id", "length": 3, "value": "2a"},
+		{"tag": "message_state", "length": 1, "value": 2},
+	}
+	got, err := ParseDeliveryReceipt(pdu)
+	if err != nil {
+		t.Errorf("ParseDeliveryReceipt() error = %v", err)
+	}
+	if got.MessageId != "2a" || got.MessageState != "DELIVERED" || got.Stat != "ENROUTE" {
+		t.Errorf("TLVs weren't applied over the text : %+v", got)
+	}
+}
+
+func TestParseDeliveryReceiptInvalidCases(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name string
+		text string
+	}{
+		{"no message id", "sub:001 dlvrd:001 stat:DELIVRD"},
+		{"non numeric submitted counter", "id:1 sub:abc"},
+		{"invalid date length", "id:1 submit date:2305"},
+		{"invalid date", "id:1 done date:2399171345"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseDeliveryReceipt(NewDeliverSM().WithMessage(tt.text))
+			if err == nil {
+				t.Errorf("ParseDeliveryReceipt() should have failed on %q", tt.text)
+			}
+		})
+	}
+}
+
+func TestNewDeliveryReceiptRoundTrip(t *testing.T) {
+	t.Parallel()
+	expectedReceipt := DeliveryReceipt{
+		MessageId:        "abc123",
+		Submitted:        1,
+		Delivered:        0,
+		SubmitDate:       time.Date(2023, 5, 17, 13, 45, 0, 0, time.UTC),
+		DoneDate:         time.Date(2023, 5, 17, 13, 46, 0, 0, time.UTC),
+		Stat:             "UNDELIV",
+		MessageState:     "UNDELIVERABLE",
+		Err:              "000",
+		Text:             "Hello",
+		NetworkType:      3,
+		NetworkErrorCode: 10,
+	}
+	receiptPdu := NewDeliveryReceipt(expectedReceipt).WithSequenceNumber(1)
+	receiptBytes, err := EncodePdu(receiptPdu)
+	if err != nil {
+		t.Fatalf("Couldn't encode the delivery receipt : %v", err)
+	}
+	parsedPdu, err := ParsePdu(receiptBytes)
+	if err != nil || !IsDeliveryReceipt(parsedPdu) {
+		t.Fatalf("Couldn't parse back the delivery receipt : %v, %v", parsedPdu, err)
+	}
+	if parsedPdu.Body.MandatoryParameter["sm_length"] != len(expectedReceipt.String()) {
+		t.Errorf("sm_length wasn't computed from the receipt text : %v", parsedPdu)
+	}
+	actualReceipt, err := ParseDeliveryReceipt(parsedPdu)
+	if err != nil {
+		t.Errorf("ParseDeliveryReceipt() error = %v", err)
+	}
+	if !reflect.DeepEqual(actualReceipt, expectedReceipt) {
+		t.Errorf("ParseDeliveryReceipt() = %+v, want %+v", actualReceipt, expectedReceipt)
+	}
+}
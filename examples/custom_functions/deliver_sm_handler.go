@@ -47,12 +47,11 @@ const (
 	expectedMessageId          = "1"
 )
 
-func init() {
-	DebugSmppLogger = log.New(os.Stdout, "DEBUG: ", log.Ldate|log.Ltime|log.Lshortfile)
-	InfoSmppLogger = log.New(os.Stdout, "INFO: ", log.Ldate|log.Ltime|log.Lshortfile)
-	WarningSmppLogger = log.New(os.Stdout, "WARNING: ", log.Ldate|log.Ltime|log.Lshortfile)
-	ErrorSmppLogger = log.New(os.Stdout, "ERROR: ", log.Ldate|log.Ltime|log.Lshortfile)
-}
+var (
+	DebugLogger = log.New(os.Stdout, "DEBUG: ", log.Ldate|log.Ltime|log.Lshortfile)
+	InfoLogger  = log.New(os.Stdout, "INFO: ", log.Ldate|log.Ltime|log.Lshortfile)
+	SmppLogger  = NewStdLogger(log.New(os.Stdout, "", log.Ldate|log.Ltime))
+)
 
 func step1(server_smpp_conn_obj *ESME) {
 	deliverSM := NewDeliverSM().
@@ -65,13 +64,13 @@ func step1(server_smpp_conn_obj *ESME) {
 		fmt.Print(fmt.Errorf("Couldn't send on esme : %v", err))
 		os.Exit(1)
 	}
-	InfoSmppLogger.Println("Sent")
+	InfoLogger.Println("Sent")
 }
 
 func step2(receivedMessageChannel chan *pduNeedingAnswer) func(e *ESME, p PDU) error {
 	return func(e *ESME, p PDU) error {
 		current_state := e.GetEsmeState()
-		DebugSmppLogger.Printf("Pdu received on client : %v", p)
+		DebugLogger.Printf("Pdu received on client : %v", p)
 		if !(current_state == BOUND_RX || current_state == BOUND_TRX) {
 			resp_pdu := NewDeliverSMResp().WithSequenceNumber(p.Header.SequenceNumber)
 			resp_pdu.WithSMPPError(ESME_RINVBNDSTS)
@@ -121,6 +120,7 @@ func main() {
 
 	serversocket, _ := net.Listen(connType, "0.0.0.0:0")
 	smsc := NewSMSC(&serversocket, "MySystemId", "Password")
+	smsc.Logger = SmppLogger
 
 	// Client side example (using the prepared server side)
 	esme, err := InstantiateEsme(serversocket.Addr(), connType)
@@ -133,6 +133,7 @@ func main() {
 
 	// function that step 2 will be calling on the esme_client
 	esme.CommandFunctions["deliver_sm"] = step2(receivedMessageChannel)
+	esme.SetLogger(SmppLogger)
 	esme.StartControlLoop()
 	defer esme.Close()
 
@@ -148,7 +149,7 @@ func main() {
 	step5processing_channel := make(chan bool)
 	server_smpp_conn_obj.CommandFunctions["deliver_sm_resp"] = step5(step5processing_channel)
 
-	InfoSmppLogger.Println("About to send")
+	InfoLogger.Println("About to send")
 	// Step 1, skipping the response pdu checks
 	step1(server_smpp_conn_obj)
 	Wait10SecondsForAnAnswerOrContinue(step5processing_channel)
@@ -161,7 +162,7 @@ func main() {
 func Wait10SecondsForAnAnswerOrContinue(step5processing_channel chan bool) {
 	select {
 	case <-time.After(10 * time.Second):
-		InfoSmppLogger.Fatalln("Timeout of the program.")
+		InfoLogger.Fatalln("Timeout of the program.")
 	case <-step5processing_channel:
 
 	}
@@ -0,0 +1,90 @@
+package smpp
+
+import (
+	"errors"
+	"fmt"
+)
+
+// PduHandler carries a PDU of the ESME further, see Interceptor.
+type PduHandler func(e *ESME, pdu PDU) error
+
+// Interceptor sees every PDU going out of an ESME before it's written, or
+// coming in once read and before anything else reacts to it.  It passes the
+// PDU, modified or not, to next or stops it by not calling next.  Stopped
+// PDUs are answered when the interceptor returns an InterceptedResponse (see
+// RejectPdu), otherwise they're rejected: Send gives back the error and
+// received PDUs are dropped.  Interceptors run in the order they're added,
+// the first one seeing the PDU first.
+type Interceptor func(e *ESME, pdu PDU, next PduHandler) error
+
+// InterceptedResponse is returned by an interceptor answering the PDU itself.
+// Requests sent by the ESME get it as their response without reaching the
+// remote end, received ones get it sent back.  A zero sequence_number is
+// the one of the PDU answered.
+type InterceptedResponse struct {
+	Response PDU
+}
+
+func (r InterceptedResponse) Error() string {
+	return fmt.Sprintf("intercepted with %v", r.Response.Header.CommandId)
+}
+
+func (r InterceptedResponse) answering(pdu PDU) PDU {
+	if r.Response.Header.SequenceNumber == 0 {
+		r.Response.Header.SequenceNumber = pdu.Header.SequenceNumber
+	}
+	return r.Response
+}
+
+// RejectPdu gives the InterceptedResponse answering the PDU with the status,
+// a generic_nack for the PDUs without any response.
+func RejectPdu(pdu PDU, status string) error {
+	return InterceptedResponse{responseTo(pdu).WithSMPPError(status)}
+}
+
+// InterceptOutbound adds interceptors to the PDUs sent, it must be called
+// before starting the control loop.
+func (e *ESME) InterceptOutbound(interceptors ...Interceptor) {
+	e.outbound = append(e.outbound, interceptors...)
+}
+
+// InterceptInbound adds interceptors to the PDUs received, it must be called
+// before starting the control loop.
+func (e *ESME) InterceptInbound(interceptors ...Interceptor) {
+	e.inbound = append(e.inbound, interceptors...)
+}
+
+func chainInterceptors(interceptors []Interceptor, handler PduHandler) PduHandler {
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		interceptor, next := interceptors[i], handler
+		handler = func(e *ESME, pdu PDU) error {
+			return interceptor(e, pdu, next)
+		}
+	}
+	return handler
+}
+
+// interceptInbound gives the PDU let through the inbound interceptors, or
+// false once the PDU is answered or dropped.
+func (e *ESME) interceptInbound(pdu PDU) (PDU, bool) {
+	var received *PDU
+	err := chainInterceptors(e.inbound, func(_ *ESME, pdu PDU) error {
+		received = &pdu
+		return nil
+	})(e, pdu)
+	if received != nil {
+		if err != nil {
+			withPdu(e.logger, pdu).Warn("Inbound interceptor failed after passing the PDU", "error", err)
+		}
+		return *received, true
+	}
+	var intercepted InterceptedResponse
+	if !errors.As(err, &intercepted) {
+		withPdu(e.logger, pdu).Info("PDU dropped by an inbound interceptor", "error", err)
+		return pdu, false
+	}
+	if err = e.sendPdu(intercepted.answering(pdu)); err != nil {
+		withPdu(e.logger, pdu).Warn("Couldn't send the response of an inbound interceptor", "error", err)
+	}
+	return pdu, false
+}
@@ -0,0 +1,113 @@
+package smpp
+
+import (
+	"errors"
+	"sync"
+	"testing"
+)
+
+func TestInterceptorsRunInOrderAndCanModifyPdus(t *testing.T) {
+	smsc, err := GetSmscSimulatorServer()
+	if err != nil {
+		t.Fatalf("couldn't start server successfully: %v", err)
+	}
+	var mu sync.Mutex
+	seen := []string{}
+	record := func(name string) Interceptor {
+		return func(e *ESME, pdu PDU, next PduHandler) error {
+			if pdu.Header.CommandId == "submit_sm" {
+				mu.Lock()
+				seen = append(seen, name+" "+pdu.GetSource().Addr)
+				mu.Unlock()
+			}
+			return next(e, pdu)
+		}
+	}
+	smsc.InboundInterceptors = []Interceptor{record("smsc")}
+	smsc.Start()
+	Esme, err := InstantiateEsme(smsc.listeningSocket.Addr(), connType)
+	if err != nil {
+		t.Fatalf("couldn't connect client to server successfully: %v", err)
+	}
+	defer CloseAndAssertClean(smsc, Esme, t)
+	rewriteSource := func(e *ESME, pdu PDU, next PduHandler) error {
+		if pdu.Header.CommandId == "submit_sm" {
+			pdu = pdu.WithSourceAddress("5550000")
+		}
+		return next(e, pdu)
+	}
+	Esme.InterceptOutbound(record("first"), rewriteSource, record("last"))
+
+	if _, err = Esme.BindTransmitter(validSystemID, validPassword); err != nil {
+		t.Fatalf("Couldn't bind with the SMSC : %v", err)
+	}
+	if _, err = Esme.sendAndWaitForResponse(NewSubmitSM().WithSourceAddress("5551111").WithMessage("Hello")); err != nil {
+		t.Fatalf("Couldn't submit : %v", err)
+	}
+
+	want := []string{"first 5551111", "last 5550000", "smsc 5550000"}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(seen) != len(want) {
+		t.Fatalf("Interceptors saw %v, want %v", seen, want)
+	}
+	for i := range want {
+		if seen[i] != want[i] {
+			t.Errorf("Interceptors saw %v, want %v", seen, want)
+		}
+	}
+}
+
+func TestInterceptorsCanAnswerOrRejectPdus(t *testing.T) {
+	smsc, err := GetSmscSimulatorServer()
+	if err != nil {
+		t.Fatalf("couldn't start server successfully: %v", err)
+	}
+	smsc.InboundInterceptors = []Interceptor{func(e *ESME, pdu PDU, next PduHandler) error {
+		if pdu.GetDestination().Addr == "5559999" {
+			return RejectPdu(pdu, ESME_RINVDSTADR)
+		}
+		return next(e, pdu)
+	}}
+	smsc.Start()
+	Esme, err := InstantiateEsme(smsc.listeningSocket.Addr(), connType)
+	if err != nil {
+		t.Fatalf("couldn't connect client to server successfully: %v", err)
+	}
+	defer CloseAndAssertClean(smsc, Esme, t)
+	errOffline := errors.New("offline")
+	Esme.InterceptOutbound(func(e *ESME, pdu PDU, next PduHandler) error {
+		switch pdu.GetDestination().Addr {
+		case "5558888":
+			return RejectPdu(pdu, ESME_RTHROTTLED)
+		case "5557777":
+			return errOffline
+		}
+		return next(e, pdu)
+	})
+	if _, err = Esme.BindTransmitter(validSystemID, validPassword); err != nil {
+		t.Fatalf("Couldn't bind with the SMSC : %v", err)
+	}
+
+	tests := []struct {
+		destination string
+		wantStatus  string
+	}{
+		{"5559999", ESME_RINVDSTADR},
+		{"5558888", ESME_RTHROTTLED},
+	}
+	for _, tt := range tests {
+		submitSm := NewSubmitSM().WithDestinationAddress(tt.destination).WithMessage("Hello")
+		resp, err := Esme.sendAndWaitForResponse(submitSm)
+		if resp == nil || resp.Header.CommandStatus != tt.wantStatus || resp.Header.SequenceNumber == 0 {
+			t.Errorf("Submit to %v answered with %v (%v), want %v", tt.destination, resp, err, tt.wantStatus)
+		}
+	}
+	submitSm := NewSubmitSM().WithDestinationAddress("5557777").WithMessage("Hello")
+	if _, err = Esme.Send(&submitSm); !errors.Is(err, errOffline) {
+		t.Errorf("Send should give back the error of the interceptor : %v", err)
+	}
+	if messages, _ := smsc.MessageStore.List(); len(messages) != 0 {
+		t.Errorf("Intercepted messages shouldn't reach the SMSC : %v", messages)
+	}
+}
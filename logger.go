@@ -0,0 +1,112 @@
+package smpp
+
+import (
+	"fmt"
+	"log"
+	"strings"
+)
+
+// Logger is what ESMEs and SMSCs log through, a *slog.Logger satisfies it.
+// Arguments are key/value pairs like for log/slog, ESMEs adding their
+// remote_addr and sessions their system_id once bound.  Without any Logger,
+// nothing is logged but to the deprecated *SmppLogger variables.
+type Logger interface {
+	Debug(msg string, args ...any)
+	Info(msg string, args ...any)
+	Warn(msg string, args ...any)
+	Error(msg string, args ...any)
+}
+
+// Deprecated: give a Logger to the ESME or SMSC instead, ie. NewStdLogger.
+// ESMEs and SMSCs without a Logger of their own write each level to its
+// *log.Logger when set.
+var (
+	DebugSmppLogger   *log.Logger
+	WarningSmppLogger *log.Logger
+	InfoSmppLogger    *log.Logger
+	ErrorSmppLogger   *log.Logger
+)
+
+type silentLogger struct{}
+
+func (silentLogger) Debug(string, ...any) {}
+func (silentLogger) Info(string, ...any)  {}
+func (silentLogger) Warn(string, ...any)  {}
+func (silentLogger) Error(string, ...any) {}
+
+// loggerWith gives a Logger adding the key/value pairs to every record, like
+// slog.Logger.With does.
+func loggerWith(logger Logger, args ...any) Logger {
+	if logger == nil {
+		return silentLogger{}
+	}
+	if _, silent := logger.(silentLogger); silent {
+		return logger
+	}
+	return scopedLogger{logger, args}
+}
+
+func withPdu(logger Logger, pdu PDU) Logger {
+	return loggerWith(logger, "command_id", pdu.Header.CommandId, "sequence_number", pdu.Header.SequenceNumber)
+}
+
+type scopedLogger struct {
+	logger Logger
+	args   []any
+}
+
+func (l scopedLogger) Debug(msg string, args ...any) { l.logger.Debug(msg, l.with(args)...) }
+func (l scopedLogger) Info(msg string, args ...any)  { l.logger.Info(msg, l.with(args)...) }
+func (l scopedLogger) Warn(msg string, args ...any)  { l.logger.Warn(msg, l.with(args)...) }
+func (l scopedLogger) Error(msg string, args ...any) { l.logger.Error(msg, l.with(args)...) }
+
+func (l scopedLogger) with(args []any) []any {
+	return append(l.args[:len(l.args):len(l.args)], args...)
+}
+
+// NewStdLogger adapts a *log.Logger, records are written as their level and
+// message followed by their key=value pairs.
+func NewStdLogger(logger *log.Logger) Logger {
+	return stdLogger{logger}
+}
+
+type stdLogger struct {
+	logger *log.Logger
+}
+
+func (l stdLogger) Debug(msg string, args ...any) { l.print("DEBUG", msg, args) }
+func (l stdLogger) Info(msg string, args ...any)  { l.print("INFO", msg, args) }
+func (l stdLogger) Warn(msg string, args ...any)  { l.print("WARN", msg, args) }
+func (l stdLogger) Error(msg string, args ...any) { l.print("ERROR", msg, args) }
+
+func (l stdLogger) print(level string, msg string, args []any) {
+	l.logger.Print(level + " " + formatRecord(msg, args))
+}
+
+func formatRecord(msg string, args []any) string {
+	var record strings.Builder
+	record.WriteString(msg)
+	for i := 0; i < len(args); i += 2 {
+		if i+1 == len(args) {
+			fmt.Fprintf(&record, " !BADKEY=%v", args[i])
+			break
+		}
+		fmt.Fprintf(&record, " %v=%v", args[i], args[i+1])
+	}
+	return record.String()
+}
+
+// legacyLogger writes to the deprecated *SmppLogger variables, looked up on
+// every record as they can be set at any time.  Their prefix gives the level.
+type legacyLogger struct{}
+
+func (legacyLogger) Debug(msg string, args ...any) { printLegacy(DebugSmppLogger, msg, args) }
+func (legacyLogger) Info(msg string, args ...any)  { printLegacy(InfoSmppLogger, msg, args) }
+func (legacyLogger) Warn(msg string, args ...any)  { printLegacy(WarningSmppLogger, msg, args) }
+func (legacyLogger) Error(msg string, args ...any) { printLegacy(ErrorSmppLogger, msg, args) }
+
+func printLegacy(logger *log.Logger, msg string, args []any) {
+	if logger != nil {
+		logger.Print(formatRecord(msg, args))
+	}
+}
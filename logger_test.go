@@ -0,0 +1,113 @@
+package smpp
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+)
+
+type recordingLogger struct {
+	mu      sync.Mutex
+	records []string
+}
+
+func (l *recordingLogger) record(level string, msg string, args []any) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.records = append(l.records, fmt.Sprint(level, " ", msg, " ", args))
+}
+
+func (l *recordingLogger) Debug(msg string, args ...any) { l.record("DEBUG", msg, args) }
+func (l *recordingLogger) Info(msg string, args ...any)  { l.record("INFO", msg, args) }
+func (l *recordingLogger) Warn(msg string, args ...any)  { l.record("WARN", msg, args) }
+func (l *recordingLogger) Error(msg string, args ...any) { l.record("ERROR", msg, args) }
+
+func (l *recordingLogger) find(msg string) (string, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, record := range l.records {
+		if strings.Contains(record, msg) {
+			return record, true
+		}
+	}
+	return "", false
+}
+
+func TestStdLoggerWritesLevelMessageAndPairs(t *testing.T) {
+	output := bytes.Buffer{}
+	logger := loggerWith(NewStdLogger(log.New(&output, "", 0)), "remote_addr", "127.0.0.1:2775")
+
+	withPdu(logger, NewSubmitSM().WithSequenceNumber(3)).Warn("Rejecting message", "status", ESME_RSUBMITFAIL, "odd")
+
+	want := "WARN Rejecting message remote_addr=127.0.0.1:2775 command_id=submit_sm sequence_number=3 status=ESME_RSUBMITFAIL !BADKEY=odd\n"
+	if output.String() != want {
+		t.Errorf("Logged %q, want %q", output.String(), want)
+	}
+}
+
+func TestLoggerWithKeepsScopesApart(t *testing.T) {
+	recorder := &recordingLogger{}
+	session := loggerWith(recorder, "remote_addr", "a")
+	loggerWith(session, "system_id", "first").Info("one")
+	loggerWith(session, "system_id", "second").Info("two")
+
+	for msg, want := range map[string]string{"one": "[remote_addr a system_id first]", "two": "[remote_addr a system_id second]"} {
+		if record, _ := recorder.find(msg); !strings.HasSuffix(record, want) {
+			t.Errorf("Record %q should end with %v", record, want)
+		}
+	}
+}
+
+func TestSmscLogsWithTheFieldsOfTheSession(t *testing.T) {
+	smsc, err := GetSmscSimulatorServer()
+	if err != nil {
+		t.Fatalf("couldn't start server successfully: %v", err)
+	}
+	recorder := &recordingLogger{}
+	smsc.Logger = recorder
+	smsc.Start()
+	Esme, err := InstantiateEsme(smsc.listeningSocket.Addr(), connType)
+	if err != nil {
+		t.Fatalf("couldn't connect client to server successfully: %v", err)
+	}
+	defer CloseAndAssertClean(smsc, Esme, t)
+
+	if _, err = Esme.BindTransmitter(validSystemID, validPassword); err != nil {
+		t.Fatalf("Couldn't bind with the SMSC : %v", err)
+	}
+	submitSm := NewSubmitSM().WithDestinationAddress("5551234").WithMessage("Hello")
+	submitSm.Body.MandatoryParameter["schedule_delivery_time"] = "not a time"
+	resp, _ := Esme.sendAndWaitForResponse(submitSm)
+	if resp == nil {
+		t.Fatalf("submit_sm wasn't answered")
+	}
+
+	record, ok := recorder.find("Rejecting message")
+	want := fmt.Sprintf("[remote_addr %v system_id %v command_id submit_sm sequence_number %v status %v",
+		Esme.clientSocket.LocalAddr(), validSystemID, resp.Header.SequenceNumber, resp.Header.CommandStatus)
+	if !ok || !strings.Contains(record, want) {
+		t.Errorf("Record %q should contain %v", record, want)
+	}
+}
+
+func TestDeprecatedLoggersStillGetTheRecordsOfTheirLevel(t *testing.T) {
+	output := bytes.Buffer{}
+	InfoSmppLogger = log.New(&output, "INFO: ", 0)
+	defer func() { InfoSmppLogger = nil }()
+
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	logger := loggerWith(NewEsme(client).logger, "system_id", validSystemID)
+	logger.Info("Bind refused", "status", ESME_RBINDFAIL)
+	logger.Warn("Nobody listens to warnings")
+
+	if want := "INFO: Bind refused system_id=SystemId status=ESME_RBINDFAIL\n"; output.String() != want {
+		t.Errorf("Logged %q, want %q", output.String(), want)
+	}
+}
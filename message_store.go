@@ -0,0 +1,168 @@
+package smpp
+
+import (
+	"crypto/rand"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const ErrMessageNotFound = Error("message not found")
+
+// MessageIdGenerator gives the message_id of every message accepted by the
+// SMSC.  It's called concurrently and must never give the same id twice.
+type MessageIdGenerator func() string
+
+// NewCounterMessageIdGenerator gives "1", "2", "3", ...
+func NewCounterMessageIdGenerator() MessageIdGenerator {
+	var counter uint64
+	return func() string {
+		return strconv.FormatUint(atomic.AddUint64(&counter, 1), 10)
+	}
+}
+
+// NewHexMessageIdGenerator gives a counter rendered as 10 hexadecimal
+// digits ("0000000001", ..., "000000000a"), the format of many SMSCs.
+func NewHexMessageIdGenerator() MessageIdGenerator {
+	var counter uint64
+	return func() string {
+		return fmt.Sprintf("%010x", atomic.AddUint64(&counter, 1))
+	}
+}
+
+// NewUUIDMessageIdGenerator gives random (version 4) UUIDs, which stay
+// unique across SMSC restarts.
+func NewUUIDMessageIdGenerator() MessageIdGenerator {
+	return func() string {
+		uuid := make([]byte, 16)
+		if _, err := rand.Read(uuid); err != nil {
+			panic(fmt.Sprintf("Couldn't read random bytes for a message id : %v", err))
+		}
+		uuid[6] = uuid[6]&0x0f | 0x40
+		uuid[8] = uuid[8]&0x3f | 0x80
+		return fmt.Sprintf("%x-%x-%x-%x-%x", uuid[0:4], uuid[4:6], uuid[6:8], uuid[8:10], uuid[10:16])
+	}
+}
+
+// StoredMessage is a message accepted by the SMSC.  State is a name of
+// message_state_by_name and DoneDate stays zero until the message reaches a
+// final state.  A zero ScheduleDeliveryTime means an immediate delivery and
+// a zero ExpiryTime means the message never expires.  Pdu is the submit_sm
+// as it was received, or as replaced by a replace_sm.
+type StoredMessage struct {
+	MessageId            string
+	SystemId             string
+	Source               Address
+	Destination          Address
+	State                string
+	SubmitDate           time.Time
+	ScheduleDeliveryTime time.Time
+	ExpiryTime           time.Time
+	DoneDate             time.Time
+	ErrorCode            int
+	Pdu                  PDU
+}
+
+// MessageStore persists the messages accepted by the SMSC.  Update applies the
+// change while holding the message, so concurrent updates can't be lost.
+type MessageStore interface {
+	Store(message StoredMessage) error
+	Get(messageId string) (StoredMessage, error)
+	Update(messageId string, update func(message *StoredMessage) error) error
+	List() ([]StoredMessage, error)
+}
+
+// InMemoryMessageStore keeps the messages in memory.  Messages that reached a
+// final state are forgotten, in the order they reached it, once done MaxAge
+// before the latest message submitted or done, and once there are more than
+// MaxFinalMessages of them.  Zero means no limit, they must be set
+// before the store is used.
+type InMemoryMessageStore struct {
+	MaxAge           time.Duration
+	MaxFinalMessages int
+	mu               sync.RWMutex
+	messages         map[string]StoredMessage
+	done             []string // ids of the final messages, in the order they got final
+}
+
+func NewInMemoryMessageStore() *InMemoryMessageStore {
+	return &InMemoryMessageStore{messages: map[string]StoredMessage{}}
+}
+
+func (s *InMemoryMessageStore) Store(message StoredMessage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.messages[message.MessageId]; exists {
+		return fmt.Errorf("message %v is already stored", message.MessageId)
+	}
+	s.messages[message.MessageId] = message
+	if !message.DoneDate.IsZero() {
+		s.done = append(s.done, message.MessageId)
+	}
+	s.evict(message.SubmitDate)
+	return nil
+}
+
+func (s *InMemoryMessageStore) Get(messageId string) (StoredMessage, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	message, ok := s.messages[messageId]
+	if !ok {
+		return StoredMessage{}, fmt.Errorf("%w : %v", ErrMessageNotFound, messageId)
+	}
+	return message, nil
+}
+
+func (s *InMemoryMessageStore) Update(messageId string, update func(message *StoredMessage) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	message, ok := s.messages[messageId]
+	if !ok {
+		return fmt.Errorf("%w : %v", ErrMessageNotFound, messageId)
+	}
+	wasDone := !message.DoneDate.IsZero()
+	if err := update(&message); err != nil {
+		return err
+	}
+	s.messages[messageId] = message
+	if !wasDone && !message.DoneDate.IsZero() {
+		s.done = append(s.done, messageId)
+		s.evict(message.DoneDate)
+	}
+	return nil
+}
+
+// evict forgets the final messages over the limits, their age taken at the
+// reference time.
+func (s *InMemoryMessageStore) evict(reference time.Time) {
+	for len(s.done) > 0 {
+		oldest := s.messages[s.done[0]]
+		overCount := s.MaxFinalMessages > 0 && len(s.done) > s.MaxFinalMessages
+		tooOld := s.MaxAge > 0 && oldest.DoneDate.Add(s.MaxAge).Before(reference)
+		if !overCount && !tooOld {
+			return
+		}
+		delete(s.messages, s.done[0])
+		s.done = s.done[1:]
+	}
+}
+
+// List gives the messages ordered by submit date.
+func (s *InMemoryMessageStore) List() ([]StoredMessage, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	messages := make([]StoredMessage, 0, len(s.messages))
+	for _, message := range s.messages {
+		messages = append(messages, message)
+	}
+	sort.Slice(messages, func(i, j int) bool {
+		if messages[i].SubmitDate.Equal(messages[j].SubmitDate) {
+			return messages[i].MessageId < messages[j].MessageId
+		}
+		return messages[i].SubmitDate.Before(messages[j].SubmitDate)
+	})
+	return messages, nil
+}
@@ -0,0 +1,135 @@
+package smpp
+
+import (
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestMessageIdGenerators(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name      string
+		generator MessageIdGenerator
+		format    *regexp.Regexp
+		first     string
+	}{
+		{"counter", NewCounterMessageIdGenerator(), regexp.MustCompile(`^[0-9]+$`), "1"},
+		{"hex", NewHexMessageIdGenerator(), regexp.MustCompile(`^[0-9a-f]{10}$`), "0000000001"},
+		{"uuid", NewUUIDMessageIdGenerator(), regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`), ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			seen := map[string]bool{}
+			for i := 0; i < 1000; i++ {
+				id := tt.generator()
+				if i == 0 && tt.first != "" && id != tt.first {
+					t.Errorf("First message id = %v, want %v", id, tt.first)
+				}
+				if !tt.format.MatchString(id) {
+					t.Fatalf("Message id %q doesn't have the expected format", id)
+				}
+				if seen[id] {
+					t.Fatalf("Message id %q was given twice", id)
+				}
+				seen[id] = true
+			}
+		})
+	}
+}
+
+func TestInMemoryMessageStore(t *testing.T) {
+	t.Parallel()
+	store := NewInMemoryMessageStore()
+	now := time.Now()
+	first := StoredMessage{MessageId: "1", SystemId: validSystemID, State: "ENROUTE", SubmitDate: now}
+	second := StoredMessage{MessageId: "2", SystemId: validSystemID, State: "ENROUTE", SubmitDate: now.Add(time.Second)}
+
+	for _, message := range []StoredMessage{second, first} {
+		if err := store.Store(message); err != nil {
+			t.Fatalf("Store() error = %v", err)
+		}
+	}
+	if err := store.Store(first); err == nil {
+		t.Errorf("Storing the same message id twice should fail")
+	}
+
+	err := store.Update("1", func(m *StoredMessage) error {
+		m.State = "DELIVERED"
+		return nil
+	})
+	if err != nil {
+		t.Errorf("Update() error = %v", err)
+	}
+	failedUpdate := errors.New("refused")
+	if err := store.Update("2", func(m *StoredMessage) error { m.State = "DELETED"; return failedUpdate }); err != failedUpdate {
+		t.Errorf("Update() error = %v, want %v", err, failedUpdate)
+	}
+
+	message, err := store.Get("1")
+	if err != nil || message.State != "DELIVERED" {
+		t.Errorf("Get() = %+v, %v", message, err)
+	}
+	if message, _ := store.Get("2"); message.State != "ENROUTE" {
+		t.Errorf("A refused update shouldn't be applied : %+v", message)
+	}
+	if _, err := store.Get("3"); !errors.Is(err, ErrMessageNotFound) {
+		t.Errorf("Get() of an unknown message error = %v, want %v", err, ErrMessageNotFound)
+	}
+	if err := store.Update("3", func(m *StoredMessage) error { return nil }); !errors.Is(err, ErrMessageNotFound) {
+		t.Errorf("Update() of an unknown message error = %v, want %v", err, ErrMessageNotFound)
+	}
+
+	messages, err := store.List()
+	if err != nil || len(messages) != 2 || messages[0].MessageId != "1" || messages[1].MessageId != "2" {
+		t.Errorf("List() = %+v, %v", messages, err)
+	}
+}
+
+func TestInMemoryMessageStoreEvictsFinalMessages(t *testing.T) {
+	t.Parallel()
+	now := time.Now()
+	deliver := func(store *InMemoryMessageStore, messageId string, doneDate time.Time) {
+		t.Helper()
+		err := store.Update(messageId, func(m *StoredMessage) error {
+			m.State, m.DoneDate = "DELIVERED", doneDate
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("Update() error = %v", err)
+		}
+	}
+	stored := func(store *InMemoryMessageStore) (ids []string) {
+		messages, _ := store.List()
+		for _, message := range messages {
+			ids = append(ids, message.MessageId)
+		}
+		return ids
+	}
+
+	byCount := NewInMemoryMessageStore()
+	byCount.MaxFinalMessages = 1
+	for i, id := range []string{"1", "2", "3"} {
+		byCount.Store(StoredMessage{MessageId: id, State: "ENROUTE", SubmitDate: now.Add(time.Duration(i) * time.Second)})
+	}
+	deliver(byCount, "2", now)
+	deliver(byCount, "1", now)
+	if ids := stored(byCount); len(ids) != 2 || ids[0] != "1" || ids[1] != "3" {
+		t.Errorf("Kept %v, want the last message done and the one still ENROUTE", ids)
+	}
+
+	byAge := NewInMemoryMessageStore()
+	byAge.MaxAge = time.Hour
+	byAge.Store(StoredMessage{MessageId: "1", State: "ENROUTE", SubmitDate: now})
+	byAge.Store(StoredMessage{MessageId: "2", State: "ENROUTE", SubmitDate: now})
+	deliver(byAge, "1", now)
+	byAge.Store(StoredMessage{MessageId: "3", State: "ENROUTE", SubmitDate: now.Add(time.Hour)})
+	if ids := stored(byAge); len(ids) != 3 {
+		t.Errorf("Kept %v, messages done for an hour aren't too old yet", ids)
+	}
+	deliver(byAge, "2", now.Add(time.Hour+time.Second))
+	if ids := stored(byAge); len(ids) != 2 || ids[0] != "2" || ids[1] != "3" {
+		t.Errorf("Kept %v, want the message done over an hour ago evicted", ids)
+	}
+}
@@ -0,0 +1,140 @@
+package smpp
+
+import (
+	"expvar"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Metrics is told what goes through ESMEs and SMSCs.  The labels are plain
+// strings (command_id, command_status, bind type, system_id) so exporters
+// like Prometheus can map each call onto a counter, gauge or histogram.
+// Calls come from many goroutines at once.
+//
+// PduSent and PduReceived carry the command_status, giving the statuses of
+// the responses per command_id.  RequestLatency is the time from a request
+// to its response, for the requests of the ESME convenience functions, those
+// sent while its control loop runs and the deliver_sm sent by the SMSC.
+// WindowOccupancy changes by delta as those requests are sent and answered.
+// Reconnected is recorded by the SMSC when an account binds again after one
+// of its sessions ended.
+type Metrics interface {
+	PduSent(commandId string, status string)
+	PduReceived(commandId string, status string)
+	RequestLatency(commandId string, latency time.Duration)
+	WindowOccupancy(delta int)
+	Reconnected(systemId string)
+	BindFailed(bindType string, status string)
+}
+
+type noMetrics struct{}
+
+func (noMetrics) PduSent(string, string)               {}
+func (noMetrics) PduReceived(string, string)           {}
+func (noMetrics) RequestLatency(string, time.Duration) {}
+func (noMetrics) WindowOccupancy(int)                  {}
+func (noMetrics) Reconnected(string)                   {}
+func (noMetrics) BindFailed(string, string)            {}
+
+// LatencyBuckets are the upper bounds of the latency histograms of
+// ExpvarMetrics.
+var LatencyBuckets = []time.Duration{
+	time.Millisecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	5 * time.Second,
+}
+
+// ExpvarMetrics keeps the metrics in expvar variables.  It's an expvar.Var
+// itself, publish it to expose it on /debug/vars:
+//
+//	metrics := smpp.NewExpvarMetrics()
+//	expvar.Publish("smpp", metrics)
+//	smsc.Metrics = metrics
+//
+// PDUs are counted by command_id and command_status, latencies are
+// cumulative histograms by command_id like Prometheus ones.
+type ExpvarMetrics struct {
+	mu           sync.Mutex
+	root         *expvar.Map
+	pdusSent     *expvar.Map
+	pdusReceived *expvar.Map
+	latencies    *expvar.Map
+	window       *expvar.Int
+	reconnects   *expvar.Map
+	bindFailures *expvar.Map
+}
+
+func NewExpvarMetrics() *ExpvarMetrics {
+	m := &ExpvarMetrics{
+		root:         new(expvar.Map).Init(),
+		pdusSent:     new(expvar.Map).Init(),
+		pdusReceived: new(expvar.Map).Init(),
+		latencies:    new(expvar.Map).Init(),
+		window:       new(expvar.Int),
+		reconnects:   new(expvar.Map).Init(),
+		bindFailures: new(expvar.Map).Init(),
+	}
+	m.root.Set("pdus_sent", m.pdusSent)
+	m.root.Set("pdus_received", m.pdusReceived)
+	m.root.Set("request_latency", m.latencies)
+	m.root.Set("window_occupancy", m.window)
+	m.root.Set("reconnects", m.reconnects)
+	m.root.Set("bind_failures", m.bindFailures)
+	return m
+}
+
+func (m *ExpvarMetrics) String() string {
+	return m.root.String()
+}
+
+func (m *ExpvarMetrics) PduSent(commandId string, status string) {
+	m.child(m.pdusSent, commandId).Add(status, 1)
+}
+
+func (m *ExpvarMetrics) PduReceived(commandId string, status string) {
+	m.child(m.pdusReceived, commandId).Add(status, 1)
+}
+
+func (m *ExpvarMetrics) RequestLatency(commandId string, latency time.Duration) {
+	histogram := m.child(m.latencies, commandId)
+	histogram.Add("count", 1)
+	histogram.AddFloat("sum_seconds", latency.Seconds())
+	for _, bucket := range LatencyBuckets {
+		if latency <= bucket {
+			histogram.Add(fmt.Sprintf("le_%v", bucket.Seconds()), 1)
+		}
+	}
+}
+
+func (m *ExpvarMetrics) WindowOccupancy(delta int) {
+	m.window.Add(int64(delta))
+}
+
+func (m *ExpvarMetrics) Reconnected(systemId string) {
+	m.reconnects.Add(systemId, 1)
+}
+
+func (m *ExpvarMetrics) BindFailed(bindType string, status string) {
+	m.child(m.bindFailures, bindType).Add(status, 1)
+}
+
+// child gives the map kept under key, creating it on first use.
+func (m *ExpvarMetrics) child(parent *expvar.Map, key string) *expvar.Map {
+	if child, ok := parent.Get(key).(*expvar.Map); ok {
+		return child
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if child, ok := parent.Get(key).(*expvar.Map); ok {
+		return child
+	}
+	child := new(expvar.Map).Init()
+	parent.Set(key, child)
+	return child
+}
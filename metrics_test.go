@@ -0,0 +1,143 @@
+package smpp
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func expvarMetricsValues(t *testing.T, m *ExpvarMetrics) map[string]interface{} {
+	values := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(m.String()), &values); err != nil {
+		t.Fatalf("ExpvarMetrics isn't valid JSON : %v", err)
+	}
+	return values
+}
+
+func valueAt(values map[string]interface{}, keys ...string) interface{} {
+	var value interface{} = values
+	for _, key := range keys {
+		current, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		value = current[key]
+	}
+	return value
+}
+
+func TestExpvarMetricsKeepsCumulativeLatencyHistograms(t *testing.T) {
+	m := NewExpvarMetrics()
+	m.RequestLatency("submit_sm", 3*time.Millisecond)
+	m.RequestLatency("submit_sm", 2*time.Second)
+	m.WindowOccupancy(2)
+	m.WindowOccupancy(-1)
+
+	values := expvarMetricsValues(t, m)
+	tests := []struct {
+		keys []string
+		want float64
+	}{
+		{[]string{"request_latency", "submit_sm", "count"}, 2},
+		{[]string{"request_latency", "submit_sm", "sum_seconds"}, 2.003},
+		{[]string{"request_latency", "submit_sm", "le_0.005"}, 1},
+		{[]string{"request_latency", "submit_sm", "le_1"}, 1},
+		{[]string{"request_latency", "submit_sm", "le_5"}, 2},
+		{[]string{"window_occupancy"}, 1},
+	}
+	for _, tt := range tests {
+		if got := valueAt(values, tt.keys...); got != tt.want {
+			t.Errorf("%v = %v, want %v", tt.keys, got, tt.want)
+		}
+	}
+	if got := valueAt(values, "request_latency", "submit_sm", "le_0.001"); got != nil {
+		t.Errorf("Bucket le_0.001 = %v, want none", got)
+	}
+}
+
+func TestSmscRecordsItsMetrics(t *testing.T) {
+	smsc, err := GetSmscSimulatorServer()
+	if err != nil {
+		t.Fatalf("couldn't start server successfully: %v", err)
+	}
+	metrics := NewExpvarMetrics()
+	smsc.Metrics = metrics
+	smsc.Start()
+	Esme, err := InstantiateEsme(smsc.listeningSocket.Addr(), connType)
+	if err != nil {
+		t.Fatalf("couldn't connect client to server successfully: %v", err)
+	}
+	defer CloseAndAssertClean(smsc, Esme, t)
+
+	resp, _ := Esme.BindTransmitter(validSystemID, "wrong")
+	if _, err = Esme.BindTransmitter(validSystemID, validPassword); err != nil {
+		t.Fatalf("Couldn't bind with the SMSC : %v", err)
+	}
+	if _, err = Esme.sendAndWaitForResponse(NewSubmitSM().WithDestinationAddress("5551234").WithMessage("Hello")); err != nil {
+		t.Fatalf("Couldn't submit : %v", err)
+	}
+	if _, err = Esme.Unbind(); err != nil {
+		t.Fatalf("Couldn't unbind : %v", err)
+	}
+	if _, err = Esme.BindTransmitter(validSystemID, validPassword); err != nil {
+		t.Fatalf("Couldn't bind again with the SMSC : %v", err)
+	}
+
+	values := expvarMetricsValues(t, metrics)
+	tests := []struct {
+		keys []string
+		want float64
+	}{
+		{[]string{"bind_failures", "bind_transmitter", resp.Header.CommandStatus}, 1},
+		{[]string{"pdus_received", "bind_transmitter", ESME_ROK}, 3},
+		{[]string{"pdus_received", "submit_sm", ESME_ROK}, 1},
+		{[]string{"pdus_sent", "submit_sm_resp", ESME_ROK}, 1},
+		{[]string{"reconnects", validSystemID}, 1},
+	}
+	for _, tt := range tests {
+		if got := valueAt(values, tt.keys...); got != tt.want {
+			t.Errorf("%v = %v, want %v", tt.keys, got, tt.want)
+		}
+	}
+}
+
+func TestEsmeRecordsTheRequestsAnsweredThroughItsControlLoop(t *testing.T) {
+	smsc, _, Esme := connectEsmeAndSmscTogether(t)
+	defer CloseAndAssertClean(smsc, Esme, t)
+	metrics := NewExpvarMetrics()
+	Esme.SetMetrics(metrics)
+	if _, err := Esme.BindTransmitter(validSystemID, validPassword); err != nil {
+		t.Fatalf("Couldn't bind with the SMSC : %v", err)
+	}
+	responses := make(chan PDU, 1)
+	Esme.CommandFunctions["submit_sm_resp"] = func(e *ESME, pdu PDU) error {
+		responses <- pdu
+		return nil
+	}
+	Esme.StartControlLoop()
+
+	submitSm := NewSubmitSM().WithDestinationAddress("5551234").WithMessage("Hello")
+	if _, err := Esme.Send(&submitSm); err != nil {
+		t.Fatalf("Couldn't submit : %v", err)
+	}
+	select {
+	case <-responses:
+	case <-time.After(time.Second):
+		t.Fatalf("The control loop didn't get the submit_sm_resp")
+	}
+
+	values := expvarMetricsValues(t, metrics)
+	tests := []struct {
+		keys []string
+		want float64
+	}{
+		{[]string{"request_latency", "bind_transmitter", "count"}, 1},
+		{[]string{"request_latency", "submit_sm", "count"}, 1},
+		{[]string{"window_occupancy"}, 0},
+	}
+	for _, tt := range tests {
+		if got := valueAt(values, tt.keys...); got != tt.want {
+			t.Errorf("%v = %v, want %v", tt.keys, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package smpp
+
+import (
+	"fmt"
+	"net"
+	"time"
+)
+
+// Outbind dials an ESME listening for outbinds (see AcceptOutbind) and
+// sends it an outbind with the given credentials.  The ESME then binds as
+// receiver on that connection like on any other session of the SMSC.
+func (s *SMSC) Outbind(esmeAddress net.Addr, connType string, systemId string, password string) (*Session, error) {
+	connection, err := net.Dial(connType, esmeAddress.String())
+	if err != nil {
+		return nil, fmt.Errorf("Couldn't dial %v for an outbind : %w", esmeAddress, err)
+	}
+	session, err := s.openSession(connection, false)
+	if err != nil {
+		return nil, err
+	}
+	outbind := NewOutbind().WithSystemId(systemId).WithPassword(password)
+	if _, err = session.Send(&outbind); err != nil {
+		return session, fmt.Errorf("Couldn't send the outbind to %v : %w", esmeAddress, err)
+	}
+	return session, nil
+}
+
+// AcceptOutbind waits for an SMSC to connect on the listener and send an
+// outbind carrying smscSystemId and smscPassword, then binds as receiver
+// with systemId and password on that same connection.  Once connected, the
+// SMSC has the timeout to send its outbind, zero meaning no limit.
+// Connections not starting with the expected outbind are closed, the SMPP
+// protocol having no response to an outbind.
+func AcceptOutbind(listener net.Listener, timeout time.Duration, smscSystemId, smscPassword, systemId, password string) (*ESME, error) {
+	connection, err := listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	deadline := time.Time{}
+	if timeout > 0 {
+		deadline = time.Now().Add(timeout)
+	}
+	e := NewEsme(connection)
+	outbind, err := e.receivePduBefore(deadline)
+	if err != nil {
+		e.Close()
+		return nil, fmt.Errorf("Couldn't receive the outbind : %w", err)
+	}
+	if err = validateOutbind(outbind, smscSystemId, smscPassword); err != nil {
+		e.Close()
+		return nil, err
+	}
+	if _, err = e.BindReceiver(systemId, password); err != nil {
+		e.Close()
+		return nil, fmt.Errorf("Couldn't bind as receiver after the outbind : %w", err)
+	}
+	return e, nil
+}
+
+func validateOutbind(pdu PDU, systemId string, password string) error {
+	if pdu.Header.CommandId != "outbind" {
+		return fmt.Errorf("Expected an outbind, received %v", pdu.Header.CommandId)
+	}
+	if pdu.Body.MandatoryParameter["system_id"] != systemId || pdu.Body.MandatoryParameter["password"] != password {
+		return fmt.Errorf("Outbind refused, invalid credentials from %v", pdu.Body.MandatoryParameter["system_id"])
+	}
+	return nil
+}
@@ -1,6 +1,10 @@
 package smpp
 
-import "fmt"
+import (
+	"fmt"
+	"regexp"
+	"time"
+)
 
 func handleEnquiryLinkPduReceived(e *ESME, receivedPdu PDU) (formated_error error) {
 	ResponsePdu := NewEnquireLinkResp().WithSequenceNumber(receivedPdu.Header.SequenceNumber)
@@ -8,40 +12,301 @@ func handleEnquiryLinkPduReceived(e *ESME, receivedPdu PDU) (formated_error erro
 	return formated_error
 }
 
-func handleSubmitSmPduReceived(e *ESME, receivedPdu PDU) (formated_error error) {
-	if e.isTransmitterState() {
-		formated_error = replyToSubmitSM(e, receivedPdu)
+func (s *SMSC) handleBindOperation(session *Session, receivedPdu PDU) error {
+	ResponsePdu := receivedPdu.WithCommandId(receivedPdu.Header.CommandId + "_resp")
+	request := newBindRequest(session, receivedPdu)
+	status, addressRange := s.authorizeBind(session, request, receivedPdu)
+	if status != ESME_ROK {
+		ResponsePdu.Header.CommandStatus = status
+		session.metrics.BindFailed(receivedPdu.Header.CommandId, status)
+		withPdu(session.log(), receivedPdu).Info("Bind refused", "bind_system_id", receivedPdu.Body.MandatoryParameter["system_id"], "status", status)
 	} else {
-		ResponsePdu := NewSubmitSMResp().WithSequenceNumber(receivedPdu.Header.SequenceNumber)
-		ResponsePdu = ResponsePdu.WithMessageId("").WithSMPPError(ESME_RINVBNDSTS)
-		_, formated_error = e.Send(&ResponsePdu)
+		s.bindMu.Lock()
+		s.releaseBind(request)
+		_ = setESMEStateFromSMSCResponse(&ResponsePdu, session.ESME)
+		session.bind(request.SystemId, request.BindType, addressRange, s.Clock.Now())
+		reconnected := s.isReconnection(request.SystemId)
+		s.bindMu.Unlock()
+		if reconnected {
+			session.metrics.Reconnected(request.SystemId)
+		}
 	}
-	return formated_error
+	err := session.sendPdu(ResponsePdu)
+	if err != nil {
+		return fmt.Errorf("Couldn't write to the ESME from SMSC : %v", err)
+	}
+	if session.isReceiverState() {
+		s.dispatchAwaitingMessages()
+	}
+	return nil
 }
 
-func replyToSubmitSM(e *ESME, receivedPdu PDU) (err error) {
-	submit_sm_resp_bytes := NewSubmitSMResp().WithMessageId("1").WithSequenceNumber(1)
-	_, err = e.Send(&submit_sm_resp_bytes)
-	return err
+// authorizeBind runs the checks and hooks of the bind without holding
+// bindMu.  An authorized bind holds a place within the limit of its account
+// until handleBindOperation releases it, once the session is bound.
+func (s *SMSC) authorizeBind(session *Session, request BindRequest, bindPdu PDU) (string, *regexp.Regexp) {
+	if s.shuttingDown.Load() {
+		withPdu(session.log(), bindPdu).Info("Bind refused, the SMSC is shutting down")
+		return ESME_RBINDFAIL, nil
+	}
+	if state := session.GetEsmeState(); state != OPEN {
+		withPdu(session.log(), bindPdu).Info("Bind received on a session already bound", "state", state)
+		return ESME_RALYBND, nil
+	}
+	if status := s.Authenticator.Authenticate(request); status != ESME_ROK {
+		return status, nil
+	}
+	addressRange, err := compileAddressRange(bindPdu)
+	if err != nil {
+		withPdu(session.log(), bindPdu).Info("Invalid address_range", "error", err)
+		return ESME_RBINDFAIL, nil
+	}
+	if !s.reserveBind(session, request, bindPdu) {
+		return ESME_RBINDFAIL, nil
+	}
+	if s.OnBind != nil {
+		if err = s.OnBind(session, bindPdu); err != nil {
+			s.bindMu.Lock()
+			s.releaseBind(request)
+			s.bindMu.Unlock()
+			withPdu(session.log(), bindPdu).Info("Bind refused by OnBind", "bind_system_id", request.SystemId, "error", err)
+			return statusFromError(err, ESME_RBINDFAIL), nil
+		}
+	}
+	return ESME_ROK, addressRange
 }
 
-func (s *SMSC) handleBindOperation(e *ESME, receivedPdu PDU) error {
-	ResponsePdu := receivedPdu.WithCommandId(receivedPdu.Header.CommandId + "_resp")
-	if !receivedPdu.isSystemId(s.SystemId) || !receivedPdu.isPassword(s.Password) {
-		ResponsePdu.Header.CommandStatus = ESME_RBINDFAIL
-		InfoSmppLogger.Printf("We didn't received expected credentials")
+// reserveBind checks the limit of concurrent sessions of the account given
+// by a BindLimiter, counting the binds still being authorized.
+func (s *SMSC) reserveBind(session *Session, request BindRequest, bindPdu PDU) bool {
+	s.bindMu.Lock()
+	defer s.bindMu.Unlock()
+	if limiter, ok := s.Authenticator.(BindLimiter); ok {
+		limit, limited := limiter.MaxBinds(request.SystemId, request.BindType)
+		if limited && s.countBinds(request.SystemId, request.BindType) >= limit {
+			withPdu(session.log(), bindPdu).Info("Bind refused, the limit of concurrent sessions is reached", "bind_system_id", request.SystemId, "limit", limit)
+			return false
+		}
 	}
-	bindResponse, err := EncodePdu(ResponsePdu)
-	if err != nil {
-		return fmt.Errorf("Encoding bind response failed : %v", err)
+	s.bindsInProgress[[2]string{request.SystemId, request.BindType}]++
+	return true
+}
+
+// releaseBind gives back the place held by reserveBind, it must be called
+// under bindMu.
+func (s *SMSC) releaseBind(request BindRequest) {
+	key := [2]string{request.SystemId, request.BindType}
+	if s.bindsInProgress[key]--; s.bindsInProgress[key] <= 0 {
+		delete(s.bindsInProgress, key)
+	}
+}
+
+var bindTypeOfState = map[string]string{
+	BOUND_TX:  "bind_transmitter",
+	BOUND_RX:  "bind_receiver",
+	BOUND_TRX: "bind_transceiver",
+}
+
+// countBinds counts the sessions bound or binding as the account, it must be
+// called under bindMu.
+func (s *SMSC) countBinds(systemId string, bindType string) (count int) {
+	count = s.bindsInProgress[[2]string{systemId, bindType}]
+	for _, session := range s.Sessions() {
+		if session.SystemId() == systemId && bindTypeOfState[session.GetEsmeState()] == bindType {
+			count++
+		}
+	}
+	return count
+}
+
+// compileAddressRange gives the regular expression of the addresses served
+// by the ESME, nil when the bind has no address_range.
+func compileAddressRange(bindPdu PDU) (*regexp.Regexp, error) {
+	addressRange, _ := bindPdu.Body.MandatoryParameter["address_range"].(string)
+	if addressRange == "" {
+		return nil, nil
+	}
+	return regexp.Compile(addressRange)
+}
+
+func newBindRequest(session *Session, receivedPdu PDU) BindRequest {
+	systemId, _ := receivedPdu.Body.MandatoryParameter["system_id"].(string)
+	password, _ := receivedPdu.Body.MandatoryParameter["password"].(string)
+	systemType, _ := receivedPdu.Body.MandatoryParameter["system_type"].(string)
+	return BindRequest{
+		SystemId:   systemId,
+		Password:   password,
+		SystemType: systemType,
+		BindType:   receivedPdu.Header.CommandId,
+		RemoteAddr: session.RemoteAddr(),
+	}
+}
+
+func (s *SMSC) handleSubmitSmOperation(session *Session, receivedPdu PDU) error {
+	if !session.isTransmitterState() {
+		return rejectMessage(session, receivedPdu, ESME_RINVBNDSTS, fmt.Errorf("session is %v", session.GetEsmeState()))
+	}
+	return s.submitMessage(session, receivedPdu, s.OnSubmit, ESME_RSUBMITFAIL)
+}
+
+func (s *SMSC) handleDataSmOperation(session *Session, receivedPdu PDU) error {
+	if !session.isTransmitterState() {
+		return rejectMessage(session, receivedPdu, ESME_RINVBNDSTS, fmt.Errorf("session is %v", session.GetEsmeState()))
+	}
+	return s.submitMessage(session, receivedPdu, s.OnDataSM, ESME_RDELIVERYFAILURE)
+}
+
+// submitMessage accepts a submit_sm or a data_sm in the MessageStore and
+// schedules its delivery, unless its times or the hook refuse it.
+func (s *SMSC) submitMessage(session *Session, receivedPdu PDU, hook func(*Session, PDU) error, refusedStatus string) error {
+	err := validateMessageTimes(receivedPdu, s.Clock.Now())
+	if err == nil && s.shuttingDown.Load() {
+		err = errShuttingDown
+	}
+	if err == nil && hook != nil {
+		err = hook(session, receivedPdu)
 	}
-	err = setESMEStateFromSMSCResponse(&ResponsePdu, e)
 	if err != nil {
-		InfoSmppLogger.Printf("Couldn't set the bind state on request!")
+		return rejectMessage(session, receivedPdu, statusFromError(err, refusedStatus), err)
 	}
-	_, err = (e.clientSocket).Write(bindResponse)
+	message, err := s.acceptMessage(session, receivedPdu)
 	if err != nil {
-		return fmt.Errorf("Couldn't write to the ESME from SMSC : %v", err)
+		return rejectMessage(session, receivedPdu, statusFromError(err, ESME_RSYSERR), err)
+	}
+	session.messagesSubmitted.Add(1)
+	ResponsePdu := messageResponse(receivedPdu).WithMessageId(message.MessageId)
+	if _, err = session.Send(&ResponsePdu); err != nil {
+		return err
+	}
+	s.scheduleMessage(message)
+	return nil
+}
+
+func rejectMessage(session *Session, receivedPdu PDU, status string, reason error) error {
+	withPdu(session.log(), receivedPdu).Info("Rejecting message", "status", status, "error", reason)
+	ResponsePdu := messageResponse(receivedPdu).
+		WithMessageId("").
+		WithSMPPError(status)
+	_, err := session.Send(&ResponsePdu)
+	return err
+}
+
+// messageResponse gives the submit_sm_resp or data_sm_resp to the PDU.
+func messageResponse(receivedPdu PDU) PDU {
+	ResponsePdu := NewSubmitSMResp()
+	if receivedPdu.Header.CommandId == "data_sm" {
+		ResponsePdu = NewDataSMResp()
+	}
+	return ResponsePdu.WithSequenceNumber(receivedPdu.Header.SequenceNumber)
+}
+
+func (s *SMSC) handleDeliverSmRespOperation(session *Session, receivedPdu PDU) error {
+	pending, ok := s.pendingDeliveries.LoadAndDelete(deliveryKey{session, receivedPdu.Header.SequenceNumber})
+	if !ok {
+		return nil // ie. the response to a delivery receipt
+	}
+	delivery := pending.(pendingDelivery)
+	session.metrics.WindowOccupancy(-1)
+	session.metrics.RequestLatency("deliver_sm", time.Since(delivery.sentAt))
+	finalState := "DELIVERED"
+	if receivedPdu.Header.CommandStatus != ESME_ROK {
+		finalState = "UNDELIVERABLE"
+	} else {
+		session.messagesDelivered.Add(1)
+	}
+	s.finalizeMessage(delivery.messageId, finalState)
+	return nil
+}
+
+func (s *SMSC) handleQuerySmOperation(session *Session, receivedPdu PDU) error {
+	messageId, _ := receivedPdu.Body.MandatoryParameter["message_id"].(string)
+	ResponsePdu := NewQuerySMResp().
+		WithSequenceNumber(receivedPdu.Header.SequenceNumber).
+		WithMessageId(messageId)
+	message, err := s.findOwnedMessage(session, receivedPdu)
+	switch {
+	case !session.isTransmitterState():
+		ResponsePdu = ResponsePdu.WithSMPPError(ESME_RINVBNDSTS)
+	case err != nil:
+		withPdu(session.log(), receivedPdu).Info("Couldn't answer query_sm", "error", err)
+		ResponsePdu = ResponsePdu.WithSMPPError(statusFromError(err, ESME_RQUERYFAIL))
+	case !IsMessageState(message.State):
+		withPdu(session.log(), receivedPdu).Warn("Couldn't answer query_sm, the message is in an unknown state", "state", message.State)
+		ResponsePdu = ResponsePdu.WithSMPPError(ESME_RSYSERR)
+	default:
+		ResponsePdu = ResponsePdu.
+			WithFinalDate(message.DoneDate).
+			WithMessageState(message.State).
+			WithErrorCode(message.ErrorCode)
+	}
+	_, err = session.Send(&ResponsePdu)
+	return err
+}
+
+func (s *SMSC) handleCancelSmOperation(session *Session, receivedPdu PDU) error {
+	ResponsePdu := NewCancelSMResp().WithSequenceNumber(receivedPdu.Header.SequenceNumber)
+	if !session.isTransmitterState() {
+		ResponsePdu = ResponsePdu.WithSMPPError(ESME_RINVBNDSTS)
+	} else if err := s.cancelMessages(session, receivedPdu); err != nil {
+		withPdu(session.log(), receivedPdu).Info("Couldn't cancel", "error", err)
+		ResponsePdu = ResponsePdu.WithSMPPError(statusFromError(err, ESME_RCANCELFAIL))
+	}
+	_, err := session.Send(&ResponsePdu)
+	return err
+}
+
+func (s *SMSC) handleReplaceSmOperation(session *Session, receivedPdu PDU) error {
+	ResponsePdu := NewReplaceSMResp().WithSequenceNumber(receivedPdu.Header.SequenceNumber)
+	if !session.isTransmitterState() {
+		ResponsePdu = ResponsePdu.WithSMPPError(ESME_RINVBNDSTS)
+	} else if err := s.replaceMessage(session, receivedPdu); err != nil {
+		withPdu(session.log(), receivedPdu).Info("Couldn't replace", "error", err)
+		ResponsePdu = ResponsePdu.WithSMPPError(statusFromError(err, ESME_RREPLACEFAIL))
+	}
+	_, err := session.Send(&ResponsePdu)
+	return err
+}
+
+func (s *SMSC) handleUnbindOperation(session *Session, receivedPdu PDU) error {
+	bound := session.GetEsmeState() != OPEN
+	err := handleUnbindPduReceived(session.ESME, receivedPdu)
+	if bound {
+		s.unbindSession(session)
+	}
+	return err
+}
+
+func (s *SMSC) handleUnbindRespOperation(session *Session, receivedPdu PDU) error {
+	bound := session.GetEsmeState() != OPEN
+	err := handleUnbindRespPduReceived(session.ESME, receivedPdu)
+	if bound && session.GetEsmeState() == OPEN {
+		s.unbindSession(session)
+	}
+	return err
+}
+
+func (s *SMSC) unbindSession(session *Session) {
+	systemId := session.SystemId()
+	session.unbind()
+	s.sessionEnded(systemId)
+	if s.OnUnbind != nil {
+		s.OnUnbind(session)
+	}
+}
+
+func handleUnbindPduReceived(e *ESME, receivedPdu PDU) (formated_error error) {
+	if e.GetEsmeState() == OPEN {
+		return nil // answered as a non binded operation
+	}
+	ResponsePdu := NewUnbindResp().WithSequenceNumber(receivedPdu.Header.SequenceNumber)
+	_, formated_error = e.Send(&ResponsePdu)
+	e.state.SetState(OPEN)
+	return formated_error
+}
+
+func handleUnbindRespPduReceived(e *ESME, receivedPdu PDU) error {
+	if receivedPdu.Header.CommandStatus == ESME_ROK {
+		e.state.SetState(OPEN)
 	}
 	return nil
 }
@@ -56,10 +321,7 @@ func handleDeliverSmPduReceived(e *ESME, receivedPdu PDU) (formated_error error)
 }
 
 func handleNonBindedOperations(e *ESME, receivedPdu PDU) (formated_error error) {
-	ResponsePdu := receivedPdu.
-		WithCommandId(receivedPdu.Header.CommandId + "_resp").
-		WithMessageId("").
-		WithSMPPError(ESME_RINVBNDSTS)
+	ResponsePdu := responseTo(receivedPdu).WithSMPPError(ESME_RINVBNDSTS)
 	_, formated_error = e.Send(&ResponsePdu)
 	return formated_error
 }
@@ -5,9 +5,11 @@ import (
 	"bytes"
 	"encoding/binary"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"log"
+	"strings"
 )
 type Error string
 func (e Error) Error() string {
@@ -16,6 +18,31 @@ func (e Error) Error() string {
 
 const missingHeaderError = Error("PDU object malformed, missing headers")
 
+// StatusError is an error mapping to an SMPP command_status, so the side
+// receiving the faulty PDU can answer with the right status.
+type StatusError struct {
+	Status string
+	Err    error
+}
+
+func (e StatusError) Error() string {
+	return fmt.Sprintf("%v : %v", e.Status, e.Err)
+}
+
+func (e StatusError) Unwrap() error {
+	return e.Err
+}
+
+// statusFromError gives the command_status to answer with for an error,
+// falling back on the provided status when the error has none.
+func statusFromError(err error, fallback string) string {
+	var statusError StatusError
+	if errors.As(err, &statusError) {
+		return statusError.Status
+	}
+	return fallback
+}
+
 // Expose Data Structure to enable people to manipulate it.
 // We don't care if they don't respect SMPP protocols :)
 // We use what we can (at least, try to)
@@ -52,10 +79,15 @@ func incrementBasedOnTlv(param map[string]interface{}) int {
 }
 
 func extractSpecificOptionalParameter(parameterBytes []byte) (nbOfBytes map[string]interface{}, err error) {
-	identityTag := optionalParameterTagByHex[hex.EncodeToString(parameterBytes[0:2])]
+	identityTag, known := optionalParameterTagByHex[hex.EncodeToString(parameterBytes[0:2])]
 	tag := identityTag["name"]
 	length := int(binary.BigEndian.Uint16(parameterBytes[2:4]))
 	var value interface{}
+	if !known {
+		// Unknown TLVs are kept as is so they can be encoded back.
+		tag = "0x" + hex.EncodeToString(parameterBytes[0:2])
+		value = bytes.Clone(parameterBytes[4 : length+4])
+	}
 	if identityTag["type"] == "string" {
 		lastBytePosition := length + 4
 		lastByteIsNulByte := byte(0) == parameterBytes[lastBytePosition-1]
@@ -66,7 +98,18 @@ func extractSpecificOptionalParameter(parameterBytes []byte) (nbOfBytes map[stri
 		}
 	}
 	if identityTag["type"] == "integer" {
-		value = int(parameterBytes[4])
+		integerValue := 0
+		for _, b := range parameterBytes[4 : length+4] {
+			integerValue = integerValue<<8 | int(b)
+		}
+		value = integerValue
+	}
+	if identityTag["type"] == "hex" {
+		if length == 1 {
+			value = int(parameterBytes[4])
+		} else {
+			value = bytes.Clone(parameterBytes[4 : length+4])
+		}
 	}
 	return map[string]interface{}{
 		"tag":    tag,
@@ -109,6 +152,9 @@ func encodeBody(obj PDU) (bodyBytes []byte, err error) {
 	var optionalParamsBytes []byte
 
 	mandatoryParamsBytes, err = encodeMandatoryParameters(obj)
+	if err != nil {
+		return nil, err
+	}
 	bodyBytes = append(bodyBytes, mandatoryParamsBytes...)
 
 	if len(obj.Body.OptionalParameters) > 0 {
@@ -123,36 +169,81 @@ func encodeBody(obj PDU) (bodyBytes []byte, err error) {
 
 func encodeOptionalParameters(obj PDU) (optionalParamsBytes []byte, err error) {
 	for _, optionalParam := range obj.Body.OptionalParameters {
-		specificOptionalParamsBytes, _ := encodeSpecificOptionalParameter(optionalParam)
+		specificOptionalParamsBytes, err := encodeSpecificOptionalParameter(optionalParam)
+		if err != nil {
+			return nil, err
+		}
 		optionalParamsBytes = append(optionalParamsBytes, specificOptionalParamsBytes...)
 
 	}
 	return optionalParamsBytes, err
 }
 
+// The "length" of a TLV, when given, is kept for integers spanning more than
+// a byte and strings sent without their terminating NUL.
 func encodeSpecificOptionalParameter(optionalParam map[string]interface{}) (optionalParamsBytes []byte, err error) {
-	parameterDefinitions := optionalParameterTagByName[optionalParam["tag"].(string)]
+	tagName, _ := optionalParam["tag"].(string)
+	parameterDefinitions, ok := optionalParameterDefinition(tagName)
+	if !ok {
+		return nil, fmt.Errorf("unknown optional parameter %v, can't encode", optionalParam["tag"])
+	}
 	var tag []byte
 	tag, err = hex.DecodeString(parameterDefinitions["hex"].(string))
+	length, _ := optionalParam["length"].(int)
 	lengthBuffer := make([]byte, 2)
+	if rawBytes, ok := optionalParam["value"].([]byte); ok && parameterDefinitions["type"] == "hex" {
+		binary.BigEndian.PutUint16(lengthBuffer, uint16(len(rawBytes)))
+		optionalParamsBytes = append(optionalParamsBytes, tag...)
+		optionalParamsBytes = append(optionalParamsBytes, lengthBuffer...)
+		optionalParamsBytes = append(optionalParamsBytes, rawBytes...)
+		return optionalParamsBytes, err
+	}
 	if parameterDefinitions["type"] == "integer" || parameterDefinitions["type"] == "hex" {
-		integerByte := byte(int64(optionalParam["value"].(int)))
-		binary.BigEndian.PutUint16(lengthBuffer, uint16(1))
+		integerValue, ok := optionalParam["value"].(int)
+		if !ok {
+			return nil, fmt.Errorf("%v optional parameter isn't an integer, can't encode", tagName)
+		}
+		if length < 1 {
+			length = 1
+		}
+		binary.BigEndian.PutUint16(lengthBuffer, uint16(length))
 		optionalParamsBytes = append(optionalParamsBytes, tag...)
 		optionalParamsBytes = append(optionalParamsBytes, lengthBuffer...)
-		optionalParamsBytes = append(optionalParamsBytes, integerByte)
+		optionalParamsBytes = append(optionalParamsBytes, encodeInteger(integerValue, length)...)
 
 	}
 	if parameterDefinitions["type"] == "string" {
-		fieldBytes := []byte(optionalParam["value"].(string))
-		binary.BigEndian.PutUint16(lengthBuffer, uint16(len(fieldBytes)+1))
+		stringValue, ok := optionalParam["value"].(string)
+		if !ok {
+			return nil, fmt.Errorf("%v optional parameter isn't a string, can't encode", tagName)
+		}
+		fieldBytes := []byte(stringValue)
+		if length != len(fieldBytes) {
+			fieldBytes = append(fieldBytes, 0)
+		}
+		binary.BigEndian.PutUint16(lengthBuffer, uint16(len(fieldBytes)))
 		optionalParamsBytes = append(optionalParamsBytes, tag...)
 		optionalParamsBytes = append(optionalParamsBytes, lengthBuffer...)
-		optionalParamsBytes = append(optionalParamsBytes, append(fieldBytes, 0)...)
+		optionalParamsBytes = append(optionalParamsBytes, fieldBytes...)
 	}
 	return optionalParamsBytes, err
 }
 
+// optionalParameterDefinition finds a TLV by name, or by its tag in hex
+// (ie. "0x1400") for the ones this package doesn't know.
+func optionalParameterDefinition(tag string) (map[string]interface{}, bool) {
+	if definition, ok := optionalParameterTagByName[tag]; ok {
+		return definition, true
+	}
+	if tagBytes, err := hex.DecodeString(strings.TrimPrefix(tag, "0x")); err == nil && strings.HasPrefix(tag, "0x") && len(tagBytes) == 2 {
+		if definition, ok := optionalParameterTagByHex[tag[2:]]; ok {
+			return definition, true
+		}
+		return map[string]interface{}{"hex": tag[2:], "name": tag, "type": "hex"}, true
+	}
+	return nil, false
+}
+
 func encodeMandatoryParameters(obj PDU) (bodyBytes []byte, err error) {
 	for _, mandatoryParam := range mandatoryParameterLists[obj.Header.CommandId] {
 		value, ok := obj.Body.MandatoryParameter[mandatoryParam["name"].(string)]
@@ -163,9 +254,15 @@ func encodeMandatoryParameters(obj PDU) (bodyBytes []byte, err error) {
 			}
 
 			if mandatoryParam["type"].(string) == "integer" || mandatoryParam["type"].(string) == "hex" {
-				integerBuffer := make([]byte, mandatoryParam["max"].(int))
-				binary.PutUvarint(integerBuffer, uint64(obj.Body.MandatoryParameter[mandatoryParam["name"].(string)].(int)))
-				bodyBytes = append(bodyBytes, integerBuffer...)
+				integerValue := value.(int)
+				if length, ok := lengthOfVariableField(obj, mandatoryParam["name"].(string)); ok {
+					integerValue = length
+				}
+				bodyBytes = append(bodyBytes, encodeInteger(integerValue, mandatoryParam["max"].(int))...)
+			}
+
+			if mandatoryParam["type"].(string) == "xstring" {
+				bodyBytes = append(bodyBytes, []byte(value.(string))...)
 			}
 		} else {
 			err = fmt.Errorf("%v of %v pdu missing, can't encode", mandatoryParam["name"].(string), obj.Header.CommandId)
@@ -174,3 +271,24 @@ func encodeMandatoryParameters(obj PDU) (bodyBytes []byte, err error) {
 	}
 	return
 }
+
+func encodeInteger(value int, size int) []byte {
+	integerBuffer := make([]byte, size)
+	for i := size - 1; i >= 0; i-- {
+		integerBuffer[i] = byte(value)
+		value >>= 8
+	}
+	return integerBuffer
+}
+
+// Length fields (ie. sm_length) are always computed from the field they
+// describe so they can't go out of sync with it.
+func lengthOfVariableField(obj PDU, lengthFieldName string) (int, bool) {
+	for _, mandatoryParam := range mandatoryParameterLists[obj.Header.CommandId] {
+		if mandatoryParam["type"] == "xstring" && mandatoryParam["var"] == lengthFieldName {
+			value, _ := obj.Body.MandatoryParameter[mandatoryParam["name"].(string)].(string)
+			return len(value), true
+		}
+	}
+	return 0, false
+}
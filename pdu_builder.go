@@ -1,5 +1,13 @@
 package smpp
 
+import (
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
 func defaultHeader() Header {
 	return Header{
 		CommandLength:  0,
@@ -78,6 +86,36 @@ func NewBindReceiverResp() PDU {
 	return PDU{Header: header, Body: body}
 }
 
+func NewUnbind() PDU {
+	header := defaultHeader()
+	header.CommandId = "unbind"
+	body := Body{
+		MandatoryParameter: map[string]interface{}{},
+	}
+	return PDU{Header: header, Body: body}
+}
+
+func NewUnbindResp() PDU {
+	header := defaultHeader()
+	header.CommandId = "unbind_resp"
+	body := Body{
+		MandatoryParameter: map[string]interface{}{},
+	}
+	return PDU{Header: header, Body: body}
+}
+
+func NewOutbind() PDU {
+	header := defaultHeader()
+	header.CommandId = "outbind"
+	body := Body{
+		MandatoryParameter: map[string]interface{}{
+			"system_id": "",
+			"password":  "",
+		},
+	}
+	return PDU{Header: header, Body: body}
+}
+
 func NewSubmitSM() PDU {
 	header := defaultHeader()
 	header.CommandId = "submit_sm"
@@ -117,6 +155,119 @@ func NewDataSM() PDU {
 	return PDU{Header: header, Body: body}
 }
 
+func NewDataSMResp() PDU {
+	header := defaultHeader()
+	header.CommandId = "data_sm_resp"
+	body := Body{
+		MandatoryParameter: map[string]interface{}{},
+	}
+	return PDU{Header: header, Body: body}
+}
+
+// responseTo gives the response to the request with an empty body, or a
+// generic_nack when the request has no response.
+func responseTo(request PDU) PDU {
+	header := request.Header
+	header.CommandId = request.Header.CommandId + "_resp"
+	if _, ok := commandIdByName[header.CommandId]; !ok {
+		header.CommandId = "generic_nack"
+	}
+	body := Body{MandatoryParameter: map[string]interface{}{}}
+	for _, field := range mandatoryParameterLists[header.CommandId] {
+		switch field["type"] {
+		case "string", "xstring":
+			body.MandatoryParameter[field["name"].(string)] = ""
+		case "integer":
+			body.MandatoryParameter[field["name"].(string)] = 0
+		}
+	}
+	return PDU{Header: header, Body: body}
+}
+
+func NewQuerySM() PDU {
+	header := defaultHeader()
+	header.CommandId = "query_sm"
+	body := Body{
+		MandatoryParameter: map[string]interface{}{
+			"message_id":      "",
+			"source_addr_ton": 0,
+			"source_addr_npi": 0,
+			"source_addr":     "",
+		},
+	}
+	return PDU{Header: header, Body: body}
+}
+
+func NewQuerySMResp() PDU {
+	header := defaultHeader()
+	header.CommandId = "query_sm_resp"
+	body := Body{
+		MandatoryParameter: map[string]interface{}{
+			"message_id":    "",
+			"final_date":    "",
+			"message_state": 0,
+			"error_code":    0,
+		},
+	}
+	return PDU{Header: header, Body: body}
+}
+
+func NewCancelSM() PDU {
+	header := defaultHeader()
+	header.CommandId = "cancel_sm"
+	body := Body{
+		MandatoryParameter: map[string]interface{}{
+			"service_type":     "",
+			"message_id":       "",
+			"source_addr_ton":  0,
+			"source_addr_npi":  0,
+			"source_addr":      "",
+			"dest_addr_ton":    0,
+			"dest_addr_npi":    0,
+			"destination_addr": "",
+		},
+	}
+	return PDU{Header: header, Body: body}
+}
+
+func NewCancelSMResp() PDU {
+	header := defaultHeader()
+	header.CommandId = "cancel_sm_resp"
+	body := Body{
+		MandatoryParameter: map[string]interface{}{},
+	}
+	return PDU{Header: header, Body: body}
+}
+
+func NewReplaceSM() PDU {
+	header := defaultHeader()
+	header.CommandId = "replace_sm"
+	body := Body{
+		MandatoryParameter: map[string]interface{}{
+			"message_id":             "",
+			"source_addr_ton":        0,
+			"source_addr_npi":        0,
+			"source_addr":            "",
+			"schedule_delivery_time": "",
+			"validity_period":        "",
+			"registered_delivery":    0,
+			"sm_default_msg_id":      0,
+			"sm_length":              0,
+			"short_message":          "",
+		},
+	}
+	return PDU{Header: header, Body: body}
+}
+
+func NewReplaceSMResp() PDU {
+	header := defaultHeader()
+	header.CommandId = "replace_sm_resp"
+	body := Body{
+		MandatoryParameter: map[string]interface{}{},
+	}
+	return PDU{Header: header, Body: body}
+}
+
 func defaultBindBody() Body {
 	body := Body{
 		MandatoryParameter: map[string]interface{}{
@@ -249,6 +400,38 @@ func (p PDU) WithMessageId(id string) PDU {
 	return p
 }
 
+// WithFinalDate sets the final_date of a query_sm_resp, a zero time meaning
+// the message didn't reach a final state yet.
+func (p PDU) WithFinalDate(t time.Time) PDU {
+	p.Body.MandatoryParameter["final_date"] = ""
+	if !t.IsZero() {
+		p.Body.MandatoryParameter["final_date"] = FormatAbsoluteTime(t)
+	}
+	return p
+}
+
+// WithMessageState takes a name of message_state_by_name (ie. "DELIVERED"),
+// an unknown name makes the response an ESME_RSYSERR.
+func (p PDU) WithMessageState(state string) PDU {
+	value, ok := fieldMappingMap["message_state_by_name"][state].(int)
+	if !ok {
+		return p.WithSMPPError(ESME_RSYSERR)
+	}
+	p.Body.MandatoryParameter["message_state"] = value
+	return p
+}
+
+// IsMessageState tells whether the name is one of message_state_by_name.
+func IsMessageState(state string) bool {
+	_, ok := fieldMappingMap["message_state_by_name"][state]
+	return ok
+}
+
+func (p PDU) WithErrorCode(code int) PDU {
+	p.Body.MandatoryParameter["error_code"] = code
+	return p
+}
+
 func (p PDU) WithSMPPError(id string) PDU {
 	p.Header.CommandStatus = id
 	return p
@@ -264,12 +447,51 @@ func (p PDU) WithSequenceNumber(id int) PDU {
 	return p
 }
 
-func (p PDU) isSystemId(id string) bool {
-	return p.Body.MandatoryParameter["system_id"] == id
+func (p PDU) WithOptionalParameter(tlv map[string]interface{}) PDU {
+	p.Body.OptionalParameters = append(p.Body.OptionalParameters, tlv)
+	return p
+}
+
+// NewOptionalParameter builds a TLV out of its text form, as found on
+// command lines : a number for integers and hexadecimal octets for octet
+// strings.  Tags are given by name, or by their tag in hex (ie. "0x1400")
+// for the ones this package doesn't know.
+func NewOptionalParameter(tag string, text string) (map[string]interface{}, error) {
+	definition, ok := optionalParameterDefinition(tag)
+	if !ok {
+		return nil, fmt.Errorf("Unknown optional parameter %v", tag)
+	}
+	switch definition["type"] {
+	case "integer":
+		value, err := strconv.Atoi(text)
+		if err != nil {
+			return nil, fmt.Errorf("%v must be an integer : %v", tag, err)
+		}
+		length, _ := optionalParameterTagByHex[definition["hex"].(string)]["min"].(int)
+		if length < 1 {
+			length = 1
+		}
+		if value < 0 || value >= 1<<(8*length) {
+			return nil, fmt.Errorf("%v doesn't fit the %v octets of %v", value, length, tag)
+		}
+		return map[string]interface{}{"tag": tag, "length": length, "value": value}, nil
+	case "string":
+		return map[string]interface{}{"tag": tag, "length": len(text) + 1, "value": text}, nil
+	}
+	value, err := hex.DecodeString(strings.TrimPrefix(text, "0x"))
+	if err != nil {
+		return nil, fmt.Errorf("%v must be hexadecimal octets : %v", tag, err)
+	}
+	return map[string]interface{}{"tag": tag, "length": len(value), "value": value}, nil
 }
 
-func (p PDU) isPassword(password string) bool {
-	return p.Body.MandatoryParameter["password"] == password
+func (p PDU) getOptionalParameter(tag string) (interface{}, bool) {
+	for _, optionalParam := range p.Body.OptionalParameters {
+		if optionalParam["tag"] == tag {
+			return optionalParam["value"], true
+		}
+	}
+	return nil, false
 }
 
 func IsBindOperation(receivedPdu PDU) bool {
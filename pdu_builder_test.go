@@ -2,8 +2,10 @@ package smpp
 
 import (
 	"bytes"
+	"encoding/hex"
 	"reflect"
 	"testing"
+	"time"
 )
 
 func TestDefaultValueForNewBindTransmitterAndDefaultBindBody(t *testing.T) {
@@ -315,3 +317,75 @@ func comparePdu(actualPdu PDU, expectedPdu PDU, t *testing.T) {
 		t.Errorf("The constructor pattern isn't creating the expected PDU object! %v, want %v", got, expectedPdu)
 	}
 }
+
+func TestQueryCancelAndReplaceSmRoundTrip(t *testing.T) {
+	t.Parallel()
+	source := Address{Ton: 1, Npi: 1, Addr: "15551234567"}
+	destination := Address{Ton: 1, Npi: 1, Addr: "15557654321"}
+	tests := []struct {
+		name string
+		pdu  PDU
+	}{
+		{"query_sm", NewQuerySM().WithMessageId("42").WithSource(source)},
+		{"query_sm_resp", NewQuerySMResp().WithMessageId("42").WithFinalDate(smppTimeReference).WithMessageState("DELIVERED").WithErrorCode(3)},
+		{"query_sm_resp not final", NewQuerySMResp().WithMessageId("42").WithFinalDate(time.Time{}).WithMessageState("ENROUTE")},
+		{"cancel_sm", NewCancelSM().WithMessageId("42").WithSource(source).WithDestination(destination)},
+		{"cancel_sm_resp", NewCancelSMResp()},
+		{"replace_sm", NewReplaceSM().WithMessageId("42").WithSource(source).WithRelativeValidityPeriod(time.Hour).WithMessage("Replaced")},
+		{"replace_sm_resp", NewReplaceSMResp()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pduBytes, err := EncodePdu(tt.pdu)
+			if err != nil {
+				t.Fatalf("EncodePdu() error = %v", err)
+			}
+			parsedPdu, err := ParsePdu(pduBytes)
+			if err != nil {
+				t.Fatalf("ParsePdu() error = %v", err)
+			}
+			reencodedBytes, _ := EncodePdu(parsedPdu)
+			if !bytes.Equal(pduBytes, reencodedBytes) {
+				t.Errorf("Round trip changed the PDU : %x, want %x", reencodedBytes, pduBytes)
+			}
+			for name, value := range tt.pdu.Body.MandatoryParameter {
+				if name != "sm_length" && !reflect.DeepEqual(parsedPdu.Body.MandatoryParameter[name], value) {
+					t.Errorf("%v = %v, want %v", name, parsedPdu.Body.MandatoryParameter[name], value)
+				}
+			}
+		})
+	}
+}
+
+func TestNewOptionalParameterTypesTheTextOfTheTlv(t *testing.T) {
+	tests := []struct {
+		tag  string
+		text string
+		want string
+	}{
+		{"sar_msg_ref_num", "500", "020c000201f4"},
+		{"receipted_message_id", "abc", "001e000461626300"},
+		{"network_error_code", "0x030001", "0423000303" + "0001"},
+		{"0x1400", "0102", "140000020102"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.tag, func(t *testing.T) {
+			tlv, err := NewOptionalParameter(tt.tag, tt.text)
+			if err != nil {
+				t.Fatalf("NewOptionalParameter() error = %v", err)
+			}
+			pduBytes, err := EncodePdu(NewEnquireLink().WithOptionalParameter(tlv))
+			if err != nil {
+				t.Fatalf("EncodePdu() error = %v", err)
+			}
+			if got := hex.EncodeToString(pduBytes[16:]); got != tt.want {
+				t.Errorf("TLV encoded as %v, want %v", got, tt.want)
+			}
+		})
+	}
+	for _, tt := range []struct{ tag, text string }{{"not_a_tlv", "1"}, {"sar_msg_ref_num", "70000"}, {"message_payload", "zz"}} {
+		if _, err := NewOptionalParameter(tt.tag, tt.text); err == nil {
+			t.Errorf("Expected an error building %v from %q", tt.tag, tt.text)
+		}
+	}
+}
@@ -0,0 +1,226 @@
+package smpp
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// String renders the PDU field by field : the header on the first line, then
+// the mandatory parameters in the order of the specification and the TLVs
+// with their names, one per line.
+func (p PDU) String() string {
+	var out strings.Builder
+	fmt.Fprintf(&out, "%v sequence_number=%v command_status=%v", p.Header.CommandId, p.Header.SequenceNumber, p.Header.CommandStatus)
+	if p.Header.CommandLength != 0 {
+		fmt.Fprintf(&out, " command_length=%v", p.Header.CommandLength)
+	}
+	listed := map[string]bool{}
+	for _, mandatoryParam := range mandatoryParameterLists[p.Header.CommandId] {
+		name := mandatoryParam["name"].(string)
+		listed[name] = true
+		value, ok := p.Body.MandatoryParameter[name]
+		if !ok {
+			fmt.Fprintf(&out, "\n  %v: <missing>", name)
+			continue
+		}
+		fmt.Fprintf(&out, "\n  %v: %v", name, formatFieldValue(value, mandatoryParam["type"]))
+	}
+	var others []string
+	for name := range p.Body.MandatoryParameter {
+		if !listed[name] {
+			others = append(others, name)
+		}
+	}
+	sort.Strings(others)
+	for _, name := range others {
+		fmt.Fprintf(&out, "\n  %v: %v (not part of %v)", name, formatFieldValue(p.Body.MandatoryParameter[name], nil), p.Header.CommandId)
+	}
+	for _, optionalParam := range p.Body.OptionalParameters {
+		tag, _ := optionalParam["tag"].(string)
+		definition, _ := optionalParameterDefinition(tag)
+		if _, known := optionalParameterTagByName[tag]; !known {
+			fmt.Fprintf(&out, "\n  tlv %v: %v", tag, formatFieldValue(optionalParam["value"], definition["type"]))
+			continue
+		}
+		fmt.Fprintf(&out, "\n  tlv %v (0x%v): %v", tag, definition["hex"], formatFieldValue(optionalParam["value"], definition["type"]))
+	}
+	return out.String()
+}
+
+func formatFieldValue(value interface{}, fieldType interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return fmt.Sprintf("%q", v)
+	case []byte:
+		return "0x" + hex.EncodeToString(v)
+	case int:
+		if fieldType == "hex" {
+			return fmt.Sprintf("0x%02x", v)
+		}
+		return fmt.Sprint(v)
+	}
+	return fmt.Sprint(value)
+}
+
+// HexDump encodes the PDU and annotates its bytes, see HexDump.
+func (p PDU) HexDump() (string, error) {
+	pduBytes, err := EncodePdu(p)
+	if err != nil {
+		return "", err
+	}
+	return HexDump(pduBytes), nil
+}
+
+// HexDump annotates the bytes of a PDU with the field each range of bytes
+// belongs to :
+//
+//	0000-0003  00 00 00 2f                                      command_length 47
+//	0004-0007  00 00 00 09                                      command_id bind_transceiver
+//	...
+//
+// Bytes it can't make sense of, like a truncated body, are dumped as
+// undecoded instead of failing, so it can be used on whatever was received.
+func HexDump(pduBytes []byte) string {
+	var out strings.Builder
+	for _, field := range layoutPdu(pduBytes) {
+		fieldBytes := pduBytes[field.start:field.end]
+		for line := 0; line == 0 || line*16 < len(fieldBytes); line++ {
+			start := line * 16
+			end := start + 16
+			if end > len(fieldBytes) {
+				end = len(fieldBytes)
+			}
+			label := ""
+			if line == 0 {
+				label = field.name
+				if field.value != "" {
+					label += " " + field.value
+				}
+			}
+			hexBytes := make([]string, 0, 16)
+			for _, b := range fieldBytes[start:end] {
+				hexBytes = append(hexBytes, fmt.Sprintf("%02x", b))
+			}
+			byteRange := fmt.Sprintf("%04x-%04x", field.start+start, field.start+end-1)
+			if len(fieldBytes) == 0 {
+				byteRange = fmt.Sprintf("%04x     ", field.start)
+			}
+			fmt.Fprintf(&out, "%v  %-47s  %v\n", byteRange, strings.Join(hexBytes, " "), label)
+		}
+	}
+	return out.String()
+}
+
+// pduField is a range of bytes of an encoded PDU, end excluded.
+type pduField struct {
+	name       string
+	start, end int
+	value      string
+}
+
+// layoutPdu walks the bytes the way parseHeader and parseBody do, giving the
+// range of bytes of every field.
+func layoutPdu(pduBytes []byte) (fields []pduField) {
+	if len(pduBytes) < 16 {
+		return []pduField{{name: "undecoded (shorter than a header)", end: len(pduBytes)}}
+	}
+	length := int(binary.BigEndian.Uint32(pduBytes[0:4]))
+	commandId, _ := extractCommandID(pduBytes)
+	if commandId == "" {
+		commandId = "unknown 0x" + hex.EncodeToString(pduBytes[4:8])
+	}
+	commandStatus, _ := extractCommandStatus(pduBytes)
+	fields = append(fields,
+		pduField{"command_length", 0, 4, fmt.Sprint(length)},
+		pduField{"command_id", 4, 8, commandId},
+		pduField{"command_status", 8, 12, commandStatus},
+		pduField{"sequence_number", 12, 16, fmt.Sprint(extractSequenceNumber(pduBytes))},
+	)
+	end := len(pduBytes)
+	if length >= 16 && length < end {
+		end = length
+	}
+	offset, body := layoutMandatoryParameters(commandId, pduBytes[:end], 16)
+	fields = append(fields, body...)
+	offset, tlvs := layoutOptionalParameters(pduBytes[:end], offset)
+	fields = append(fields, tlvs...)
+	if offset < end {
+		fields = append(fields, pduField{name: "undecoded", start: offset, end: end})
+	}
+	if end < len(pduBytes) {
+		fields = append(fields, pduField{name: "trailing (after command_length)", start: end, end: len(pduBytes)})
+	}
+	return fields
+}
+
+func layoutMandatoryParameters(commandId string, pduBytes []byte, offset int) (int, []pduField) {
+	var fields []pduField
+	integers := map[string]int{}
+	for _, mandatoryParam := range mandatoryParameterLists[commandId] {
+		name := mandatoryParam["name"].(string)
+		switch mandatoryParam["type"] {
+		case "string":
+			nul := strings.IndexByte(string(pduBytes[offset:]), 0)
+			if nul < 0 {
+				return offset, fields
+			}
+			fields = append(fields, pduField{name, offset, offset + nul + 1, fmt.Sprintf("%q", pduBytes[offset:offset+nul])})
+			offset += nul + 1
+		case "integer", "hex":
+			size := mandatoryParam["max"].(int)
+			if offset+size > len(pduBytes) {
+				return offset, fields
+			}
+			value := 0
+			for _, b := range pduBytes[offset : offset+size] {
+				value = value<<8 | int(b)
+			}
+			integers[name] = value
+			fields = append(fields, pduField{name, offset, offset + size, formatFieldValue(value, mandatoryParam["type"])})
+			offset += size
+		case "xstring":
+			size := integers[mandatoryParam["var"].(string)]
+			if offset+size > len(pduBytes) {
+				return offset, fields
+			}
+			fields = append(fields, pduField{name, offset, offset + size, fmt.Sprintf("%q", pduBytes[offset:offset+size])})
+			offset += size
+		default:
+			// Lists of destinations aren't decoded, what follows is left undecoded.
+			return offset, fields
+		}
+	}
+	return offset, fields
+}
+
+func layoutOptionalParameters(pduBytes []byte, offset int) (int, []pduField) {
+	var fields []pduField
+	for offset+4 <= len(pduBytes) {
+		tagHex := hex.EncodeToString(pduBytes[offset : offset+2])
+		length := int(binary.BigEndian.Uint16(pduBytes[offset+2 : offset+4]))
+		if offset+4+length > len(pduBytes) {
+			break
+		}
+		name := "tlv 0x" + tagHex
+		if definition, ok := optionalParameterTagByHex[tagHex]; ok {
+			name = fmt.Sprintf("tlv %v", definition["name"])
+		}
+		fields = append(fields,
+			pduField{name + " tag", offset, offset + 2, "0x" + tagHex},
+			pduField{name + " length", offset + 2, offset + 4, fmt.Sprint(length)},
+		)
+		if length > 0 {
+			value := ""
+			if definition, ok := optionalParameterTagByHex[tagHex]; ok {
+				param, _ := extractSpecificOptionalParameter(pduBytes[offset:])
+				value = formatFieldValue(param["value"], definition["type"])
+			}
+			fields = append(fields, pduField{name + " value", offset + 4, offset + 4 + length, value})
+		}
+		offset += 4 + length
+	}
+	return offset, fields
+}
@@ -0,0 +1,99 @@
+package smpp
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPduStringListsTheFieldsInSpecificationOrder(t *testing.T) {
+	pdu, _ := ParsePdu(deliverSmOptionsFixture)
+
+	got := pdu.String()
+
+	want := []string{
+		"deliver_sm sequence_number=1 command_status=ESME_ROK command_length=63",
+		"  service_type: \"\"",
+		"  source_addr_ton: 0",
+		"  destination_addr: \"5555551234\"",
+		"  esm_class: 4",
+		"  short_message: \"\"",
+		"  tlv receipted_message_id (0x001e): \"11107\"",
+		"  tlv message_state (0x0427): 2",
+		"  tlv delivery_failure_reason (0x0425): 0",
+	}
+	lines := strings.Split(got, "\n")
+	position := 0
+	for _, line := range want {
+		for position < len(lines) && lines[position] != line {
+			position++
+		}
+		if position == len(lines) {
+			t.Fatalf("%q missing or out of order in :\n%v", line, got)
+		}
+	}
+	for i := 0; i < 10; i++ {
+		if again := pdu.String(); again != got {
+			t.Fatalf("String isn't stable :\n%v\nthen\n%v", got, again)
+		}
+	}
+}
+
+func TestPduStringShowsMissingAndExtraFields(t *testing.T) {
+	pdu := NewBindTransmitterResp()
+	delete(pdu.Body.MandatoryParameter, "system_id")
+	pdu.Body.MandatoryParameter["unexpected"] = 7
+
+	got := pdu.String()
+
+	for _, line := range []string{"  system_id: <missing>", "  unexpected: 7 (not part of bind_transmitter_resp)"} {
+		if !strings.Contains(got, line) {
+			t.Errorf("%q missing from :\n%v", line, got)
+		}
+	}
+}
+
+func TestHexDumpAnnotatesTheBytesOfEachField(t *testing.T) {
+	got := HexDump(deliverSmOptionsFixture)
+
+	for _, line := range []string{
+		"0000-0003  00 00 00 3f",
+		"command_length 63",
+		"0016-0020  35 35 35 35 35 35 31 32 33 34 00",
+		"destination_addr \"5555551234\"",
+		"002b                                                        short_message \"\"",
+		"002b-002c  00 1e",
+		"tlv receipted_message_id tag 0x001e",
+		"002f-0034  31 31 31 30 37 00",
+		"tlv receipted_message_id value \"11107\"",
+		"003e-003e  00",
+		"tlv delivery_failure_reason value 0",
+	} {
+		if !strings.Contains(got, line) {
+			t.Errorf("%q missing from :\n%v", line, got)
+		}
+	}
+}
+
+func TestHexDumpLeavesWhatItCantDecode(t *testing.T) {
+	got := HexDump(bindTransmitterFixture[:25])
+
+	if !strings.Contains(got, "0010-0014  74 65 73 74 00") || !strings.Contains(got, "0015-0018  74 65 73 74") || !strings.Contains(got, "undecoded") {
+		t.Errorf("Truncated bind wasn't dumped as far as it could :\n%v", got)
+	}
+	if got := HexDump(enquiryLinkFixture[:3]); !strings.Contains(got, "undecoded") {
+		t.Errorf("Truncated header wasn't dumped :\n%v", got)
+	}
+}
+
+func TestPduHexDumpEncodesThePdu(t *testing.T) {
+	got, err := NewSubmitSM().WithMessage("hello").HexDump()
+	if err != nil {
+		t.Fatalf("Couldn't dump the submit_sm : %v", err)
+	}
+	if !strings.Contains(got, "68 65 6c 6c 6f") || !strings.Contains(got, "sm_length 5") {
+		t.Errorf("Short message wasn't dumped with its computed length :\n%v", got)
+	}
+	if _, err := (PDU{}).HexDump(); err == nil {
+		t.Errorf("Expected an error dumping a PDU without header")
+	}
+}
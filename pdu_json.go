@@ -0,0 +1,209 @@
+package smpp
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+type pduJSON struct {
+	Header headerJSON `json:"header"`
+	Body   bodyJSON   `json:"body"`
+}
+
+type headerJSON struct {
+	CommandLength  int    `json:"command_length"`
+	CommandId      string `json:"command_id"`
+	CommandStatus  string `json:"command_status"`
+	SequenceNumber int    `json:"sequence_number"`
+}
+
+type bodyJSON struct {
+	MandatoryParameters map[string]json.RawMessage `json:"mandatory_parameters"`
+	OptionalParameters  []tlvJSON                  `json:"optional_parameters,omitempty"`
+}
+
+type tlvJSON struct {
+	Tag    string          `json:"tag"`
+	Length *int            `json:"length,omitempty"`
+	Value  json.RawMessage `json:"value"`
+}
+
+// MarshalJSON renders the PDU as :
+//
+//	{
+//	  "header": {"command_length": 47, "command_id": "submit_sm", "command_status": "ESME_ROK", "sequence_number": 2},
+//	  "body": {
+//	    "mandatory_parameters": {"service_type": "", "source_addr_ton": 1, ..., "short_message": "aGVsbG8="},
+//	    "optional_parameters": [
+//	      {"tag": "message_state", "length": 1, "value": 2},
+//	      {"tag": "0x1400", "length": 2, "value": "AQI="}
+//	    ]
+//	  }
+//	}
+//
+// Mandatory parameters are typed by the specification : C-Octet strings are
+// JSON strings, integers are numbers and short_message is base64 as it's
+// binary.  Parameters the command doesn't have are kept with their JSON type.
+//
+// TLVs are named like in the Body, unknown ones by their tag in hex.  Their
+// value is a number for integers, a string for strings and base64 for octet
+// strings and unknown TLVs.  The length is optional when unmarshalling, it's
+// computed from the value when missing.
+//
+// A PDU decoded by ParsePdu goes through MarshalJSON and UnmarshalJSON back
+// to the same PDU, which EncodePdu encodes to the same bytes.
+func (p PDU) MarshalJSON() ([]byte, error) {
+	out := pduJSON{
+		Header: headerJSON(p.Header),
+		Body:   bodyJSON{MandatoryParameters: map[string]json.RawMessage{}},
+	}
+	for name, value := range p.Body.MandatoryParameter {
+		fieldType := mandatoryParameterType(p.Header.CommandId, name)
+		if fieldType == "xstring" {
+			value = octets(value)
+		}
+		raw, err := json.Marshal(value)
+		if err != nil {
+			return nil, fmt.Errorf("Couldn't marshal %v of %v : %v", name, p.Header.CommandId, err)
+		}
+		out.Body.MandatoryParameters[name] = raw
+	}
+	for _, optionalParam := range p.Body.OptionalParameters {
+		tag, _ := optionalParam["tag"].(string)
+		definition, _ := optionalParameterDefinition(tag)
+		value := optionalParam["value"]
+		length, hasLength := optionalParam["length"].(int)
+		if integer, ok := value.(int); ok && definition["type"] == "hex" && hasLength && length > 1 {
+			value = encodeInteger(integer, length)
+		} else if definition["type"] == "hex" || definition == nil {
+			value = octets(value)
+		}
+		raw, err := json.Marshal(value)
+		if err != nil {
+			return nil, fmt.Errorf("Couldn't marshal optional parameter %v : %v", tag, err)
+		}
+		tlv := tlvJSON{Tag: tag, Value: raw}
+		if hasLength {
+			tlv.Length = &length
+		}
+		out.Body.OptionalParameters = append(out.Body.OptionalParameters, tlv)
+	}
+	return json.Marshal(out)
+}
+
+// octets gives the bytes of a binary value, marshalled as base64.
+func octets(value interface{}) interface{} {
+	switch v := value.(type) {
+	case string:
+		return []byte(v)
+	case int:
+		return []byte{byte(v)}
+	}
+	return value
+}
+
+func (p *PDU) UnmarshalJSON(data []byte) error {
+	var in pduJSON
+	if err := json.Unmarshal(data, &in); err != nil {
+		return err
+	}
+	pdu := PDU{
+		Header: Header(in.Header),
+		Body:   Body{MandatoryParameter: map[string]interface{}{}},
+	}
+	for name, raw := range in.Body.MandatoryParameters {
+		value, err := unmarshalValue(raw, mandatoryParameterType(pdu.Header.CommandId, name))
+		if err != nil {
+			return fmt.Errorf("Couldn't unmarshal %v of %v : %v", name, pdu.Header.CommandId, err)
+		}
+		if octetString, ok := value.([]byte); ok {
+			value = string(octetString)
+		}
+		pdu.Body.MandatoryParameter[name] = value
+	}
+	for _, tlv := range in.Body.OptionalParameters {
+		definition, ok := optionalParameterDefinition(tlv.Tag)
+		if !ok {
+			return fmt.Errorf("Couldn't unmarshal optional parameter %q : unknown tag", tlv.Tag)
+		}
+		fieldType, _ := definition["type"].(string)
+		value, err := unmarshalValue(tlv.Value, fieldType)
+		if err != nil {
+			return fmt.Errorf("Couldn't unmarshal optional parameter %v : %v", tlv.Tag, err)
+		}
+		_, known := optionalParameterTagByName[tlv.Tag]
+		if octetString, ok := value.([]byte); ok && known && len(octetString) == 1 {
+			value = int(octetString[0]) // like ParsePdu does for single octets
+		}
+		length := 0
+		if tlv.Length != nil {
+			length = *tlv.Length
+		} else {
+			length = optionalParameterLength(value)
+		}
+		pdu.Body.OptionalParameters = append(pdu.Body.OptionalParameters, map[string]interface{}{
+			"tag":    tlv.Tag,
+			"length": length,
+			"value":  value,
+		})
+	}
+	*p = pdu
+	return nil
+}
+
+func unmarshalValue(raw json.RawMessage, fieldType string) (interface{}, error) {
+	switch fieldType {
+	case "string":
+		var value string
+		err := json.Unmarshal(raw, &value)
+		return value, err
+	case "integer":
+		var value int
+		err := json.Unmarshal(raw, &value)
+		return value, err
+	case "xstring", "hex":
+		var value []byte
+		err := json.Unmarshal(raw, &value)
+		return value, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	if number, ok := value.(json.Number); ok {
+		if integer, err := number.Int64(); err == nil {
+			return int(integer), nil
+		}
+		return number.Float64()
+	}
+	return value, nil
+}
+
+// mandatoryParameterType gives the type of a mandatory parameter as found
+// in mandatoryParameterLists, except interface_version and the likes which
+// are integers in the Body.
+func mandatoryParameterType(commandId string, name string) string {
+	for _, mandatoryParam := range mandatoryParameterLists[commandId] {
+		if mandatoryParam["name"] == name {
+			if mandatoryParam["type"] == "hex" {
+				return "integer"
+			}
+			fieldType, _ := mandatoryParam["type"].(string)
+			return fieldType
+		}
+	}
+	return ""
+}
+
+func optionalParameterLength(value interface{}) int {
+	switch v := value.(type) {
+	case string:
+		return len(v) + 1
+	case []byte:
+		return len(v)
+	}
+	return 1
+}
@@ -0,0 +1,102 @@
+package smpp
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// submit_sm with a binary short_message, a 2 octets sar_msg_ref_num, a
+// receipted_message_id without its NUL and an unknown 0x1400 TLV.
+var submitSmWithBinaryAndUnknownTlvsFixture, _ = hex.DecodeString("00000045000000040000000000000007000101353535313233000101353535333231000000000000000004000500ff0080fe020c000201f4001e0003616263140000020102")
+
+func TestPduJSONRoundTripsByteExactly(t *testing.T) {
+	fixtures := map[string][]byte{
+		"enquire_link":            enquiryLinkFixture,
+		"bind_transmitter":        bindTransmitterFixture,
+		"bind_transmitter_resp":   bindTransmitterRespFixture,
+		"submit_sm_resp":          submitSmRespFixture,
+		"deliver_sm with TLVs":    deliverSmOptionsFixture,
+		"binary and unknown TLVs": submitSmWithBinaryAndUnknownTlvsFixture,
+	}
+	for name, fixture := range fixtures {
+		t.Run(name, func(t *testing.T) {
+			pdu, err := ParsePdu(fixture)
+			if err != nil {
+				t.Fatalf("Couldn't parse the fixture : %v", err)
+			}
+			marshalled, err := json.Marshal(pdu)
+			if err != nil {
+				t.Fatalf("Couldn't marshal %v : %v", pdu, err)
+			}
+			var unmarshalled PDU
+			if err := json.Unmarshal(marshalled, &unmarshalled); err != nil {
+				t.Fatalf("Couldn't unmarshal %s : %v", marshalled, err)
+			}
+			if !reflect.DeepEqual(unmarshalled, pdu) {
+				t.Errorf("Unmarshalled\n%v\nwant\n%v", unmarshalled, pdu)
+			}
+			encoded, err := EncodePdu(unmarshalled)
+			if err != nil || !bytes.Equal(encoded, fixture) {
+				t.Errorf("Encoded back to %x, want %x (%v)\n%s", encoded, fixture, err, marshalled)
+			}
+		})
+	}
+}
+
+func TestPduJSONRendersBinaryFieldsInBase64(t *testing.T) {
+	pdu, _ := ParsePdu(submitSmWithBinaryAndUnknownTlvsFixture)
+
+	marshalled, _ := json.Marshal(pdu)
+
+	for _, want := range []string{
+		`"command_id":"submit_sm"`,
+		`"short_message":"AP8AgP4="`,
+		`"sm_length":5`,
+		`{"tag":"sar_msg_ref_num","length":2,"value":500}`,
+		`{"tag":"receipted_message_id","length":3,"value":"abc"}`,
+		`{"tag":"0x1400","length":2,"value":"AQI="}`,
+	} {
+		if !strings.Contains(string(marshalled), want) {
+			t.Errorf("%s missing from %s", want, marshalled)
+		}
+	}
+}
+
+func TestPduJSONComputesWhatIsLeftOut(t *testing.T) {
+	var pdu PDU
+	err := json.Unmarshal([]byte(`{
+		"header": {"command_id": "submit_sm_resp", "command_status": "ESME_ROK", "sequence_number": 3},
+		"body": {
+			"mandatory_parameters": {"message_id": "1"},
+			"optional_parameters": [{"tag": "receipted_message_id", "value": "1"}, {"tag": "message_state", "value": 2}]
+		}
+	}`), &pdu)
+	if err != nil {
+		t.Fatalf("Couldn't unmarshal : %v", err)
+	}
+
+	encoded, err := EncodePdu(pdu)
+
+	want, _ := hex.DecodeString("0000001d80000004000000000000000331" + "00" + "001e00023100" + "0427000102")
+	if err != nil || !bytes.Equal(encoded, want) {
+		t.Errorf("Encoded to %x, want %x (%v)", encoded, want, err)
+	}
+}
+
+func TestPduJSONRefusesMistypedFields(t *testing.T) {
+	for _, document := range []string{
+		`{"header": {"command_id": "submit_sm_resp"}, "body": {"mandatory_parameters": {"message_id": 1}}}`,
+		`{"header": {"command_id": "deliver_sm"}, "body": {"mandatory_parameters": {"short_message": "not base64 !"}}}`,
+		`{"header": {"command_id": "deliver_sm"}, "body": {"optional_parameters": [{"tag": "message_state", "value": "2"}]}}`,
+		`{"header": {"command_id": "deliver_sm"}, "body": {"optional_parameters": [{"tag": "not_a_tlv", "value": 2}]}}`,
+	} {
+		var pdu PDU
+		if err := json.Unmarshal([]byte(document), &pdu); err == nil {
+			t.Errorf("Expected an error unmarshalling %v, got %v", document, pdu)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package smpp
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Route sends the messages whose destination address starts with
+// DestinationPrefix to the receivers bound as SystemId.  SourceSystemId
+// restricts the route to the messages submitted under that system_id.  Empty
+// DestinationPrefix and SourceSystemId match every message, SystemId is
+// required.
+type Route struct {
+	DestinationPrefix string
+	SourceSystemId    string
+	SystemId          string
+}
+
+// RoutingTable holds the routes of the SMSC, the first matching route of the
+// table is the one used.  It's safe to add routes while the SMSC is running.
+type RoutingTable struct {
+	mu     sync.RWMutex
+	routes []Route
+}
+
+func NewRoutingTable(routes ...Route) (*RoutingTable, error) {
+	t := &RoutingTable{}
+	for _, route := range routes {
+		if err := t.AddRoute(route); err != nil {
+			return nil, err
+		}
+	}
+	return t, nil
+}
+
+// AddRoute refuses routes without a SystemId, no receiver could ever take
+// their messages.
+func (t *RoutingTable) AddRoute(route Route) error {
+	if route.SystemId == "" {
+		return fmt.Errorf("Route to %q has no SystemId", route.DestinationPrefix)
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.routes = append(t.routes, route)
+	return nil
+}
+
+func (t *RoutingTable) Routes() []Route {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return append([]Route{}, t.routes...)
+}
+
+func (t *RoutingTable) Match(message StoredMessage) (Route, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	for _, route := range t.routes {
+		if route.matches(message) {
+			return route, true
+		}
+	}
+	return Route{}, false
+}
+
+func (r Route) matches(message StoredMessage) bool {
+	return strings.HasPrefix(message.Destination.Addr, r.DestinationPrefix) &&
+		(r.SourceSystemId == "" || r.SourceSystemId == message.SystemId)
+}
@@ -0,0 +1,49 @@
+package smpp
+
+import (
+	"testing"
+)
+
+func TestRoutingTableMatchesTheFirstRouteInOrder(t *testing.T) {
+	t.Parallel()
+	table, _ := NewRoutingTable(
+		Route{DestinationPrefix: "1555", SourceSystemId: "marketing", SystemId: "bulk"},
+		Route{DestinationPrefix: "1555", SystemId: "north-america"},
+	)
+	if err := table.AddRoute(Route{SystemId: "default"}); err != nil {
+		t.Fatalf("Couldn't add the default route : %v", err)
+	}
+	tests := []struct {
+		name    string
+		message StoredMessage
+		want    string
+	}{
+		{"source system_id and prefix", StoredMessage{SystemId: "marketing", Destination: Address{Addr: "15551234567"}}, "bulk"},
+		{"prefix only", StoredMessage{SystemId: "alerts", Destination: Address{Addr: "15551234567"}}, "north-america"},
+		{"catch all", StoredMessage{SystemId: "marketing", Destination: Address{Addr: "442079460958"}}, "default"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			route, ok := table.Match(tt.message)
+			if !ok || route.SystemId != tt.want {
+				t.Errorf("Match() = %+v, %v, want route to %v", route, ok, tt.want)
+			}
+		})
+	}
+	if empty, _ := NewRoutingTable(); empty == nil {
+		t.Errorf("An empty routing table should be created")
+	} else if _, ok := empty.Match(StoredMessage{}); ok {
+		t.Errorf("An empty routing table shouldn't match anything")
+	}
+}
+
+func TestRoutingTableRefusesRoutesWithoutSystemId(t *testing.T) {
+	t.Parallel()
+	if _, err := NewRoutingTable(Route{DestinationPrefix: "1555"}); err == nil {
+		t.Errorf("A route without SystemId should be refused")
+	}
+	table, _ := NewRoutingTable()
+	if err := table.AddRoute(Route{SourceSystemId: "marketing"}); err == nil || len(table.Routes()) != 0 {
+		t.Errorf("A route without SystemId should be refused : %v, %v", err, table.Routes())
+	}
+}
@@ -0,0 +1,157 @@
+package smpp
+
+import "time"
+
+// messageTimers are the timers of a message until it reaches a final state.
+// delivery is nil once the message is handed over to a receiver, only its
+// expiry can then bring it to a final state besides the deliver_sm_resp.
+// awaitingReceiver marks the messages routed while their receiver isn't
+// bound, retried as soon as a receiver binds.
+type messageTimers struct {
+	delivery         Timer
+	expiry           Timer
+	awaitingReceiver bool
+}
+
+const defaultDeliveryRetryDelay = 10 * time.Second
+
+func (t *messageTimers) stop() {
+	if t.delivery != nil {
+		t.delivery.Stop()
+	}
+	if t.expiry != nil {
+		t.expiry.Stop()
+	}
+}
+
+// scheduleMessage holds the message until its schedule_delivery_time and
+// expires it at the end of its validity_period.
+func (s *SMSC) scheduleMessage(message StoredMessage) {
+	s.timersMu.Lock()
+	defer s.timersMu.Unlock()
+	s.scheduleMessageLocked(message)
+}
+
+func (s *SMSC) scheduleMessageLocked(message StoredMessage) {
+	if previous, ok := s.timers[message.MessageId]; ok {
+		previous.stop()
+	}
+	messageId := message.MessageId
+	now := s.Clock.Now()
+	timers := &messageTimers{}
+	if !message.ExpiryTime.IsZero() {
+		timers.expiry = s.Clock.AfterFunc(message.ExpiryTime.Sub(now), func() {
+			s.finalizeMessage(messageId, "EXPIRED")
+		})
+	}
+	timers.delivery = s.Clock.AfterFunc(message.ScheduleDeliveryTime.Sub(now), func() {
+		s.dispatchMessage(messageId)
+	})
+	s.timers[messageId] = timers
+}
+
+func (s *SMSC) dispatchMessage(messageId string) {
+	s.timersMu.Lock()
+	timers, ok := s.timers[messageId]
+	message, err := s.MessageStore.Get(messageId)
+	if !ok || timers.delivery == nil || err != nil || message.State != "ENROUTE" || s.shuttingDown.Load() {
+		s.timersMu.Unlock()
+		return
+	}
+	timers.awaitingReceiver = false
+	receiver, routed := s.routeMessage(message)
+	switch {
+	case receiver != nil:
+		timers.delivery = nil
+	case routed:
+		s.log().Info("No receiver bound to deliver the message, retrying later", "message_id", messageId)
+		timers.awaitingReceiver = true
+		timers.delivery = s.Clock.AfterFunc(s.deliveryRetryDelay(), func() {
+			s.dispatchMessage(messageId)
+		})
+	default:
+		// Without any receiver, messages simply reach the configured final
+		// state after the configured delay.
+		finalState := s.DeliveryReceiptState
+		if !IsMessageState(finalState) {
+			s.log().Warn("Unknown DeliveryReceiptState, the message is reported UNKNOWN", "message_id", messageId, "state", finalState)
+			finalState = "UNKNOWN"
+		}
+		timers.delivery = s.Clock.AfterFunc(s.DeliveryReceiptDelay, func() {
+			s.finalizeMessage(messageId, finalState)
+		})
+	}
+	s.timersMu.Unlock()
+	if receiver != nil {
+		s.deliverMessage(receiver, message)
+	}
+}
+
+func (s *SMSC) forgetMessage(messageId string) {
+	s.timersMu.Lock()
+	defer s.timersMu.Unlock()
+	if timers, ok := s.timers[messageId]; ok {
+		timers.stop()
+		delete(s.timers, messageId)
+	}
+}
+
+func (s *SMSC) deliveryRetryDelay() time.Duration {
+	if s.DeliveryRetryDelay <= 0 {
+		return defaultDeliveryRetryDelay
+	}
+	return s.DeliveryRetryDelay
+}
+
+// retryDelivery brings back a message handed over to a receiver which
+// didn't take it, to be dispatched again after the delay.  Messages which
+// reached a final state meanwhile, or are no longer scheduled, are left
+// alone.  Once shutting down, the message is UNDELIVERABLE instead.
+func (s *SMSC) retryDelivery(messageId string, delay time.Duration) {
+	if s.shuttingDown.Load() {
+		s.finalizeMessage(messageId, "UNDELIVERABLE")
+		return
+	}
+	s.timersMu.Lock()
+	defer s.timersMu.Unlock()
+	timers, ok := s.timers[messageId]
+	if !ok || timers.delivery != nil {
+		return
+	}
+	timers.delivery = s.Clock.AfterFunc(delay, func() {
+		s.dispatchMessage(messageId)
+	})
+}
+
+// dispatchAwaitingMessages dispatches right away the messages waiting for
+// their receiver to bind, once a receiver binds.
+func (s *SMSC) dispatchAwaitingMessages() {
+	s.timersMu.Lock()
+	defer s.timersMu.Unlock()
+	for messageId, timers := range s.timers {
+		if !timers.awaitingReceiver {
+			continue
+		}
+		messageId := messageId
+		timers.delivery.Stop()
+		timers.awaitingReceiver = false
+		timers.delivery = s.Clock.AfterFunc(0, func() {
+			s.dispatchMessage(messageId)
+		})
+	}
+}
+
+// retryPendingDeliveries brings back the messages the receiver didn't
+// acknowledge before its session ended.
+func (s *SMSC) retryPendingDeliveries(receiver *Session) {
+	s.pendingDeliveries.Range(func(key, value interface{}) bool {
+		if key.(deliveryKey).receiver != receiver {
+			return true
+		}
+		if _, ok := s.pendingDeliveries.LoadAndDelete(key); ok {
+			receiver.metrics.WindowOccupancy(-1)
+			s.retryDelivery(value.(pendingDelivery).messageId, 0)
+		}
+		return true
+	})
+}
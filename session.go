@@ -0,0 +1,115 @@
+package smpp
+
+import (
+	"net"
+	"regexp"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Session is the server side of a connection made to the SMSC.  It wraps the
+// ESME talking to the remote end with what the SMSC knows about it.  The
+// CommandFunctions of a session start empty, handlers registered there take
+// precedence over the SMSC behaviour for that session only.
+type Session struct {
+	*ESME
+	remoteAddr  net.Addr
+	connectedAt time.Time
+
+	mu           sync.RWMutex
+	systemId     string
+	bindType     string
+	boundAt      time.Time
+	addressRange *regexp.Regexp
+
+	messagesSubmitted atomic.Uint64
+	messagesDelivered atomic.Uint64
+}
+
+// SessionCounters are the totals of a session since it connected.  Messages
+// are counted once accepted by the SMSC for MessagesSubmitted, and once
+// acknowledged by the receiver for MessagesDelivered.
+type SessionCounters struct {
+	PdusReceived      uint64
+	PdusSent          uint64
+	MessagesSubmitted uint64
+	MessagesDelivered uint64
+}
+
+func newSession(connection net.Conn, connectedAt time.Time) *Session {
+	e := NewEsme(connection)
+	e.CommandFunctions = map[string]func(*ESME, PDU) error{}
+	return &Session{
+		ESME:        e,
+		remoteAddr:  connection.RemoteAddr(),
+		connectedAt: connectedAt,
+	}
+}
+
+func (session *Session) RemoteAddr() net.Addr {
+	return session.remoteAddr
+}
+
+func (session *Session) ConnectedAt() time.Time {
+	return session.connectedAt
+}
+
+// SystemId gives the system_id the session is bound as, empty when unbound.
+func (session *Session) SystemId() string {
+	session.mu.RLock()
+	defer session.mu.RUnlock()
+	return session.systemId
+}
+
+// BindType gives the command_id of the bind (ie. "bind_transceiver"), empty
+// when unbound.
+func (session *Session) BindType() string {
+	session.mu.RLock()
+	defer session.mu.RUnlock()
+	return session.bindType
+}
+
+func (session *Session) BoundAt() time.Time {
+	session.mu.RLock()
+	defer session.mu.RUnlock()
+	return session.boundAt
+}
+
+func (session *Session) Counters() SessionCounters {
+	return SessionCounters{
+		PdusReceived:      session.pdusReceived.Load(),
+		PdusSent:          session.pdusSent.Load(),
+		MessagesSubmitted: session.messagesSubmitted.Load(),
+		MessagesDelivered: session.messagesDelivered.Load(),
+	}
+}
+
+// log gives the Logger of the session, scoped to its system_id once bound.
+func (session *Session) log() Logger {
+	if systemId := session.SystemId(); systemId != "" {
+		return loggerWith(session.logger, "system_id", systemId)
+	}
+	return session.logger
+}
+
+func (session *Session) bind(systemId string, bindType string, addressRange *regexp.Regexp, boundAt time.Time) {
+	session.mu.Lock()
+	defer session.mu.Unlock()
+	session.systemId = systemId
+	session.bindType = bindType
+	session.addressRange = addressRange
+	session.boundAt = boundAt
+}
+
+func (session *Session) unbind() {
+	session.bind("", "", nil, time.Time{})
+}
+
+// servesDestination tells whether the address_range given at bind matches
+// the address.  Sessions bound without an address_range serve none.
+func (session *Session) servesDestination(address string) bool {
+	session.mu.RLock()
+	defer session.mu.RUnlock()
+	return session.addressRange != nil && session.addressRange.MatchString(address)
+}
@@ -0,0 +1,198 @@
+package smpp
+
+import (
+	"fmt"
+	"time"
+)
+
+// SMPP times are 16 characters long, "YYMMDDhhmmsstnnp" where "t" is the
+// tenth of second, "nn" the offset from UTC in quarter of hours and "p" the
+// direction of that offset ("+" or "-").  A "p" of "R" means the time is
+// relative to the SMSC current time (SMPP v3.4, section 7.1.1).
+const (
+	smppTimeLength        = 16
+	smppAbsoluteLayout    = "060102150405"
+	smppRelativeDirection = 'R'
+	quarterHourInSeconds  = 15 * 60
+	maxQuarterHourOffset  = 48
+	relativeDaysCarry     = 99 // days field is only 2 digits long
+)
+
+// FormatAbsoluteTime renders t in the SMPP absolute time format.  Times in a
+// timezone not aligned on a quarter of hour are rendered in UTC.
+func FormatAbsoluteTime(t time.Time) string {
+	_, offset := t.Zone()
+	if offset%quarterHourInSeconds != 0 || abs(offset/quarterHourInSeconds) > maxQuarterHourOffset {
+		t = t.UTC()
+		offset = 0
+	}
+	direction := '+'
+	if offset < 0 {
+		direction = '-'
+	}
+	return fmt.Sprintf("%s%01d%02d%c", t.Format(smppAbsoluteLayout), t.Nanosecond()/int(100*time.Millisecond), abs(offset/quarterHourInSeconds), direction)
+}
+
+// FormatRelativeTime renders d in the SMPP relative time format.  As the
+// days field only holds 2 digits, longer durations are carried in months of
+// 30 days and years of 12 months.
+func FormatRelativeTime(d time.Duration) string {
+	if d < 0 {
+		d = 0
+	}
+	seconds := int(d / time.Second)
+	days := seconds / 86400
+	years, months := 0, 0
+	if days > relativeDaysCarry {
+		months = days / 30
+		days = days % 30
+		years = months / 12
+		months = months % 12
+	}
+	return fmt.Sprintf("%02d%02d%02d%02d%02d%02d000%c", years, months, days, seconds%86400/3600, seconds%3600/60, seconds%60, smppRelativeDirection)
+}
+
+// ParseSmppTime converts an SMPP absolute or relative time into a Go time.
+// Relative times are resolved from the reference time (usually now), their
+// months being 30 days and years 12 months as in FormatRelativeTime.  An
+// empty value is valid in SMPP and means "immediate" or "SMSC default", hence
+// it returns the zero time.
+func ParseSmppTime(value string, reference time.Time) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if len(value) != smppTimeLength {
+		return time.Time{}, fmt.Errorf("SMPP time %q should be %v characters long", value, smppTimeLength)
+	}
+	fields := make([]int, 6)
+	for i := range fields {
+		field, ok := smppTimeDigits(value[i*2 : i*2+2])
+		if !ok {
+			return time.Time{}, fmt.Errorf("SMPP time %q isn't made of digits", value)
+		}
+		fields[i] = field
+	}
+	tenths, ok := smppTimeDigits(value[12:13])
+	if !ok {
+		return time.Time{}, fmt.Errorf("SMPP time %q isn't made of digits", value)
+	}
+	quarterHours, ok := smppTimeDigits(value[13:15])
+	if !ok {
+		return time.Time{}, fmt.Errorf("SMPP time %q isn't made of digits", value)
+	}
+	years, months, days, hours, minutes, seconds := fields[0], fields[1], fields[2], fields[3], fields[4], fields[5]
+
+	switch value[15] {
+	case smppRelativeDirection:
+		if value[12:15] != "000" {
+			return time.Time{}, fmt.Errorf("SMPP relative time %q should end with \"000R\"", value)
+		}
+		days += (years*12 + months) * 30
+		return reference.Add(time.Duration(days)*24*time.Hour +
+			time.Duration(hours)*time.Hour + time.Duration(minutes)*time.Minute + time.Duration(seconds)*time.Second), nil
+	case '+', '-':
+		if quarterHours > maxQuarterHourOffset {
+			return time.Time{}, fmt.Errorf("SMPP time %q has an invalid UTC offset", value)
+		}
+		offset := quarterHours * quarterHourInSeconds
+		if value[15] == '-' {
+			offset = -offset
+		}
+		location := time.FixedZone("", offset)
+		parsed := time.Date(2000+years, time.Month(months), days, hours, minutes, seconds, tenths*int(100*time.Millisecond), location)
+		if parsed.Format(smppAbsoluteLayout) != value[:12] {
+			return time.Time{}, fmt.Errorf("SMPP time %q isn't a valid date", value)
+		}
+		return parsed, nil
+	}
+	return time.Time{}, fmt.Errorf("SMPP time %q has an invalid direction %q", value, value[15])
+}
+
+// smppTimeDigits decodes a field of an SMPP time, which can only be made of
+// ASCII digits.
+func smppTimeDigits(field string) (int, bool) {
+	value := 0
+	for _, digit := range []byte(field) {
+		if digit < '0' || digit > '9' {
+			return 0, false
+		}
+		value = value*10 + int(digit-'0')
+	}
+	return value, true
+}
+
+// WithScheduleDeliveryTime sets when the SMSC should deliver the message, a
+// zero time meaning "immediately".
+func (p PDU) WithScheduleDeliveryTime(t time.Time) PDU {
+	p.Body.MandatoryParameter["schedule_delivery_time"] = ""
+	if !t.IsZero() {
+		p.Body.MandatoryParameter["schedule_delivery_time"] = FormatAbsoluteTime(t)
+	}
+	return p
+}
+
+// WithValidityPeriod sets until when the SMSC should try to deliver the
+// message, a zero time meaning the SMSC default.
+func (p PDU) WithValidityPeriod(t time.Time) PDU {
+	p.Body.MandatoryParameter["validity_period"] = ""
+	if !t.IsZero() {
+		p.Body.MandatoryParameter["validity_period"] = FormatAbsoluteTime(t)
+	}
+	return p
+}
+
+// WithRelativeValidityPeriod sets for how long after receiving the message
+// the SMSC should try to deliver it.
+func (p PDU) WithRelativeValidityPeriod(d time.Duration) PDU {
+	p.Body.MandatoryParameter["validity_period"] = FormatRelativeTime(d)
+	return p
+}
+
+// GetScheduleDeliveryTime decodes schedule_delivery_time, resolving relative
+// times from the reference.  Errors carry the ESME_RINVSCHED status.
+func (p PDU) GetScheduleDeliveryTime(reference time.Time) (time.Time, error) {
+	value, _ := p.Body.MandatoryParameter["schedule_delivery_time"].(string)
+	scheduled, err := ParseSmppTime(value, reference)
+	if err != nil {
+		return scheduled, StatusError{Status: ESME_RINVSCHED, Err: err}
+	}
+	return scheduled, nil
+}
+
+// GetValidityPeriod decodes validity_period, resolving relative times from
+// the reference.  Errors carry the ESME_RINVEXPIRY status.
+func (p PDU) GetValidityPeriod(reference time.Time) (time.Time, error) {
+	value, _ := p.Body.MandatoryParameter["validity_period"].(string)
+	validity, err := ParseSmppTime(value, reference)
+	if err != nil {
+		return validity, StatusError{Status: ESME_RINVEXPIRY, Err: err}
+	}
+	return validity, nil
+}
+
+// validateMessageTimes makes sure the schedule and validity of a message are
+// decodable and that the message isn't expired before it could be delivered.
+func validateMessageTimes(pdu PDU, now time.Time) error {
+	scheduled, err := pdu.GetScheduleDeliveryTime(now)
+	if err != nil {
+		return err
+	}
+	validity, err := pdu.GetValidityPeriod(now)
+	if err != nil || validity.IsZero() {
+		return err
+	}
+	if validity.Before(now) {
+		return StatusError{Status: ESME_RINVEXPIRY, Err: fmt.Errorf("validity period %v is already expired", validity)}
+	}
+	if !scheduled.IsZero() && validity.Before(scheduled) {
+		return StatusError{Status: ESME_RINVEXPIRY, Err: fmt.Errorf("validity period %v is before the scheduled delivery %v", validity, scheduled)}
+	}
+	return nil
+}
+
+func abs(value int) int {
+	if value < 0 {
+		return -value
+	}
+	return value
+}
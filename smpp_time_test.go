@@ -0,0 +1,155 @@
+package smpp
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+var smppTimeReference = time.Date(2023, 5, 17, 13, 45, 30, 0, time.UTC)
+
+func TestFormatAbsoluteTime(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name string
+		time time.Time
+		want string
+	}{
+		{"UTC time", time.Date(2023, 5, 17, 13, 45, 30, 0, time.UTC), "230517134530000+"},
+		{"tenth of second", time.Date(2023, 5, 17, 13, 45, 30, 750*int(time.Millisecond), time.UTC), "230517134530700+"},
+		{"negative offset", time.Date(2023, 5, 17, 13, 45, 30, 0, time.FixedZone("", -5*3600)), "230517134530020-"},
+		{"quarter hour offset", time.Date(2023, 5, 17, 13, 45, 30, 0, time.FixedZone("", 5*3600+45*60)), "230517134530023+"},
+		{"offset not on a quarter hour is rendered in UTC", time.Date(2023, 5, 17, 13, 45, 30, 0, time.FixedZone("", 10*60)), "230517133530000+"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := FormatAbsoluteTime(tt.time); got != tt.want {
+				t.Errorf("FormatAbsoluteTime() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatRelativeTime(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name     string
+		duration time.Duration
+		want     string
+	}{
+		{"seconds", 45 * time.Second, "000000000045000R"},
+		{"days, hours and minutes", 2*24*time.Hour + 3*time.Hour + 4*time.Minute, "000002030400000R"},
+		{"longer than 99 days is carried in months and years", 400 * 24 * time.Hour, "010110000000000R"},
+		{"negative duration", -time.Hour, "000000000000000R"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := FormatRelativeTime(tt.duration); got != tt.want {
+				t.Errorf("FormatRelativeTime() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseSmppTime(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name    string
+		value   string
+		want    time.Time
+		wantErr bool
+	}{
+		{"empty means immediate", "", time.Time{}, false},
+		{"absolute UTC", "230517134530000+", time.Date(2023, 5, 17, 13, 45, 30, 0, time.UTC), false},
+		{"absolute with tenth and quarter hour offset", "230517134530723+", time.Date(2023, 5, 17, 13, 45, 30, 700*int(time.Millisecond), time.FixedZone("", 5*3600+45*60)), false},
+		{"absolute negative offset", "230517134530014-", time.Date(2023, 5, 17, 13, 45, 30, 0, time.FixedZone("", -3*3600-30*60)), false},
+		{"relative", "000102030405000R", smppTimeReference.Add(32*24*time.Hour + 3*time.Hour + 4*time.Minute + 5*time.Second), false},
+		{"relative years are 12 months of 30 days", "010000000000000R", smppTimeReference.Add(360 * 24 * time.Hour), false},
+		{"too short", "2305171345", time.Time{}, true},
+		{"not digits", "23O517134530000+", time.Time{}, true},
+		{"signed field", "+10000000000000R", time.Time{}, true},
+		{"signed offset", "230517134530+4+", time.Time{}, true},
+		{"relative with tenths", "000000000045100R", time.Time{}, true},
+		{"relative with an offset", "000000000045004R", time.Time{}, true},
+		{"invalid month", "231317134530000+", time.Time{}, true},
+		{"invalid day", "230231134530000+", time.Time{}, true},
+		{"offset too large", "230517134530049+", time.Time{}, true},
+		{"invalid direction", "230517134530000*", time.Time{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseSmppTime(tt.value, smppTimeReference)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseSmppTime() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !got.Equal(tt.want) {
+				t.Errorf("ParseSmppTime() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScheduleAndValidityBuildersRoundTrip(t *testing.T) {
+	t.Parallel()
+	scheduled := time.Date(2023, 5, 17, 14, 0, 0, 0, time.FixedZone("", -4*3600))
+	submitSm := NewSubmitSM().
+		WithScheduleDeliveryTime(scheduled).
+		WithRelativeValidityPeriod(48 * time.Hour)
+
+	actualScheduled, err := submitSm.GetScheduleDeliveryTime(smppTimeReference)
+	if err != nil || !actualScheduled.Equal(scheduled) {
+		t.Errorf("GetScheduleDeliveryTime() = %v, %v, want %v", actualScheduled, err, scheduled)
+	}
+	actualValidity, err := submitSm.GetValidityPeriod(smppTimeReference)
+	if err != nil || !actualValidity.Equal(smppTimeReference.Add(48*time.Hour)) {
+		t.Errorf("GetValidityPeriod() = %v, %v", actualValidity, err)
+	}
+
+	submitSm = submitSm.WithValidityPeriod(scheduled)
+	if submitSm.Body.MandatoryParameter["validity_period"] != "230517140000016-" {
+		t.Errorf("Absolute validity period wasn't formatted : %v", submitSm.Body.MandatoryParameter["validity_period"])
+	}
+}
+
+func TestRelativeValidityPeriodRoundTrips(t *testing.T) {
+	t.Parallel()
+	for _, duration := range []time.Duration{45 * time.Second, 48 * time.Hour, 99*24*time.Hour + time.Minute, 400 * 24 * time.Hour, 1000*24*time.Hour + 5*time.Hour} {
+		submitSm := NewSubmitSM().WithRelativeValidityPeriod(duration)
+		validity, err := submitSm.GetValidityPeriod(smppTimeReference)
+		if err != nil || validity.Sub(smppTimeReference) != duration {
+			t.Errorf("Validity period of %v = %v, %v", duration, validity.Sub(smppTimeReference), err)
+		}
+	}
+}
+
+func TestInvalidTimesCarryTheirStatus(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name       string
+		pdu        PDU
+		wantStatus string
+	}{
+		{"invalid schedule", NewSubmitSM().WithDefaults(map[string]interface{}{"schedule_delivery_time": "tomorrow"}), ESME_RINVSCHED},
+		{"invalid validity", NewSubmitSM().WithDefaults(map[string]interface{}{"validity_period": "next week"}), ESME_RINVEXPIRY},
+		{"relative schedule with an offset", NewSubmitSM().WithDefaults(map[string]interface{}{"schedule_delivery_time": "000001000000004R"}), ESME_RINVSCHED},
+		{"relative validity with tenths", NewSubmitSM().WithDefaults(map[string]interface{}{"validity_period": "000002000000500R"}), ESME_RINVEXPIRY},
+		{"already expired", NewSubmitSM().WithValidityPeriod(smppTimeReference.Add(-time.Hour)), ESME_RINVEXPIRY},
+		{"expiring before schedule", NewSubmitSM().WithScheduleDeliveryTime(smppTimeReference.Add(2 * time.Hour)).WithRelativeValidityPeriod(time.Hour), ESME_RINVEXPIRY},
+		{"valid times", NewSubmitSM().WithScheduleDeliveryTime(smppTimeReference.Add(time.Hour)).WithRelativeValidityPeriod(2 * time.Hour), ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateMessageTimes(tt.pdu, smppTimeReference)
+			if tt.wantStatus == "" {
+				if err != nil {
+					t.Errorf("validateMessageTimes() error = %v", err)
+				}
+				return
+			}
+			var statusError StatusError
+			if !errors.As(err, &statusError) || statusError.Status != tt.wantStatus {
+				t.Errorf("validateMessageTimes() error = %v, want status %v", err, tt.wantStatus)
+			}
+		})
+	}
+}
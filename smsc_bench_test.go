@@ -0,0 +1,96 @@
+package smpp
+
+import (
+	"fmt"
+	"net"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// BenchmarkSmscIdleSessions binds n sessions and reports what each idle
+// session costs to the process.  Both ends of the connections live in the
+// benchmark, 10000 sessions need an open files limit above 20000.
+func BenchmarkSmscIdleSessions(b *testing.B) {
+	for _, sessions := range []int{100, 1000, 10000} {
+		b.Run(fmt.Sprintf("%d sessions", sessions), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				benchmarkIdleSessions(b, sessions)
+			}
+		})
+	}
+}
+
+func benchmarkIdleSessions(b *testing.B, sessions int) {
+	smsc, err := GetSmscSimulatorServer()
+	if err != nil {
+		b.Fatalf("couldn't start server successfully: %v", err)
+	}
+	smsc.Logger = silentLogger{}
+	smsc.Start()
+	defer smsc.Close()
+	bindBytes, _ := EncodePdu(NewBindTransceiver().WithSystemId(validSystemID).WithPassword(validPassword).WithSequenceNumber(1))
+
+	before := sessionCosts()
+	clients := make([]net.Conn, 0, sessions)
+	defer func() {
+		for _, client := range clients {
+			client.Close()
+		}
+	}()
+	for len(clients) < sessions {
+		client, err := net.Dial(connType, smsc.listeningSocket.Addr().String())
+		if err != nil {
+			b.Skipf("Couldn't open session %v, the open files limit is probably too low : %v", len(clients), err)
+		}
+		clients = append(clients, client)
+		if _, err = client.Write(bindBytes); err != nil {
+			b.Fatalf("Couldn't bind session %v : %v", len(clients), err)
+		}
+		if _, err = readPduBytesFromConnection(client, time.Now().Add(5*time.Second)); err != nil {
+			b.Fatalf("Couldn't read bind response of session %v : %v", len(clients), err)
+		}
+	}
+	after := sessionCosts()
+	b.ReportMetric(float64(after.bytes-before.bytes)/float64(sessions), "B/session")
+	b.ReportMetric(float64(after.goroutines-before.goroutines)/float64(sessions), "goroutines/session")
+}
+
+type costs struct {
+	bytes      uint64
+	goroutines int
+}
+
+func sessionCosts() costs {
+	runtime.GC()
+	var memStats runtime.MemStats
+	runtime.ReadMemStats(&memStats)
+	return costs{memStats.HeapAlloc + memStats.StackInuse, runtime.NumGoroutine()}
+}
+
+// BenchmarkSmscSubmitSm measures submit_sm round trips on a single bound
+// session.
+func BenchmarkSmscSubmitSm(b *testing.B) {
+	smsc, err := GetSmscSimulatorServer()
+	if err != nil {
+		b.Fatalf("couldn't start server successfully: %v", err)
+	}
+	smsc.Logger = silentLogger{}
+	smsc.Start()
+	defer smsc.Close()
+	esme, err := InstantiateEsme(smsc.listeningSocket.Addr(), connType)
+	if err != nil {
+		b.Fatalf("couldn't connect client to server successfully: %v", err)
+	}
+	defer esme.Close()
+	if _, err = esme.BindTransmitter(validSystemID, validPassword); err != nil {
+		b.Fatalf("Couldn't bind : %v", err)
+	}
+	submitSm := NewSubmitSM().WithSourceAddress("15551234567").WithDestinationAddress("15557654321").WithMessage("Hello")
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err = esme.sendAndWaitForResponse(submitSm); err != nil {
+			b.Fatalf("Couldn't submit : %v", err)
+		}
+	}
+}
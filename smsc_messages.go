@@ -0,0 +1,292 @@
+package smpp
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+func (s *SMSC) acceptMessage(session *Session, submitSm PDU) (StoredMessage, error) {
+	now := s.Clock.Now()
+	message := StoredMessage{
+		MessageId:   s.MessageIdGenerator(),
+		SystemId:    session.SystemId(),
+		Source:      submitSm.GetSource(),
+		Destination: submitSm.GetDestination(),
+		State:       "ENROUTE",
+		SubmitDate:  now,
+		Pdu:         submitSm,
+	}
+	if err := message.setDeliveryTimes(submitSm, now); err != nil {
+		return message, err
+	}
+	return message, s.MessageStore.Store(message)
+}
+
+func (m *StoredMessage) setDeliveryTimes(pdu PDU, now time.Time) (err error) {
+	m.ScheduleDeliveryTime, err = pdu.GetScheduleDeliveryTime(now)
+	if err != nil {
+		return err
+	}
+	m.ExpiryTime, err = pdu.GetValidityPeriod(now)
+	return err
+}
+
+type deliveryKey struct {
+	receiver       *Session
+	sequenceNumber int
+}
+
+type pendingDelivery struct {
+	messageId string
+	sentAt    time.Time
+}
+
+// routeMessage gives the receiver of the message and whether a route or an
+// address_range took the message in charge, even when no receiver is bound.
+// Receivers sharing a system_id take turns.
+func (s *SMSC) routeMessage(message StoredMessage) (*Session, bool) {
+	candidates := []*Session{}
+	route, routed := s.RoutingTable.Match(message)
+	for _, session := range s.Sessions() {
+		if !session.isReceiverState() {
+			continue
+		}
+		if routed && session.SystemId() == route.SystemId {
+			candidates = append(candidates, session)
+		}
+		if !routed && session.servesDestination(message.Destination.Addr) {
+			candidates = append(candidates, session)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil, routed
+	}
+	turn := atomic.AddUint64(&s.routedMessages, 1)
+	return candidates[turn%uint64(len(candidates))], true
+}
+
+func (s *SMSC) deliverMessage(receiver *Session, message StoredMessage) {
+	deliverSm := deliverSmFromSubmitSm(message.Pdu).
+		WithSequenceNumber(int(atomic.AddInt32(&receiver.sequenceNumber, 1)))
+	key := deliveryKey{receiver, deliverSm.Header.SequenceNumber}
+	s.pendingDeliveries.Store(key, pendingDelivery{message.MessageId, time.Now()})
+	receiver.metrics.WindowOccupancy(1)
+	if _, err := receiver.Send(&deliverSm); err != nil {
+		withPdu(receiver.log(), deliverSm).Warn("Couldn't deliver the message, retrying later", "message_id", message.MessageId, "error", err)
+		if _, ok := s.pendingDeliveries.LoadAndDelete(key); ok {
+			receiver.metrics.WindowOccupancy(-1)
+			s.retryDelivery(message.MessageId, s.deliveryRetryDelay())
+		}
+	}
+}
+
+// deliverSmFromSubmitSm gives the deliver_sm carrying a submitted message.
+// Fields which must be empty in a deliver_sm (SMPP v3.4, section 4.6.1) are
+// reset and only the GSM features of the esm_class are kept.
+func deliverSmFromSubmitSm(submitSm PDU) PDU {
+	deliverSm := NewDeliverSM()
+	for name := range deliverSm.Body.MandatoryParameter {
+		if value, ok := submitSm.Body.MandatoryParameter[name]; ok {
+			deliverSm.Body.MandatoryParameter[name] = value
+		}
+	}
+	for _, name := range []string{"schedule_delivery_time", "validity_period"} {
+		deliverSm.Body.MandatoryParameter[name] = ""
+	}
+	for _, name := range []string{"registered_delivery", "replace_if_present_flag", "sm_default_msg_id"} {
+		deliverSm.Body.MandatoryParameter[name] = 0
+	}
+	features := submitSm.GetEsmClass() & EsmClass(fieldMappingBits("esm_class_bits", "feature_mask"))
+	deliverSm.Body.OptionalParameters = append(deliverSm.Body.OptionalParameters, submitSm.Body.OptionalParameters...)
+	return deliverSm.WithEsmClass(features)
+}
+
+func (s *SMSC) finalizeMessage(messageId string, finalState string) {
+	var message StoredMessage
+	err := s.MessageStore.Update(messageId, func(m *StoredMessage) error {
+		if m.State != "ENROUTE" {
+			return fmt.Errorf("message %v is already %v", messageId, m.State)
+		}
+		m.State = finalState
+		m.DoneDate = s.Clock.Now()
+		message = *m
+		return nil
+	})
+	if err != nil {
+		s.log().Info("Couldn't bring the message to its final state", "message_id", messageId, "error", err)
+		return
+	}
+	s.forgetMessage(messageId)
+	if isDeliveryReceiptRequested(message.Pdu, message.State) {
+		s.sendDeliveryReceipt(message)
+	}
+}
+
+// findOwnedMessage gives the message targeted by a query_sm, cancel_sm or
+// replace_sm.  ESMEs only get to see the messages submitted under their own
+// system_id and, when given, from the same source address.
+func (s *SMSC) findOwnedMessage(session *Session, receivedPdu PDU) (StoredMessage, error) {
+	messageId, _ := receivedPdu.Body.MandatoryParameter["message_id"].(string)
+	message, err := s.MessageStore.Get(messageId)
+	if err != nil {
+		return StoredMessage{}, err
+	}
+	source := receivedPdu.GetSource()
+	if message.SystemId != session.SystemId() || (source.Addr != "" && source.Addr != message.Source.Addr) {
+		return StoredMessage{}, fmt.Errorf("%w : %v", ErrMessageNotFound, messageId)
+	}
+	return message, nil
+}
+
+// cancelMessages cancels the message given by message_id, or when it's
+// empty, every pending message of the ESME from source_addr to
+// destination_addr.
+func (s *SMSC) cancelMessages(session *Session, cancelSm PDU) error {
+	messageIds, err := s.messagesToCancel(session, cancelSm)
+	if err != nil {
+		return err
+	}
+	for _, messageId := range messageIds {
+		err = s.MessageStore.Update(messageId, func(m *StoredMessage) error {
+			if m.State != "ENROUTE" {
+				return fmt.Errorf("message %v is already %v", messageId, m.State)
+			}
+			m.State = "DELETED"
+			m.DoneDate = s.Clock.Now()
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		s.forgetMessage(messageId)
+	}
+	return nil
+}
+
+func (s *SMSC) messagesToCancel(session *Session, cancelSm PDU) ([]string, error) {
+	if messageId, _ := cancelSm.Body.MandatoryParameter["message_id"].(string); messageId != "" {
+		message, err := s.findOwnedMessage(session, cancelSm)
+		return []string{message.MessageId}, err
+	}
+	messages, err := s.MessageStore.List()
+	if err != nil {
+		return nil, err
+	}
+	source, destination := cancelSm.GetSource(), cancelSm.GetDestination()
+	systemId := session.SystemId()
+	messageIds := []string{}
+	for _, message := range messages {
+		if message.SystemId == systemId && message.State == "ENROUTE" &&
+			message.Source.Addr == source.Addr && message.Destination.Addr == destination.Addr {
+			messageIds = append(messageIds, message.MessageId)
+		}
+	}
+	if len(messageIds) == 0 {
+		return nil, fmt.Errorf("no pending message from %v to %v", source, destination)
+	}
+	return messageIds, nil
+}
+
+// replaceMessage only replaces the messages still waiting in the SMSC, not
+// the ones already handed over to a receiver.
+func (s *SMSC) replaceMessage(session *Session, replaceSm PDU) error {
+	message, err := s.findOwnedMessage(session, replaceSm)
+	if err != nil {
+		return err
+	}
+	s.timersMu.Lock()
+	defer s.timersMu.Unlock()
+	if timers, ok := s.timers[message.MessageId]; !ok || timers.delivery == nil {
+		return fmt.Errorf("message %v isn't waiting in the SMSC anymore", message.MessageId)
+	}
+	err = s.MessageStore.Update(message.MessageId, func(m *StoredMessage) error {
+		if m.State != "ENROUTE" {
+			return fmt.Errorf("message %v is already %v", m.MessageId, m.State)
+		}
+		now := s.Clock.Now()
+		replaced := replacedSubmitSm(m.Pdu, replaceSm)
+		if err := validateMessageTimes(replaced, now); err != nil {
+			return err
+		}
+		if err := m.setDeliveryTimes(replaced, now); err != nil {
+			return err
+		}
+		m.Pdu = replaced
+		message = *m
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	s.scheduleMessageLocked(message)
+	return nil
+}
+
+// replacedSubmitSm gives a copy of the submit_sm with the fields of the
+// replace_sm.  Empty schedule_delivery_time and validity_period keep the
+// original ones.
+func replacedSubmitSm(submitSm PDU, replaceSm PDU) PDU {
+	mandatoryParameters := make(map[string]interface{}, len(submitSm.Body.MandatoryParameter))
+	for name, value := range submitSm.Body.MandatoryParameter {
+		mandatoryParameters[name] = value
+	}
+	for _, name := range []string{"schedule_delivery_time", "validity_period"} {
+		if value, _ := replaceSm.Body.MandatoryParameter[name].(string); value != "" {
+			mandatoryParameters[name] = value
+		}
+	}
+	for _, name := range []string{"registered_delivery", "sm_default_msg_id", "short_message"} {
+		mandatoryParameters[name] = replaceSm.Body.MandatoryParameter[name]
+	}
+	submitSm.Body.MandatoryParameter = mandatoryParameters
+	return submitSm
+}
+
+func isDeliveryReceiptRequested(submitSm PDU, finalState string) bool {
+	switch submitSm.GetRegisteredDelivery().Receipt() {
+	case "always":
+		return true
+	case "on_fail":
+		return finalState != "DELIVERED"
+	}
+	return false
+}
+
+func (s *SMSC) sendDeliveryReceipt(message StoredMessage) {
+	receiver := s.findReceiverBoundAs(message.SystemId)
+	if receiver == nil {
+		s.log().Info("No receiver bound to send the delivery receipt", "system_id", message.SystemId, "message_id", message.MessageId)
+		return
+	}
+	delivered := 0
+	if message.State == "DELIVERED" {
+		delivered = 1
+	}
+	shortMessage, _ := message.Pdu.Body.MandatoryParameter["short_message"].(string)
+	if len(shortMessage) > 20 {
+		shortMessage = shortMessage[:20]
+	}
+	receipt := NewDeliveryReceipt(DeliveryReceipt{
+		MessageId:    message.MessageId,
+		Submitted:    1,
+		Delivered:    delivered,
+		SubmitDate:   message.SubmitDate,
+		DoneDate:     message.DoneDate,
+		MessageState: message.State,
+		Text:         shortMessage,
+	}).WithSource(message.Destination).WithDestination(message.Source)
+	_, err := receiver.Send(&receipt)
+	if err != nil {
+		withPdu(receiver.log(), receipt).Warn("Couldn't send the delivery receipt", "message_id", message.MessageId, "error", err)
+	}
+}
+
+func (s *SMSC) findReceiverBoundAs(systemId string) *Session {
+	for _, session := range s.Sessions() {
+		if session.SystemId() == systemId && session.isReceiverState() {
+			return session
+		}
+	}
+	return nil
+}
@@ -74,3 +74,33 @@ func assertListenerIsClosed(smsc *SMSC, t *testing.T) {
 		t.Errorf("The listening socket wasn't closed! %v", err)
 	}
 }
+
+func TestSmscAcceptsConnectionsOnEveryListener(t *testing.T) {
+	smsc, err := GetSmscSimulatorServer()
+	if err != nil {
+		t.Fatalf("couldn't start server successfully: %v", err)
+	}
+	other, err := net.Listen(connType, connhost+":"+connport)
+	if err != nil {
+		t.Fatalf("couldn't listen: %v", err)
+	}
+	smsc.AddListener(other)
+	smsc.Start()
+	if addrs := smsc.Addrs(); len(addrs) != 2 || addrs[1] != other.Addr() {
+		t.Errorf("SMSC listens on %v", addrs)
+	}
+	Esme, err := InstantiateEsme(other.Addr(), connType)
+	if err != nil {
+		t.Fatalf("couldn't connect client to server successfully: %v", err)
+	}
+	defer CloseAndAssertClean(smsc, Esme, t)
+	if _, err := Esme.BindTransceiver(validSystemID, validPassword); err != nil {
+		t.Errorf("Couldn't bind through the other listener : %v", err)
+	}
+
+	smsc.Close()
+
+	if err := other.Close(); err == nil {
+		t.Errorf("The other listener wasn't closed")
+	}
+}